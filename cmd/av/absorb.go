@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/absorb"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/sequencer"
+	"github.com/aviator-co/av/internal/sequencer/planner"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/spf13/cobra"
+)
+
+var absorbFlags struct {
+	DryRun bool
+}
+
+var absorbCmd = &cobra.Command{
+	Use:   "absorb",
+	Short: "Absorb the staged changes into the commits of the stack",
+	Long: strings.TrimSpace(`
+Absorb the staged changes into the commits of the stack that they belong to.
+
+Each staged hunk is attributed to the most recent commit of the current branch
+or its ancestor branches that last touched the changed lines (for added lines,
+the lines around them). The hunk is then squashed into that commit, as if a
+fixup commit was created and the stack was rebased with --autosquash, and the
+descendant branches are restacked.
+
+The hunks that cannot be attributed (e.g., new files, or lines that were not
+changed in the stack) are left staged. The attribution is shown before the
+commits are rewritten; use --dry-run to only show it.`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return err
+		}
+		db, err := getDB(ctx, repo)
+		if err != nil {
+			return err
+		}
+		branchName, err := repo.CurrentBranchName()
+		if err != nil {
+			return errors.WrapIf(err, "failed to determine current branch")
+		}
+
+		plan, err := absorb.CreatePlan(ctx, repo, db.ReadTx(), branchName)
+		if err != nil {
+			return err
+		}
+		if len(plan.Assignments) == 0 {
+			return errors.New("there are no staged changes to absorb")
+		}
+		printAbsorbPlan(plan)
+		if absorbFlags.DryRun {
+			fmt.Fprint(os.Stderr, "No changes were made (dry run).\n")
+			return nil
+		}
+		if plan.Absorbed() == 0 {
+			fmt.Fprint(os.Stderr, colors.Warning("Nothing to absorb"), "\n")
+			return nil
+		}
+
+		result, err := plan.Apply(ctx, repo, db)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(
+			os.Stderr,
+			colors.SuccessStyle.Render(fmt.Sprintf(
+				"✓ Absorbed %d hunk(s) into %s", plan.Absorbed(), strings.Join(result.Order, ", "),
+			)),
+			"\n",
+		)
+
+		// Restack the descendants of the rewritten branches except for the
+		// branches that were already rewritten.
+		tx := db.ReadTx()
+		ops, err := planner.PlanForAmend(tx, repo, plumbing.NewBranchReferenceName(result.Order[0]))
+		if err != nil {
+			return err
+		}
+		var restackOps []sequencer.RestackOp
+		for _, op := range ops {
+			if _, ok := result.Branches[op.Name.Short()]; !ok {
+				restackOps = append(restackOps, op)
+			}
+		}
+		if len(restackOps) == 0 {
+			return nil
+		}
+		return absorbRestack(ctx, repo, db, restackOps)
+	},
+}
+
+// absorbRestack restacks the descendants. The remaining staged and unstaged
+// changes are stashed during the restack since git rebase requires a clean
+// working tree.
+func absorbRestack(ctx context.Context, repo *git.Repo, db meta.DB, ops []sequencer.RestackOp) error {
+	status, err := repo.Status(ctx)
+	if err != nil {
+		return err
+	}
+	stashed := false
+	if !status.IsCleanIgnoringUntracked() {
+		if _, err := repo.Git(ctx, "stash", "push", "--quiet", "--message", "av absorb"); err != nil {
+			return errors.WrapIf(err, "failed to stash the remaining changes")
+		}
+		stashed = true
+	}
+	restackErr := runRestackOps(repo, db, ops)
+	if !stashed {
+		return restackErr
+	}
+	if restackErr != nil {
+		fmt.Fprint(
+			os.Stderr,
+			colors.Warning("The remaining changes are stashed. After the restack is done, run "),
+			colors.CliCmd("git stash pop --index"),
+			colors.Warning(" to restore them."),
+			"\n",
+		)
+		return restackErr
+	}
+	if _, err := repo.Git(ctx, "stash", "pop", "--index", "--quiet"); err != nil {
+		return errors.WrapIf(err, "failed to restore the stashed changes (run git stash pop --index)")
+	}
+	return nil
+}
+
+func printAbsorbPlan(plan *absorb.Plan) {
+	var absorbed, left []*absorb.Assignment
+	for _, a := range plan.Assignments {
+		if a.Target != nil {
+			absorbed = append(absorbed, a)
+		} else {
+			left = append(left, a)
+		}
+	}
+	location := func(a *absorb.Assignment) string {
+		if a.Hunk == nil {
+			return a.File.Path
+		}
+		return a.Hunk.Location(a.File.Path)
+	}
+	if len(absorbed) > 0 {
+		fmt.Fprint(os.Stderr, "Absorbing ", len(absorbed), " hunk(s):\n")
+		for _, a := range absorbed {
+			fmt.Fprint(
+				os.Stderr,
+				"  - ", location(a), " → ",
+				colors.UserInput(git.ShortSha(a.Target.Hash)), " ", a.Target.MessageTitle(),
+				colors.Faint(" ("+a.Target.Branch+")"), "\n",
+			)
+		}
+	}
+	if len(left) > 0 {
+		fmt.Fprint(os.Stderr, "Leaving ", len(left), " hunk(s) staged:\n")
+		for _, a := range left {
+			fmt.Fprint(os.Stderr, "  - ", location(a), colors.Faint(" ("+a.Reason+")"), "\n")
+		}
+	}
+}
+
+func init() {
+	absorbCmd.Flags().BoolVar(
+		&absorbFlags.DryRun, "dry-run", false,
+		"show which commits the staged hunks would be absorbed into without changing anything",
+	)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/utils/colors"
+)
+
+// autostash stashes the local changes in the current worktree for the
+// --autostash flag of the commands that rewrite the branches without the
+// sequencer (the sequencer stashes the changes by itself). Returns an empty
+// string if there is nothing to stash.
+func autostash(ctx context.Context, repo *git.Repo, includeUntracked bool) (string, error) {
+	stash, err := git.StashPush(ctx, repo.Dir(), "av autostash", includeUntracked)
+	if err != nil {
+		return "", err
+	}
+	if stash != "" {
+		fmt.Fprint(os.Stderr, colors.Faint("Stashed the local changes in "+repo.Dir()), "\n")
+	}
+	return stash, nil
+}
+
+// restoreAutostash restores the local changes stashed by autostash.
+func restoreAutostash(ctx context.Context, repo *git.Repo, stash string) error {
+	if stash == "" {
+		return nil
+	}
+	if err := git.StashRestore(ctx, repo.Dir(), stash); err != nil {
+		return err
+	}
+	fmt.Fprint(os.Stderr, colors.Faint("Restored the stashed changes in "+repo.Dir()), "\n")
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	"emperror.dev/errors"
@@ -32,6 +33,21 @@ var branchFlags struct {
 	Force bool
 	Split bool
 	// If true, split the latest commit into a new branch
+
+	// If true, insert the new branch between the current branch and its
+	// children.
+	Insert bool
+
+	// If true, delete the branch (or the current branch) and reparent its
+	// children onto its parent.
+	Delete bool
+	// If true, the children keep the commits of the deleted branch.
+	KeepCommits bool
+	// If true, delete the remote branch as well.
+	DeleteRemote bool
+
+	// The description of the new branch.
+	Description string
 }
 var branchCmd = &cobra.Command{
 	Use:   "branch [flags] <branch-name> [<parent-branch>]",
@@ -41,14 +57,26 @@ Create a new branch that is stacked on the current branch.
 
 <parent-branch>. If omitted, the new branch bases off the current branch.
 
+If the --insert flag is given, the new branch is inserted between the current
+branch and its children: the children are moved under the new branch and
+restacked.
+
+If the --delete flag is given, the given branch (or the current branch) is
+deleted and its children are moved under its parent and restacked. The commits
+of the deleted branch are dropped from the children unless --keep-commits is
+given. The open pull request of the branch is closed.
+
 If the --rename/-m flag is given, the current branch is renamed to the name
 given as the first argument to the command. Branches should only be renamed
 with this command (not with git branch -m ...) because av needs to update
-internal tracking metadata that defines the order of branches within a stack.`),
+internal tracking metadata that defines the order of branches within a stack.
+
+"describe" and "label" are subcommands of av branch. To create a branch with
+one of these names, put "--" before it (e.g., av branch -- describe).`),
 	Args: cobra.RangeArgs(0, 2),
 	RunE: func(cmd *cobra.Command, args []string) (reterr error) {
 		ctx := cmd.Context()
-		if len(args) == 0 && !branchFlags.Split {
+		if len(args) == 0 && !branchFlags.Split && !branchFlags.Delete {
 			// The only time we don't want to suppress the usage message is when
 			// a user runs `av branch` with no arguments.
 			return cmd.Usage()
@@ -64,12 +92,22 @@ internal tracking metadata that defines the order of branches within a stack.`),
 			return err
 		}
 		var branchName string
-		if len(args) == 0 && branchFlags.Split {
+		if len(args) == 0 && (branchFlags.Split || branchFlags.Delete) {
 			branchName = ""
 		} else {
 			branchName = args[0]
 		}
 
+		if branchFlags.Delete {
+			if len(args) > 1 {
+				return errors.New("unexpected extra arguments with --delete flag")
+			}
+			return branchDelete(ctx, repo, db, branchName, branchFlags.KeepCommits, branchFlags.DeleteRemote)
+		}
+		if branchFlags.KeepCommits || branchFlags.DeleteRemote {
+			return errors.New("--keep-commits and --delete-remote can only be used with --delete")
+		}
+
 		if branchFlags.Rename {
 			if len(args) > 1 {
 				return errors.New("unexpected extra arguments with --rename/-m flag\n" +
@@ -100,11 +138,18 @@ internal tracking metadata that defines the order of branches within a stack.`),
 			return nil
 		}
 
+		if branchFlags.Insert {
+			if len(args) > 1 {
+				return errors.New("cannot specify a parent branch with --insert")
+			}
+			return branchInsert(ctx, repo, db, branchName, branchFlags.Description)
+		}
+
 		if len(args) == 2 {
 			branchFlags.Parent = args[1]
 		}
 
-		return createBranch(ctx, repo, db, branchName, branchFlags.Parent)
+		return createBranch(ctx, repo, db, branchName, branchFlags.Parent, branchFlags.Description)
 	},
 }
 
@@ -266,6 +311,22 @@ func init() {
 		BoolVar(&branchFlags.Force, "force", false, "force rename the current branch, even if a pull request exists")
 	branchCmd.Flags().
 		BoolVar(&branchFlags.Split, "split", false, "split the last commit into a new branch, if no branch name is given, one will be auto-generated")
+	branchCmd.Flags().
+		StringVar(&branchFlags.Description, "description", "", "the description of the new branch (see av branch describe)")
+	branchCmd.Flags().
+		BoolVar(&branchFlags.Insert, "insert", false, "insert the new branch between the current branch and its children")
+	branchCmd.MarkFlagsMutuallyExclusive("insert", "rename")
+	branchCmd.MarkFlagsMutuallyExclusive("insert", "split")
+	branchCmd.MarkFlagsMutuallyExclusive("insert", "parent")
+	branchCmd.Flags().
+		BoolVar(&branchFlags.Delete, "delete", false, "delete the branch and move its children under its parent")
+	branchCmd.Flags().
+		BoolVar(&branchFlags.KeepCommits, "keep-commits", false, "with --delete, keep the commits of the deleted branch in its children")
+	branchCmd.Flags().
+		BoolVar(&branchFlags.DeleteRemote, "delete-remote", false, "with --delete, delete the remote branch as well")
+	for _, flag := range []string{"rename", "split", "insert", "parent", "description"} {
+		branchCmd.MarkFlagsMutuallyExclusive("delete", flag)
+	}
 
 	_ = branchCmd.RegisterFlagCompletionFunc(
 		"parent",
@@ -282,6 +343,7 @@ func createBranch(
 	db meta.DB,
 	branchName string,
 	parentBranchName string,
+	description string,
 ) (reterr error) {
 	// Apply branch name prefix
 	branchName = applyBranchNamePrefix(branchName)
@@ -315,6 +377,7 @@ func createBranch(
 	isBranchFromTrunk := repo.IsTrunkBranch(parentBranchName)
 	checkoutStartingPoint := parentBranchName
 	var parentHead string
+	var labels []string
 	if isBranchFromTrunk {
 		// If the parent is trunk, start from the remote tracking branch.
 		checkoutStartingPoint = remoteName + "/" + parentBranchName
@@ -331,9 +394,12 @@ func createBranch(
 			)
 		}
 
-		if _, exist := tx.Branch(parentBranchName); !exist {
+		parentMeta, exist := tx.Branch(parentBranchName)
+		if !exist {
 			return uiutils.ErrParentNotAdopted
 		}
+		// Labels are carried down to the child branches.
+		labels = slices.Clone(parentMeta.Labels)
 	}
 
 	// Resolve to a commit hash for the starting point.
@@ -392,6 +458,8 @@ func createBranch(
 			Trunk:                    isBranchFromTrunk,
 			BranchingPointCommitHash: parentHead,
 		},
+		Description: strings.TrimSpace(description),
+		Labels:      labels,
 	})
 
 	cu.Cancel()
@@ -401,6 +469,62 @@ func createBranch(
 	return nil
 }
 
+// branchInsert creates a new branch on top of the current branch and moves the
+// children of the current branch under the new branch.
+func branchInsert(
+	ctx context.Context,
+	repo *git.Repo,
+	db meta.DB,
+	branchName string,
+	description string,
+) error {
+	parentBranchName, err := repo.CurrentBranchName()
+	if err != nil {
+		return errors.WrapIff(err, "failed to get current branch name")
+	}
+	if repo.IsTrunkBranch(parentBranchName) {
+		return errors.Errorf(
+			"cannot insert a branch above trunk branch %q; check out the branch to insert after",
+			parentBranchName,
+		)
+	}
+	children := meta.Children(db.ReadTx(), parentBranchName)
+	if err := createBranch(ctx, repo, db, branchName, parentBranchName, description); err != nil {
+		return err
+	}
+	branchName = applyBranchNamePrefix(branchName)
+
+	// The new branch contains all the commits of the current branch, so the
+	// branching points of the children stay the same.
+	tx := db.WriteTx()
+	for _, child := range children {
+		child.Parent = meta.BranchState{
+			Name:                     branchName,
+			BranchingPointCommitHash: child.Parent.BranchingPointCommitHash,
+		}
+		tx.SetBranch(child)
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	fmt.Fprint(
+		os.Stderr,
+		colors.SuccessStyle.Render("✓ Inserted "+branchName+" after "+parentBranchName),
+		"\n",
+	)
+	if len(children) == 0 {
+		return nil
+	}
+	for _, child := range children {
+		fmt.Fprint(
+			os.Stderr,
+			"  - Moved ", colors.UserInput(child.Name), " under ", colors.UserInput(branchName), "\n",
+		)
+	}
+	return runPostCommitRestack(repo, db)
+}
+
 func branchMove(
 	ctx context.Context,
 	repo *git.Repo,
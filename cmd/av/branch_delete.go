@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/sequencer"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+)
+
+// branchDelete deletes the branch and reparents its children onto its parent.
+// If keepCommits is true, the children keep the commits of the deleted branch;
+// otherwise, the commits are dropped when the children are restacked.
+func branchDelete(
+	ctx context.Context,
+	repo *git.Repo,
+	db meta.DB,
+	branchName string,
+	keepCommits bool,
+	deleteRemote bool,
+) error {
+	currentBranch, err := repo.CurrentBranchName()
+	if err != nil {
+		return errors.WrapIf(err, "failed to determine current branch")
+	}
+	if branchName == "" {
+		branchName = currentBranch
+	}
+	if repo.IsTrunkBranch(branchName) {
+		return errors.Errorf("cannot delete the trunk branch %q", branchName)
+	}
+
+	tx := db.WriteTx()
+	defer tx.Abort()
+	branch, ok := tx.Branch(branchName)
+	if !ok {
+		return errors.Errorf("branch %q is not adopted to av (use git branch -D to delete it)", branchName)
+	}
+	parentName := branch.Parent.Name
+
+	if branchName != currentBranch {
+		worktrees, err := repo.WorktreeList(ctx)
+		if err != nil {
+			return err
+		}
+		for _, wt := range worktrees {
+			if wt.Branch == branchName {
+				return errors.Errorf(
+					"branch %q is checked out in the worktree at %s",
+					branchName, wt.Path,
+				)
+			}
+		}
+	}
+
+	exists, err := repo.DoesBranchExist(ctx, branchName)
+	if err != nil {
+		return err
+	}
+	var head string
+	if exists {
+		head, err = repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + branchName})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Reparent the children onto the parent. To drop the commits of the
+	// deleted branch, the children are rebased from their current branching
+	// point (a commit of the deleted branch). To keep them, the children are
+	// rebased from the branching point of the deleted branch.
+	children := meta.Children(tx, branchName)
+	for _, child := range children {
+		bp := child.Parent.BranchingPointCommitHash
+		if bp == "" {
+			bp = head
+		}
+		if keepCommits {
+			bp = branch.Parent.BranchingPointCommitHash
+		}
+		child.Parent = meta.BranchState{
+			Name:                     parentName,
+			Trunk:                    branch.Parent.Trunk,
+			BranchingPointCommitHash: bp,
+		}
+		tx.SetBranch(child)
+	}
+	tx.DeleteBranch(branchName)
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Touch the git branch only after the metadata is committed, so that a
+	// failure here leaves a plain git branch rather than dangling metadata.
+	if branchName == currentBranch {
+		if _, err := repo.CheckoutBranch(ctx, &git.CheckoutBranch{Name: parentName}); err != nil {
+			return errors.WrapIff(
+				err, "deleted %q from the av metadata, but failed to check out %q", branchName, parentName,
+			)
+		}
+	}
+	if exists {
+		if err := repo.BranchDelete(ctx, branchName); err != nil {
+			return errors.WrapIff(err, "deleted %q from the av metadata, but failed to delete the branch", branchName)
+		}
+	}
+	if exists {
+		fmt.Fprint(
+			os.Stderr,
+			colors.SuccessStyle.Render("✓ Deleted branch "+branchName+" (was "+git.ShortSha(head)+")"),
+			"\n",
+		)
+	} else {
+		fmt.Fprint(
+			os.Stderr,
+			colors.SuccessStyle.Render("✓ Deleted branch "+branchName+" from the av metadata"),
+			"\n",
+		)
+	}
+	for _, child := range children {
+		fmt.Fprint(
+			os.Stderr,
+			"  - Moved ", colors.UserInput(child.Name), " under ", colors.UserInput(parentName), "\n",
+		)
+	}
+
+	if deleteRemote {
+		if err := deleteRemoteBranch(ctx, repo, branchName); err != nil {
+			fmt.Fprint(
+				os.Stderr,
+				colors.Warning("Failed to delete the remote branch ", branchName, ": ", err),
+				"\n",
+			)
+		}
+	}
+
+	if branch.PullRequest != nil && branch.PullRequest.State == githubv4.PullRequestStateOpen {
+		comment := fmt.Sprintf(
+			"This pull request was closed because `%s` was deleted with `av branch --delete`.",
+			branchName,
+		)
+		if err := closePullRequestWithComment(ctx, branch.PullRequest, comment); err != nil {
+			fmt.Fprint(
+				os.Stderr,
+				colors.Warning("Failed to close pull request #", branch.PullRequest.Number, ": ", err),
+				"\n",
+			)
+		}
+	}
+
+	if len(children) == 0 {
+		return nil
+	}
+	rtx := db.ReadTx()
+	var ops []sequencer.RestackOp
+	for _, child := range children {
+		for _, name := range append([]string{child.Name}, meta.SubsequentBranches(rtx, child.Name)...) {
+			avbr, _ := rtx.Branch(name)
+			if avbr.MergeCommit != "" {
+				// Skip rebasing branches that have merge commits.
+				continue
+			}
+			ops = append(ops, sequencer.RestackOp{
+				Name:             plumbing.NewBranchReferenceName(name),
+				NewParent:        plumbing.NewBranchReferenceName(avbr.Parent.Name),
+				NewParentIsTrunk: avbr.Parent.Trunk,
+				// Merging the new parent would keep the commits of the deleted
+				// branch in the children.
+				Rebase: !keepCommits,
+			})
+		}
+	}
+	return runRestackOps(repo, db, ops)
+}
+
+// deleteRemoteBranch deletes the branch from the remote if it was pushed.
+func deleteRemoteBranch(ctx context.Context, repo *git.Repo, branchName string) error {
+	remote := repo.GetRemoteName()
+	if exists, err := repo.DoesRefExist(ctx, "refs/remotes/"+remote+"/"+branchName); err != nil {
+		return err
+	} else if !exists {
+		logrus.WithField("branch", branchName).Debug("remote branch does not exist, skipping")
+		return nil
+	}
+	if _, err := repo.Run(ctx, &git.RunOpts{
+		Args:      []string{"push", remote, "--delete", branchName},
+		ExitError: true,
+	}); err != nil {
+		return err
+	}
+	fmt.Fprint(
+		os.Stderr,
+		"Deleted remote branch ", colors.UserInput(remote+"/"+branchName), "\n",
+	)
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/editor"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/aviator-co/av/internal/utils/templateutils"
+	"github.com/spf13/cobra"
+)
+
+var branchDescribeCmd = &cobra.Command{
+	Use:   "describe [<branch>]",
+	Short: "Edit the description of a branch",
+	Long: strings.TrimSpace(`
+Open an editor to edit the description of a branch (the current branch by
+default).
+
+The description is free-form text stored in the av metadata, such as why the
+branch exists or TODO notes. It's shown in "av tree --verbose" and used as the
+default body when creating a pull request for the branch with "av pr". An empty
+description removes it.`),
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: branchNameArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return err
+		}
+		db, err := getDB(ctx, repo)
+		if err != nil {
+			return err
+		}
+
+		var branchName string
+		if len(args) > 0 {
+			branchName = args[0]
+		} else {
+			branchName, err = repo.CurrentBranchName()
+			if err != nil {
+				return err
+			}
+		}
+		// Don't hold the database lock while the editor is open.
+		branch, ok := db.ReadTx().Branch(branchName)
+		if !ok {
+			return errors.Errorf("branch %q is not managed by av", branchName)
+		}
+		res, err := editor.Launch(ctx, repo, editor.Config{
+			Text: templateutils.MustString(branchDescriptionTemplate, branchDescriptionTemplateData{
+				Branch:      branchName,
+				Description: branch.Description,
+			}),
+			TmpFilePattern: "branch-description-*.av.md",
+			CommentPrefix:  "%%",
+		})
+		if err != nil {
+			return errors.WrapIf(err, "text editor failed")
+		}
+
+		tx := db.WriteTx()
+		defer tx.Abort()
+		branch, _ = tx.Branch(branchName)
+		branch.Description = strings.TrimSpace(res)
+		tx.SetBranch(branch)
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		if branch.Description == "" {
+			fmt.Fprint(os.Stderr, "Removed the description of ", colors.UserInput(branchName), "\n")
+		} else {
+			fmt.Fprint(os.Stderr, "Updated the description of ", colors.UserInput(branchName), "\n")
+		}
+		return nil
+	},
+}
+
+type branchDescriptionTemplateData struct {
+	Branch      string
+	Description string
+}
+
+var branchDescriptionTemplate = template.Must(
+	template.New("branchDescription").
+		Parse(`%% Describe the branch '{{ .Branch }}'.
+%% Lines starting with '%%' will be ignored and an empty description removes
+%% the description of the branch.
+
+{{ .Description }}
+`),
+)
+
+func init() {
+	branchCmd.AddCommand(branchDescribeCmd)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/spf13/cobra"
+)
+
+var branchLabelFlags struct {
+	Remove     bool
+	NoChildren bool
+}
+
+var branchLabelCmd = &cobra.Command{
+	Use:   "label [<label>...]",
+	Short: "Add or remove labels of the current branch",
+	Long: strings.TrimSpace(`
+Add labels to the current branch, or show the labels of the current branch if no
+label is given.
+
+Labels group branches across stacks (e.g., feature work, migrations, and
+experiments). The --label flag of "av tree", "av sync", "av switch",
+"av restack", and "av pr --all" selects the branches that have the label.
+
+Labels carry down to the child branches: they are added to (or removed from)
+the descendants of the current branch as well unless --no-children is given,
+and new branches created with "av branch" inherit the labels of their parent.`),
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return err
+		}
+		db, err := getDB(ctx, repo)
+		if err != nil {
+			return err
+		}
+		branchName, err := repo.CurrentBranchName()
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 0 {
+			if branchLabelFlags.Remove {
+				return errors.New("no label is given to remove")
+			}
+			branch, ok := db.ReadTx().Branch(branchName)
+			if !ok {
+				return errors.Errorf("branch %q is not managed by av", branchName)
+			}
+			for _, label := range branch.Labels {
+				fmt.Fprintln(os.Stdout, label)
+			}
+			return nil
+		}
+		for _, label := range args {
+			if label == "" || strings.ContainsAny(label, " \t\n,") {
+				return errors.Errorf("invalid label %q: labels cannot be empty or contain spaces or commas", label)
+			}
+		}
+
+		tx := db.WriteTx()
+		defer tx.Abort()
+		if _, ok := tx.Branch(branchName); !ok {
+			return errors.Errorf("branch %q is not managed by av", branchName)
+		}
+		branchNames := []string{branchName}
+		if !branchLabelFlags.NoChildren {
+			branchNames = append(branchNames, meta.SubsequentBranches(tx, branchName)...)
+		}
+		for _, name := range branchNames {
+			br, _ := tx.Branch(name)
+			if branchLabelFlags.Remove {
+				br.Labels = slices.DeleteFunc(br.Labels, func(label string) bool {
+					return slices.Contains(args, label)
+				})
+			} else {
+				br.Labels = append(br.Labels, args...)
+				slices.Sort(br.Labels)
+				br.Labels = slices.Compact(br.Labels)
+			}
+			if len(br.Labels) == 0 {
+				br.Labels = nil
+			}
+			tx.SetBranch(br)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		verb := "Added"
+		if branchLabelFlags.Remove {
+			verb = "Removed"
+		}
+		fmt.Fprint(
+			os.Stderr,
+			verb, " ", colors.UserInput(strings.Join(args, ", ")),
+			" on ", colors.UserInput(strings.Join(branchNames, ", ")), "\n",
+		)
+		return nil
+	},
+}
+
+func init() {
+	branchLabelCmd.Flags().BoolVar(
+		&branchLabelFlags.Remove, "remove", false,
+		"remove the labels instead of adding them",
+	)
+	branchLabelCmd.Flags().BoolVar(
+		&branchLabelFlags.NoChildren, "no-children", false,
+		"don't carry the change down to the child branches",
+	)
+	branchCmd.AddCommand(branchLabelCmd)
+}
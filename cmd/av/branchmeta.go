@@ -3,9 +3,13 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
+	"os"
+	"slices"
 
 	"emperror.dev/errors"
 	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/jsonoutput"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/spf13/cobra"
 )
@@ -13,6 +17,7 @@ import (
 var branchMetaFlags struct {
 	trunk  bool
 	parent string
+	format string
 }
 
 var branchMetaCmd = &cobra.Command{
@@ -56,6 +61,11 @@ var branchMetaListCmd = &cobra.Command{
 	Short: "list all branch metadata",
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := cmd.Context()
+		if branchMetaFlags.format != "" {
+			if err := jsonoutput.ValidateFormat(branchMetaFlags.format, jsonoutput.FormatJSON); err != nil {
+				return err
+			}
+		}
 		repo, err := getRepo(ctx)
 		if err != nil {
 			return err
@@ -66,6 +76,18 @@ var branchMetaListCmd = &cobra.Command{
 		}
 		tx := db.ReadTx()
 		branches := tx.AllBranches()
+		if branchMetaFlags.format == jsonoutput.FormatJSON {
+			status, err := repo.Status(ctx)
+			if err != nil {
+				return err
+			}
+			builder := jsonoutput.NewBranchBuilder(ctx, repo, tx, status.CurrentBranch)
+			list := &jsonoutput.BranchList{SchemaVersion: jsonoutput.SchemaVersion, Branches: []*jsonoutput.Branch{}}
+			for _, name := range slices.Sorted(maps.Keys(branches)) {
+				list.Branches = append(list.Branches, builder.Branch(ctx, name))
+			}
+			return jsonoutput.Write(os.Stdout, list)
+		}
 		bs, err := json.MarshalIndent(branches, "", "    ")
 		if err != nil {
 			return err
@@ -122,6 +144,10 @@ var branchMetaSetCmd = &cobra.Command{
 }
 
 func init() {
+	branchMetaListCmd.Flags().StringVar(
+		&branchMetaFlags.format, "format", "",
+		"output format (json); see av-json(7) for the JSON schema\n(default: the raw metadata)",
+	)
 	branchMetaSetCmd.Flags().BoolVar(
 		&branchMetaFlags.trunk, "trunk", false,
 		"mark the parent branch as trunk",
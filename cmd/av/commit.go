@@ -266,7 +266,7 @@ func branchAndCommit(
 		return err
 	}
 
-	err = createBranch(ctx, repo, db, branchName, parentBranchName)
+	err = createBranch(ctx, repo, db, branchName, parentBranchName, "")
 	if err != nil {
 		return err
 	}
@@ -386,6 +386,7 @@ func init() {
 		BoolVarP(&commitAmendFlags.All, "all", "a", false, "automatically stage modified files (same as git commit --all)")
 
 	commitCmd.AddCommand(
+		commitMoveCmd,
 		deprecatedAmendCmd,
 		deprecatedCreateCmd,
 		deprecatedSplitCmd,
@@ -7,6 +7,7 @@ import (
 	tea "charm.land/bubbletea/v2"
 	"emperror.dev/errors"
 	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/git"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/sequencer"
@@ -22,9 +23,20 @@ func runPostCommitRestack(repo *git.Repo, db meta.DB) error {
 	return uiutils.RunBubbleTea(&postCommitRestackViewModel{repo: repo, db: db})
 }
 
+// runRestackOps runs the given restack operations with the same UI as
+// runPostCommitRestack. A conflict is saved as an "av restack" to continue.
+func runRestackOps(repo *git.Repo, db meta.DB, ops []sequencer.RestackOp) error {
+	return uiutils.RunBubbleTea(&postCommitRestackViewModel{repo: repo, db: db, ops: ops})
+}
+
 type postCommitRestackViewModel struct {
 	repo *git.Repo
 	db   meta.DB
+	// The operations to run. If nil, the descendants of the current branch
+	// are restacked.
+	ops []sequencer.RestackOp
+	// If true, the local changes are stashed while restacking (--autostash).
+	autostash bool
 
 	state        *sequencerui.RestackState
 	restackModel tea.Model
@@ -123,17 +135,24 @@ func (vm *postCommitRestackViewModel) createState() (*sequencerui.RestackState,
 	var state sequencerui.RestackState
 	state.InitialBranch = currentBranch
 	state.RelatedBranches = []string{currentBranch}
-	ops, err := planner.PlanForAmend(
-		vm.db.ReadTx(),
-		vm.repo,
-		plumbing.NewBranchReferenceName(currentBranch),
-	)
-	if err != nil {
-		return nil, err
+	ops := vm.ops
+	if ops == nil {
+		ops, err = planner.PlanForAmend(
+			vm.db.ReadTx(),
+			vm.repo,
+			plumbing.NewBranchReferenceName(currentBranch),
+		)
+		if err != nil {
+			return nil, err
+		}
 	}
 	if len(ops) == 0 {
 		return nil, nothingToRestackError
 	}
 	state.Seq = sequencer.NewSequencer(vm.repo.GetRemoteName(), vm.db, ops)
+	if vm.autostash {
+		state.Seq.Autostash = true
+		state.Seq.AutostashWorktrees = config.Av.Sync.AutostashWorktrees
+	}
 	return &state, nil
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/reorder"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var commitMoveFlags struct {
+	To string
+}
+
+var commitMoveCmd = &cobra.Command{
+	Use:   "move <commit>... --to <branch>",
+	Short: "Move commits to another branch in the stack",
+	Long: strings.TrimSpace(`
+Move commits to another branch in the stack.
+
+The commits are removed from their current branches and applied at the tip of
+the target branch, keeping their relative order. The branches in between are
+restacked.
+
+This is a shorthand for "av reorder" with a plan that moves the commits. If a
+commit cannot be applied cleanly, resolve the conflict and run
+"av reorder --continue" (or "av reorder --abort").`),
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return err
+		}
+		db, err := getDB(ctx, repo)
+		if err != nil {
+			return err
+		}
+
+		var continuation reorder.Continuation
+		if err := repo.ReadStateFile(git.StateFileKindReorder, &continuation); err == nil &&
+			continuation.State != nil && repo.IsCherryPickInProgress() {
+			return errors.New(
+				"a reorder is already in progress; run av reorder --continue or av reorder --abort first",
+			)
+		} else if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		status, err := repo.Status(ctx)
+		if err != nil {
+			return errors.Errorf("cannot get the status of the repository: %v", err)
+		}
+		if !status.IsCleanIgnoringUntracked() {
+			return errors.New(
+				"the working directory is not clean, please stash or commit the changes before moving commits",
+			)
+		}
+		currentBranch := status.CurrentBranch
+		if currentBranch == "" {
+			return errors.New("cannot move commits from a detached HEAD")
+		}
+
+		tx := db.ReadTx()
+		root, ok := meta.Root(tx, currentBranch)
+		if !ok {
+			return errors.Errorf("branch %q is not part of a stack", currentBranch)
+		}
+		stack, err := meta.StackBranches(tx, currentBranch)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(stack, commitMoveFlags.To) {
+			return errors.Errorf(
+				"branch %q is not in the stack of %q", commitMoveFlags.To, currentBranch,
+			)
+		}
+		var commits []string
+		for _, arg := range args {
+			commit, err := repo.RevParse(ctx, &git.RevParse{Rev: arg + "^{commit}"})
+			if err != nil {
+				return errors.Errorf("%q is not a commit", arg)
+			}
+			commits = append(commits, commit)
+		}
+
+		plan, err := reorder.CreateMovePlan(ctx, repo, tx, root, commits, commitMoveFlags.To)
+		if err != nil {
+			return err
+		}
+		logrus.WithFields(logrus.Fields{
+			"plan":           plan,
+			"current_branch": currentBranch,
+			"root_branch":    root,
+		}).Debug("created commit move plan")
+
+		newContinuation, err := reorder.Reorder(reorder.Context{
+			Repo:   repo,
+			DB:     db,
+			State:  &reorder.State{Commands: plan},
+			Output: os.Stderr,
+		})
+		if err != nil {
+			return err
+		}
+		if newContinuation != nil {
+			if err := repo.WriteStateFile(git.StateFileKindReorder, newContinuation); err != nil {
+				return err
+			}
+			fmt.Fprint(
+				os.Stderr,
+				colors.Warning("\nMoving the commits was interrupted by a conflict.\n"),
+				colors.Warning("Resolve the conflict and run "),
+				colors.CliCmd("av reorder --continue"),
+				colors.Warning(" to continue.\n"),
+			)
+			return actions.ErrExitSilently{ExitCode: 1}
+		}
+		if err := repo.WriteStateFile(git.StateFileKindReorder, nil); err != nil {
+			return err
+		}
+		if _, err := repo.CheckoutBranch(ctx, &git.CheckoutBranch{Name: currentBranch}); err != nil {
+			return err
+		}
+		fmt.Fprint(
+			os.Stderr,
+			colors.SuccessStyle.Render(fmt.Sprintf(
+				"✓ Moved %d commit(s) to %s", len(commits), commitMoveFlags.To,
+			)),
+			"\n",
+		)
+		return nil
+	},
+}
+
+func init() {
+	commitMoveCmd.Flags().StringVar(
+		&commitMoveFlags.To, "to", "",
+		"the branch to move the commits to",
+	)
+	_ = commitMoveCmd.MarkFlagRequired("to")
+	_ = commitMoveCmd.RegisterFlagCompletionFunc(
+		"to",
+		func(cmd *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
+			branches, _ := allBranches(cmd.Context())
+			return branches, cobra.ShellCompDirectiveNoSpace
+		},
+	)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/sequencer/planner"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/aviator-co/av/internal/utils/executils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var execFlags struct {
+	Parallel int
+	All      bool
+}
+
+var execCmd = &cobra.Command{
+	Use:   "exec [--parallel <n>] [--all] -- <command> [args...]",
+	Short: "Run a command on every branch of the stack in temporary worktrees",
+	Long: strings.TrimSpace(`
+Run a command on every branch of the current stack (or all stacks with --all).
+
+Each branch is checked out into a temporary worktree, and the command is run in
+the worktrees concurrently (up to --parallel commands at a time). The current
+working copy is not touched. The name of the branch is available to the command
+as the AV_EXEC_BRANCH environment variable.
+
+The output of each command is saved to a log file, and a pass/fail summary is
+printed when all the commands finish. The command exits with a non-zero status
+if the command failed on any branch.
+
+Use the "--" separator so that the flags of the command are not parsed as the
+flags of av exec.`),
+	Example: strings.TrimSpace(`
+  Run the tests on every branch of the stack:
+    $ av exec -- make test
+
+  Run the linter on every branch of all stacks, two at a time:
+    $ av exec --all --parallel 2 -- golangci-lint run`),
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return err
+		}
+		db, err := getDB(ctx, repo)
+		if err != nil {
+			return err
+		}
+		parallel := execFlags.Parallel
+		if parallel < 0 {
+			return errors.New("--parallel must not be negative")
+		} else if parallel == 0 {
+			parallel = runtime.NumCPU()
+		}
+		branches, err := execTargetBranches(ctx, repo, db.ReadTx(), execFlags.All)
+		if err != nil {
+			return err
+		}
+		if len(branches) == 0 {
+			return errors.New("there are no branches to run the command on")
+		}
+
+		runDir, err := os.MkdirTemp(repo.AvTmpDir(), "exec-*")
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(
+			os.Stderr,
+			"Running ", colors.CliCmd(executils.FormatCommandLine(args)),
+			" on ", colors.UserInput(len(branches)), " branches",
+			colors.Faint(fmt.Sprintf(" (%d at a time)", parallel)), "\n",
+		)
+		results := execOnBranches(ctx, repo, runDir, branches, args, parallel)
+
+		failed := printExecResults(results, runDir)
+		if failed > 0 {
+			fmt.Fprint(
+				os.Stderr,
+				colors.Failure(fmt.Sprintf("The command failed on %d of %d branches.", failed, len(results))),
+				"\n",
+			)
+			return actions.ErrExitSilently{ExitCode: 1}
+		}
+		fmt.Fprint(
+			os.Stderr,
+			colors.SuccessStyle.Render(fmt.Sprintf("✓ The command passed on all %d branches", len(results))),
+			"\n",
+		)
+		return nil
+	},
+}
+
+// execResult is the result of running the command on a branch.
+type execResult struct {
+	Branch   string
+	LogFile  string
+	Duration time.Duration
+	// True if the result was taken from the av test cache instead of running
+	// the command.
+	Cached bool
+	Err    error
+}
+
+// execExitError is the error returned when the command exits with a non-zero
+// status, as opposed to the errors that prevent the command from running.
+type execExitError struct {
+	ExitCode int
+}
+
+func (e execExitError) Error() string {
+	return fmt.Sprintf("exited with status %d", e.ExitCode)
+}
+
+// printExecResults prints the per-branch summary of the results and returns
+// the number of the failed branches.
+func printExecResults(results []execResult, runDir string) int {
+	failed := 0
+	for _, r := range results {
+		duration := colors.Faint(" (" + r.Duration.Round(100*time.Millisecond).String() + ")")
+		if r.Cached {
+			duration = colors.Faint(" (cached)")
+		}
+		if r.Err == nil {
+			fmt.Fprint(os.Stderr, colors.Success("  ✓ "), r.Branch, duration, "\n")
+			continue
+		}
+		failed++
+		fmt.Fprint(
+			os.Stderr,
+			colors.Failure("  ✗ "), r.Branch, duration, ": ", colors.Failure(r.Err.Error()), "\n",
+		)
+		if r.LogFile != "" {
+			fmt.Fprint(os.Stderr, colors.Faint("    log: "+r.LogFile), "\n")
+		}
+	}
+	if runDir != "" {
+		fmt.Fprint(os.Stderr, "\nThe logs are saved in ", colors.UserInput(filepath.Join(runDir, "logs")), "\n")
+	}
+	return failed
+}
+
+func execTargetBranches(ctx context.Context, repo *git.Repo, tx meta.ReadTx, all bool) ([]string, error) {
+	if all {
+		refs, err := planner.GetTargetBranches(ctx, tx, repo, true, planner.AllBranches)
+		if err != nil {
+			return nil, err
+		}
+		var branches []string
+		for _, ref := range refs {
+			branches = append(branches, ref.Short())
+		}
+		return branches, nil
+	}
+	currentBranch, err := repo.CurrentBranchName()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := tx.Branch(currentBranch); !ok {
+		return nil, errors.Errorf("branch %q is not adopted to av", currentBranch)
+	}
+	return meta.StackBranches(tx, currentBranch)
+}
+
+// execOnBranches runs the command on the branches in temporary worktrees under
+// runDir, up to parallel commands at a time. The worktrees are removed
+// afterwards, and the logs are kept in runDir/logs.
+func execOnBranches(
+	ctx context.Context,
+	repo *git.Repo,
+	runDir string,
+	branches []string,
+	args []string,
+	parallel int,
+) []execResult {
+	results := make([]execResult, len(branches))
+	sem := make(chan struct{}, parallel)
+	// git worktree add/remove update the shared worktree administrative files,
+	// so they are not run concurrently.
+	var worktreeMu sync.Mutex
+	var wg sync.WaitGroup
+	for i, branch := range branches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = execResult{Branch: branch}
+			start := time.Now()
+			results[i].LogFile, results[i].Err = execOnBranch(
+				ctx, repo, &worktreeMu, runDir, strconv.Itoa(i), branch, args,
+			)
+			results[i].Duration = time.Since(start)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func execOnBranch(
+	ctx context.Context,
+	repo *git.Repo,
+	worktreeMu *sync.Mutex,
+	runDir string,
+	id string,
+	branch string,
+	args []string,
+) (string, error) {
+	logFile := filepath.Join(runDir, "logs", branch+".log")
+	if err := os.MkdirAll(filepath.Dir(logFile), 0o755); err != nil {
+		return "", err
+	}
+	log, err := os.Create(logFile)
+	if err != nil {
+		return "", err
+	}
+	defer log.Close()
+
+	worktree := filepath.Join(runDir, "worktrees", id)
+	worktreeMu.Lock()
+	err = repo.WorktreeAdd(ctx, worktree, "refs/heads/"+branch)
+	worktreeMu.Unlock()
+	if err != nil {
+		return logFile, errors.WrapIf(err, "failed to create a worktree")
+	}
+	defer func() {
+		worktreeMu.Lock()
+		defer worktreeMu.Unlock()
+		if err := repo.WorktreeRemove(ctx, worktree); err != nil {
+			logrus.WithError(err).WithField("worktree", worktree).Warn("failed to remove the worktree")
+		}
+	}()
+
+	c := exec.CommandContext(ctx, args[0], args[1:]...)
+	c.Dir = worktree
+	c.Env = append(os.Environ(), "AV_EXEC_BRANCH="+branch)
+	c.Stdout = log
+	c.Stderr = log
+	if err := c.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return logFile, execExitError{ExitCode: exitErr.ExitCode()}
+		}
+		return logFile, err
+	}
+	return logFile, nil
+}
+
+func init() {
+	execCmd.Flags().IntVar(
+		&execFlags.Parallel, "parallel", 0,
+		"the maximum number of commands to run at a time (default: the number of CPUs)",
+	)
+	execCmd.Flags().BoolVar(
+		&execFlags.All, "all", false,
+		"run the command on the branches of all stacks",
+	)
+}
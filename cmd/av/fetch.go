@@ -5,8 +5,11 @@ import (
 	"os"
 
 	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/gh"
+	"github.com/aviator-co/av/internal/git/gitui"
 	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/meta/refmeta"
 	"github.com/aviator-co/av/internal/utils/cleanup"
 	"github.com/aviator-co/av/internal/utils/colors"
 	"github.com/fatih/color"
@@ -128,6 +131,19 @@ var fetchCmd = &cobra.Command{
 			"Updated ", color.GreenString("%d", updatedCount), " pull requests",
 			"\n",
 		)
+
+		if config.Av.Sync.ShareMetadata {
+			res, err := refmeta.Pull(ctx, repo, db)
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(os.Stderr, gitui.ShareMetadataResultView(res, false))
+			res, err = refmeta.Push(ctx, repo, db)
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(os.Stderr, gitui.ShareMetadataResultView(res, true))
+		}
 		return nil
 	},
 }
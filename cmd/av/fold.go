@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/sequencer"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var foldFlags struct {
+	NoClose bool
+}
+
+var foldCmd = &cobra.Command{
+	Use:   "fold",
+	Short: "Fold the current branch into its parent branch",
+	Long: strings.TrimSpace(`
+Fold the current branch into its parent branch.
+
+The commits of the current branch are moved onto the parent branch (the parent
+branch is fast-forwarded to the current branch), and the current branch is
+deleted. The children of the folded branch become the children of the parent
+branch, and the descendants of the parent branch are restacked.
+
+If the folded branch has an open pull request, it's closed with a comment that
+points to the pull request of the parent branch. Push the parent branch with
+"av sync" or "av pr" to update its pull request.
+
+The current branch must be up to date with its parent branch. Run "av restack"
+first if it isn't.`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return err
+		}
+		db, err := getDB(ctx, repo)
+		if err != nil {
+			return err
+		}
+		branchName, err := repo.CurrentBranchName()
+		if err != nil {
+			return errors.WrapIf(err, "failed to determine current branch")
+		}
+
+		folded, err := foldBranch(ctx, repo, db, branchName)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(
+			os.Stderr,
+			colors.SuccessStyle.Render("✓ Folded "+branchName+" into "+folded.Parent.Name), "\n",
+		)
+
+		if folded.PullRequest != nil && folded.PullRequest.State == githubv4.PullRequestStateOpen &&
+			!foldFlags.NoClose {
+			if err := closeFoldedPullRequest(ctx, db.ReadTx(), folded); err != nil {
+				fmt.Fprint(
+					os.Stderr,
+					colors.Warning("Failed to close pull request #", folded.PullRequest.Number, ": ", err),
+					"\n",
+				)
+			}
+		}
+
+		ops := foldRestackOps(db.ReadTx(), folded.Parent.Name)
+		if len(ops) == 0 {
+			return nil
+		}
+		return runRestackOps(repo, db, ops)
+	},
+}
+
+// foldRestackOps returns the restack operations for the descendants of the
+// parent branch, which include the children of the folded branch.
+func foldRestackOps(tx meta.ReadTx, parentName string) []sequencer.RestackOp {
+	var ops []sequencer.RestackOp
+	for _, name := range meta.SubsequentBranches(tx, parentName) {
+		avbr, _ := tx.Branch(name)
+		if avbr.MergeCommit != "" {
+			// Skip rebasing branches that have merge commits.
+			continue
+		}
+		ops = append(ops, sequencer.RestackOp{
+			Name:             plumbing.NewBranchReferenceName(name),
+			NewParent:        plumbing.NewBranchReferenceName(avbr.Parent.Name),
+			NewParentIsTrunk: avbr.Parent.Trunk,
+		})
+	}
+	return ops
+}
+
+// foldBranch moves the commits of the branch onto its parent branch, deletes
+// the branch, and makes its children the children of the parent branch. The
+// parent branch is checked out. Returns the metadata of the deleted branch.
+func foldBranch(ctx context.Context, repo *git.Repo, db meta.DB, branchName string) (meta.Branch, error) {
+	tx := db.WriteTx()
+	defer tx.Abort()
+	branch, ok := tx.Branch(branchName)
+	if !ok {
+		return meta.Branch{}, errors.New("current branch is not adopted to av")
+	}
+	parentName := branch.Parent.Name
+	if branch.Parent.Trunk {
+		return meta.Branch{}, errors.Errorf(
+			"cannot fold %q into the trunk branch %q; merge its pull request instead",
+			branchName, parentName,
+		)
+	}
+	if _, ok := tx.Branch(parentName); !ok {
+		return meta.Branch{}, errors.Errorf("parent branch %q is not adopted to av", parentName)
+	}
+
+	head, err := repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + branchName})
+	if err != nil {
+		return meta.Branch{}, err
+	}
+	parentHead, err := repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + parentName})
+	if err != nil {
+		return meta.Branch{}, errors.Errorf("parent branch %q does not exist", parentName)
+	}
+	if ok, err := repo.IsAncestor(ctx, parentHead, head); err != nil {
+		return meta.Branch{}, err
+	} else if !ok {
+		return meta.Branch{}, errors.Errorf(
+			"branch %q is not up to date with %q; run av restack first",
+			branchName, parentName,
+		)
+	}
+	worktrees, err := repo.WorktreeList(ctx)
+	if err != nil {
+		return meta.Branch{}, err
+	}
+	for _, wt := range worktrees {
+		if wt.Branch == parentName {
+			return meta.Branch{}, errors.Errorf(
+				"parent branch %q is checked out in the worktree at %s",
+				parentName, wt.Path,
+			)
+		}
+	}
+
+	// Fast-forward the parent branch first. This keeps the folded branch, so it
+	// can be undone if the metadata cannot be updated.
+	if err := repo.UpdateRef(ctx, &git.UpdateRef{
+		Ref: "refs/heads/" + parentName,
+		New: head,
+		Old: parentHead,
+	}); err != nil {
+		return meta.Branch{}, err
+	}
+
+	// The children keep their branching points: they were based on a commit
+	// of the folded branch, which is now a commit of the parent branch.
+	for _, child := range meta.Children(tx, branchName) {
+		child.Parent.Name = parentName
+		tx.SetBranch(child)
+	}
+	tx.DeleteBranch(branchName)
+	if err := tx.Commit(); err != nil {
+		if rerr := repo.UpdateRef(ctx, &git.UpdateRef{
+			Ref: "refs/heads/" + parentName,
+			New: parentHead,
+			Old: head,
+		}); rerr != nil {
+			logrus.WithError(rerr).Warnf("failed to reset %q to %s", parentName, parentHead)
+		}
+		return meta.Branch{}, err
+	}
+
+	// Switch to the parent branch and delete the folded branch only after the
+	// metadata is committed. The tree is the same, so the uncommitted changes
+	// (if any) are carried over.
+	if _, err := repo.CheckoutBranch(ctx, &git.CheckoutBranch{Name: parentName}); err != nil {
+		return meta.Branch{}, errors.WrapIff(
+			err, "folded %q into %q, but failed to check out %q", branchName, parentName, parentName,
+		)
+	}
+	if err := repo.BranchDelete(ctx, branchName); err != nil {
+		return meta.Branch{}, errors.WrapIff(
+			err, "folded %q into %q, but failed to delete %q", branchName, parentName, branchName,
+		)
+	}
+	return branch, nil
+}
+
+func closeFoldedPullRequest(ctx context.Context, tx meta.ReadTx, folded meta.Branch) error {
+	parent, _ := tx.Branch(folded.Parent.Name)
+	var comment string
+	if parent.PullRequest != nil {
+		comment = fmt.Sprintf(
+			"This pull request was folded into #%d (`%s`) with `av fold`.",
+			parent.PullRequest.Number, parent.Name,
+		)
+	} else {
+		comment = fmt.Sprintf("This pull request was folded into `%s` with `av fold`.", parent.Name)
+	}
+	return closePullRequestWithComment(ctx, folded.PullRequest, comment)
+}
+
+// closePullRequestWithComment adds the comment to the pull request and closes
+// it.
+func closePullRequestWithComment(ctx context.Context, pr *meta.PullRequest, comment string) error {
+	client, err := getGitHubClient(ctx)
+	if err != nil {
+		return err
+	}
+	if err := client.AddComment(ctx, pr.ID, comment); err != nil {
+		return err
+	}
+	if _, err := client.ClosePullRequest(ctx, pr.ID); err != nil {
+		return err
+	}
+	logrus.WithField("pr", pr.Number).Debug("closed the pull request")
+	fmt.Fprint(os.Stderr, "Closed pull request ", colors.UserInput("#", pr.Number), "\n")
+	return nil
+}
+
+func init() {
+	foldCmd.Flags().BoolVar(
+		&foldFlags.NoClose, "no-close", false,
+		"do not close the pull request of the folded branch",
+	)
+}
@@ -97,14 +97,18 @@ func init() {
 		"directory to use for git repository",
 	)
 	rootCmd.AddCommand(
+		absorbCmd,
 		adoptCmd,
 		authCmd,
 		branchCmd,
 		branchMetaCmd,
 		commitCmd,
 		validateDBCmd,
+		migrateDBCmd,
 		diffCmd,
+		execCmd,
 		fetchCmd,
+		foldCmd,
 		initCmd,
 		nextCmd,
 		orphanCmd,
@@ -112,14 +116,17 @@ func init() {
 		prevCmd,
 		reorderCmd,
 		reparentCmd,
+		splitCmd,
 		splitCommitCmd,
 		stackCmd,
 		switchCmd,
 		syncCmd,
 		syncExcludeCmd,
 		restackCmd,
+		testCmd,
 		tidyCmd,
 		treeCmd,
+		undoCmd,
 		versionCmd,
 		squashCmd,
 	)
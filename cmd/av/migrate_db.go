@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"charm.land/lipgloss/v2"
+	"github.com/aviator-co/av/internal/meta/jsonfiledb"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/spf13/cobra"
+)
+
+var migrateDBFlags struct {
+	DryRun bool
+}
+
+var migrateDBCmd = &cobra.Command{
+	Use:   "migrate-db",
+	Short: "Upgrade av metadata to the latest schema",
+	Long: `Upgrade av metadata to the latest schema version and report what changed.
+
+The metadata is also upgraded automatically the next time it's written, so this
+is only needed to upgrade it explicitly or to see what would change with
+--dry-run.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return err
+		}
+		report, err := jsonfiledb.Migrate(filepath.Join(repo.AvDir(), "av.db"), migrateDBFlags.DryRun)
+		if err != nil {
+			return err
+		}
+		_, _ = lipgloss.Print(renderMigrationReport(report, migrateDBFlags.DryRun))
+		return nil
+	},
+}
+
+func renderMigrationReport(report *jsonfiledb.MigrationReport, dryRun bool) string {
+	var ss []string
+	switch {
+	case len(report.Steps) == 0:
+		ss = append(ss, colors.SuccessStyle.Render(
+			fmt.Sprintf("✓ av metadata is up-to-date (schema version %d)", report.ToVersion),
+		))
+	case dryRun:
+		ss = append(ss, colors.Warning(fmt.Sprintf(
+			"! av metadata would be migrated from schema version %d to %d",
+			report.FromVersion, report.ToVersion,
+		)))
+	default:
+		ss = append(ss, colors.SuccessStyle.Render(fmt.Sprintf(
+			"✓ Migrated av metadata from schema version %d to %d",
+			report.FromVersion, report.ToVersion,
+		)))
+	}
+	for _, step := range report.Steps {
+		ss = append(ss, "")
+		ss = append(ss, fmt.Sprintf("  Version %d: %s", step.Version, step.Description))
+		if len(step.Changes) == 0 {
+			ss = append(ss, colors.Faint("  * no changes"))
+		}
+		for _, change := range step.Changes {
+			ss = append(ss, "  * "+change)
+		}
+	}
+	return lipgloss.NewStyle().MarginTop(1).MarginBottom(1).MarginLeft(2).Render(
+		lipgloss.JoinVertical(0, ss...),
+	) + "\n"
+}
+
+func init() {
+	migrateDBCmd.Flags().BoolVar(
+		&migrateDBFlags.DryRun, "dry-run", false,
+		"show what would change without modifying the metadata",
+	)
+}
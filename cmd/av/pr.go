@@ -33,6 +33,7 @@ var prFlags struct {
 	Queue     bool
 	All       bool
 	Current   bool
+	Label     string
 }
 
 var prCmd = &cobra.Command{
@@ -66,6 +67,9 @@ Examples:
 
   Create pull requests for every branch in the stack:
 	$ av pr --all
+
+  Create pull requests for every branch that has the label "feature-x":
+	$ av pr --all --label feature-x
 `),
 	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, _ []string) (reterr error) {
@@ -77,7 +81,8 @@ Examples:
 				prFlags.Title != "" ||
 				prFlags.Body != "" ||
 				prFlags.Edit ||
-				prFlags.Reviewers != nil {
+				prFlags.Reviewers != nil ||
+				prFlags.Label != "" {
 
 				return errors.New("cannot use other flags with --queue")
 			}
@@ -93,10 +98,16 @@ Examples:
 				prFlags.Reviewers != nil ||
 				prFlags.Queue {
 
-				return errors.New("can only use --current and --draft with --all")
+				return errors.New("can only use --current, --draft, and --label with --all")
+			}
+			if prFlags.Current && prFlags.Label != "" {
+				return errors.New("cannot use --current with --label")
 			}
 
-			return submitAll(ctx, prFlags.Current, prFlags.Draft)
+			return submitAll(ctx, prFlags.Current, prFlags.Draft, prFlags.Label)
+		}
+		if prFlags.Label != "" {
+			return errors.New("--label can only be used with --all")
 		}
 
 		repo, err := getRepo(ctx)
@@ -179,35 +190,24 @@ Examples:
 	},
 }
 
-func submitAll(ctx context.Context, current bool, draft bool) error {
-	repo, err := getRepo(ctx)
-	if err != nil {
-		return err
-	}
-
-	db, err := getDB(ctx, repo)
-	if err != nil {
-		return err
-	}
-	tx := db.WriteTx()
-	cu := cleanup.New(func() { tx.Abort() })
-	defer cu.Cleanup()
-
+// currentBranchesToSubmit returns the branches to submit with `av pr --all`
+// and the branches of the current stack.
+func currentBranchesToSubmit(repo *git.Repo, tx meta.ReadTx, current bool) ([]string, []string, error) {
 	currentBranch, err := repo.CurrentBranchName()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	currentStackBranches, err := meta.StackBranches(tx, currentBranch)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	var branchesToSubmit []string
 	if current {
 		previousBranches, err := meta.PreviousBranches(tx, currentBranch)
 		if err != nil {
-			return err
+			return nil, nil, err
 		}
 		branchesToSubmit = append(branchesToSubmit, previousBranches...)
 		branchesToSubmit = append(branchesToSubmit, currentBranch)
@@ -219,6 +219,81 @@ func submitAll(ctx context.Context, current bool, draft bool) error {
 		subsequentBranches := meta.SubsequentBranches(tx, currentBranch)
 		branchesToSubmit = append(branchesToSubmit, subsequentBranches...)
 	}
+	return branchesToSubmit, currentStackBranches, nil
+}
+
+// labeledBranchesToSubmit returns the branches to submit with
+// `av pr --all --label` and the branches of the stacks that they belong to.
+//
+// The previous branches of a labeled branch that don't have a pull request yet
+// are submitted as well (before the labeled branch), since the pull request of
+// the labeled branch needs a base branch with a pull request.
+func labeledBranchesToSubmit(tx meta.ReadTx, label string) ([]string, []string, error) {
+	labeledBranches := meta.LabeledBranches(tx, label)
+	if len(labeledBranches) == 0 {
+		return nil, nil, errors.Errorf("no branches have the label %q", label)
+	}
+	var branchesToSubmit []string
+	seen := map[string]bool{}
+	for _, branchName := range labeledBranches {
+		previousBranches, err := meta.PreviousBranches(tx, branchName)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, prev := range previousBranches {
+			if br, _ := tx.Branch(prev); seen[prev] || br.PullRequest != nil {
+				continue
+			}
+			seen[prev] = true
+			branchesToSubmit = append(branchesToSubmit, prev)
+		}
+		if !seen[branchName] {
+			seen[branchName] = true
+			branchesToSubmit = append(branchesToSubmit, branchName)
+		}
+	}
+	var stackBranches []string
+	seenRoots := map[string]bool{}
+	for _, branchName := range labeledBranches {
+		root, _ := meta.Root(tx, branchName)
+		if seenRoots[root] {
+			continue
+		}
+		seenRoots[root] = true
+		brs, err := meta.StackBranches(tx, branchName)
+		if err != nil {
+			return nil, nil, err
+		}
+		stackBranches = append(stackBranches, brs...)
+	}
+	return branchesToSubmit, stackBranches, nil
+}
+
+func submitAll(ctx context.Context, current bool, draft bool, label string) error {
+	repo, err := getRepo(ctx)
+	if err != nil {
+		return err
+	}
+
+	db, err := getDB(ctx, repo)
+	if err != nil {
+		return err
+	}
+	tx := db.WriteTx()
+	cu := cleanup.New(func() { tx.Abort() })
+	defer cu.Cleanup()
+
+	var branchesToSubmit, stackBranches []string
+	if label != "" {
+		// Labeled branches can span multiple stacks, so they don't depend on
+		// the current branch.
+		branchesToSubmit, stackBranches, err = labeledBranchesToSubmit(tx, label)
+	} else {
+		branchesToSubmit, stackBranches, err = currentBranchesToSubmit(repo, tx, current)
+	}
+	if err != nil {
+		return err
+	}
 
 	if err := runPRHook(ctx, repo, "all"); err != nil {
 		return err
@@ -272,7 +347,7 @@ func submitAll(ctx context.Context, current bool, draft bool) error {
 	}
 
 	if config.Av.PullRequest.WriteStack {
-		if err = actions.UpdatePullRequestsWithStack(ctx, client, tx, currentStackBranches); err != nil {
+		if err = actions.UpdatePullRequestsWithStack(ctx, client, tx, stackBranches); err != nil {
 			return err
 		}
 	}
@@ -421,6 +496,10 @@ func init() {
 		&prFlags.Current, "current", false,
 		"create pull requests up to the current branch",
 	)
+	prCmd.Flags().StringVar(
+		&prFlags.Label, "label", "",
+		"with --all, create pull requests for every branch that has the given label",
+	)
 	_ = prCmd.Flags().MarkHidden("current")
 
 	deprecatedCreateCmd := deprecateCommand(*prCmd, "av pr", "create")
@@ -5,10 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/aviator-co/av/internal/avgql"
 	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/gh"
+	"github.com/aviator-co/av/internal/jsonoutput"
 	"github.com/aviator-co/av/internal/utils/colors"
 	"github.com/aviator-co/av/internal/utils/timeutils"
 	"github.com/shurcooL/githubv4"
@@ -16,6 +18,10 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var prStatusFlags struct {
+	Format string
+}
+
 var prStatusCmd = &cobra.Command{
 	Use:          "status",
 	Short:        "Get the status of the associated pull request",
@@ -23,6 +29,11 @@ var prStatusCmd = &cobra.Command{
 	Args:         cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		ctx := cmd.Context()
+		if err := jsonoutput.ValidateFormat(
+			prStatusFlags.Format, jsonoutput.FormatText, jsonoutput.FormatJSON,
+		); err != nil {
+			return err
+		}
 
 		if config.Av.Aviator.APIToken != "" {
 			return prStatusAviator(ctx)
@@ -88,6 +99,45 @@ func prStatusAviator(ctx context.Context) error {
 	if pr.Number == 0 {
 		return errors.New("pull request not found")
 	}
+	if prStatusFlags.Format == jsonoutput.FormatJSON {
+		branchName, err := currentBranchNameForStatus(ctx)
+		if err != nil {
+			return err
+		}
+		doc := &jsonoutput.PullRequestStatus{
+			SchemaVersion: jsonoutput.SchemaVersion,
+			Branch:        branchName,
+			PullRequest: &jsonoutput.PullRequest{
+				Number:     int64(pr.Number),
+				Title:      string(pr.Title),
+				Author:     string(pr.Author.Login),
+				CreatedAt:  optionalTime(pr.CreatedAt.Time),
+				BaseBranch: string(pr.BaseBranchName),
+				HeadBranch: string(pr.HeadBranchName),
+			},
+			Queue: &jsonoutput.QueueStatus{
+				Status:               string(pr.Status),
+				StatusReason:         string(pr.StatusReason),
+				QueuedAt:             optionalTime(pr.QueuedAt.Time),
+				MergedAt:             optionalTime(pr.MergedAt.Time),
+				RequiredChecks:       []jsonoutput.RequiredCheck{},
+				BotPullRequestNumber: int64(pr.BotPullRequest.Number),
+			},
+		}
+		for _, st := range pr.RequiredCheckStatuses {
+			doc.Queue.RequiredChecks = append(doc.Queue.RequiredChecks, jsonoutput.RequiredCheck{
+				Name:   string(st.RequiredCheck.Pattern),
+				Result: string(st.Result),
+			})
+		}
+		for _, st := range pr.BotPullRequest.RequiredCheckStatuses {
+			doc.Queue.BotRequiredChecks = append(doc.Queue.BotRequiredChecks, jsonoutput.RequiredCheck{
+				Name:   string(st.RequiredCheck.Pattern),
+				Result: string(st.Result),
+			})
+		}
+		return jsonoutput.Write(os.Stdout, doc)
+	}
 
 	// Print PR info
 	indent := "    "
@@ -247,6 +297,24 @@ func prStatusGitHub(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	if prStatusFlags.Format == jsonoutput.FormatJSON {
+		return jsonoutput.Write(os.Stdout, &jsonoutput.PullRequestStatus{
+			SchemaVersion: jsonoutput.SchemaVersion,
+			Branch:        currentBranchName,
+			PullRequest: &jsonoutput.PullRequest{
+				Number:     pr.Number,
+				ID:         pr.ID,
+				State:      string(pr.State),
+				URL:        pr.Permalink,
+				Title:      pr.Title,
+				IsDraft:    pr.IsDraft,
+				Author:     pr.Author.Login,
+				CreatedAt:  optionalTime(pr.CreatedAt),
+				BaseBranch: pr.BaseBranchName(),
+				HeadBranch: pr.HeadBranchName(),
+			},
+		})
+	}
 
 	indent := "    "
 	fmt.Fprint(
@@ -339,6 +407,23 @@ func getQueryVariables(ctx context.Context) (map[string]any, error) {
 	return variables, nil
 }
 
+func currentBranchNameForStatus(ctx context.Context) (string, error) {
+	repo, err := getRepo(ctx)
+	if err != nil {
+		return "", err
+	}
+	return repo.CurrentBranchName()
+}
+
+// optionalTime returns nil for the zero time so that unset timestamps are
+// omitted from the JSON output.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
 func emojiForRequiredCheckResult(result string) string {
 	switch result {
 	case "SUCCESS":
@@ -349,3 +434,10 @@ func emojiForRequiredCheckResult(result string) string {
 		return "\u231B"
 	}
 }
+
+func init() {
+	prStatusCmd.Flags().StringVar(
+		&prStatusFlags.Format, "format", jsonoutput.FormatText,
+		"output format (text|json); see av-json(7) for the JSON schema",
+	)
+}
@@ -9,6 +9,7 @@ import (
 
 	"emperror.dev/errors"
 	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/git"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/reorder"
@@ -18,8 +19,9 @@ import (
 )
 
 var reorderFlags struct {
-	Continue bool
-	Abort    bool
+	Continue  bool
+	Abort     bool
+	Autostash bool
 }
 
 var reorderCmd = &cobra.Command{
@@ -45,6 +47,9 @@ squashed, dropped, or moved within the stack.
 		if err != nil {
 			return err
 		}
+		if !cmd.Flags().Changed("autostash") {
+			reorderFlags.Autostash = config.Av.Sync.Autostash
+		}
 
 		var continuation reorder.Continuation
 		if err := repo.ReadStateFile(git.StateFileKindReorder, &continuation); os.IsNotExist(err) {
@@ -66,6 +71,9 @@ squashed, dropped, or moved within the stack.
 			if err := repo.WriteStateFile(git.StateFileKindReorder, nil); err != nil {
 				return err
 			}
+			if err := restoreAutostash(ctx, repo, continuation.Stash); err != nil {
+				return err
+			}
 			continuation = reorder.Continuation{}
 			if reorderFlags.Continue || reorderFlags.Abort {
 				fmt.Fprint(
@@ -77,6 +85,7 @@ squashed, dropped, or moved within the stack.
 		}
 
 		var state *reorder.State
+		stash := continuation.Stash
 		if reorderFlags.Abort {
 			if continuation.State == nil {
 				_ = repo.WriteStateFile(git.StateFileKindReorder, nil)
@@ -89,10 +98,12 @@ squashed, dropped, or moved within the stack.
 				}
 			}
 			// TODO: --abort should probably reset the state of each branch
-			//   associated with the reorder to the original. It might be worth
-			//   storing some history and allow the user to do --undo to restore
-			//   their Git state to the state before the reorder.
-			return repo.WriteStateFile(git.StateFileKindReorder, nil)
+			//   associated with the reorder to the original. Until then, the
+			//   branches can be restored with `av undo`.
+			if err := repo.WriteStateFile(git.StateFileKindReorder, nil); err != nil {
+				return err
+			}
+			return restoreAutostash(ctx, repo, continuation.Stash)
 		} else if reorderFlags.Continue {
 			state = continuation.State
 
@@ -214,6 +225,12 @@ squashed, dropped, or moved within the stack.
 				"root_branch":    root,
 			}).Debug("created reorder plan")
 			state = &reorder.State{Commands: plan}
+			if reorderFlags.Autostash {
+				stash, err = autostash(ctx, repo, false)
+				if err != nil {
+					return err
+				}
+			}
 		}
 
 		newContinuation, err := reorder.Reorder(reorder.Context{
@@ -223,6 +240,9 @@ squashed, dropped, or moved within the stack.
 			Output: os.Stderr,
 		})
 		if err != nil {
+			if restoreErr := restoreAutostash(ctx, repo, stash); restoreErr != nil {
+				logrus.WithError(restoreErr).Warn("failed to restore the stashed changes")
+			}
 			return err
 		}
 		if newContinuation == nil {
@@ -233,10 +253,11 @@ squashed, dropped, or moved within the stack.
 				os.Stderr,
 				colors.Success("\nThe stack was reordered successfully.\n"),
 			)
-			return nil
+			return restoreAutostash(ctx, repo, stash)
 		}
 
 		continuation = *newContinuation
+		continuation.Stash = stash
 		if err := repo.WriteStateFile(git.StateFileKindReorder, &continuation); err != nil {
 			return err
 		}
@@ -247,6 +268,12 @@ squashed, dropped, or moved within the stack.
 			colors.CliCmd("av reorder --continue"),
 			colors.Warning(" to continue.\n"),
 		)
+		if stash != "" {
+			fmt.Fprint(
+				os.Stderr,
+				"Your local changes are stashed and will be restored when the reorder finishes or is aborted.\n",
+			)
+		}
 		return actions.ErrExitSilently{ExitCode: 1}
 	},
 }
@@ -256,6 +283,9 @@ func init() {
 		BoolVar(&reorderFlags.Continue, "continue", false, "continue an in-progress reorder")
 	reorderCmd.Flags().
 		BoolVar(&reorderFlags.Abort, "abort", false, "abort an in-progress reorder")
+	reorderCmd.Flags().
+		BoolVar(&reorderFlags.Autostash, "autostash", false,
+			"stash the local changes before reordering and restore them afterward\n(default: sync.autostash config)")
 	reorderCmd.MarkFlagsMutuallyExclusive("continue", "abort")
 }
 
@@ -8,6 +8,7 @@ import (
 	"charm.land/lipgloss/v2"
 	"emperror.dev/errors"
 	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/git"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/sequencer"
@@ -19,7 +20,8 @@ import (
 )
 
 var reparentFlags struct {
-	Parent string
+	Parent    string
+	Autostash bool
 }
 
 var reparentCmd = &cobra.Command{
@@ -53,6 +55,9 @@ var reparentCmd = &cobra.Command{
 		if reparentFlags.Parent == "HEAD" {
 			reparentFlags.Parent = repo.DefaultBranch()
 		}
+		if !cmd.Flags().Changed("autostash") {
+			reparentFlags.Autostash = config.Av.Sync.Autostash
+		}
 
 		return uiutils.RunBubbleTea(&reparentViewModel{repo: repo, db: db})
 	},
@@ -181,6 +186,10 @@ func (vm *reparentViewModel) createState() (*sequencerui.RestackState, error) {
 		return nil, nothingToRestackError
 	}
 	state.Seq = sequencer.NewSequencer(vm.repo.GetRemoteName(), vm.db, ops)
+	if reparentFlags.Autostash {
+		state.Seq.Autostash = true
+		state.Seq.AutostashWorktrees = config.Av.Sync.AutostashWorktrees
+	}
 	return &state, nil
 }
 
@@ -202,6 +211,10 @@ func init() {
 		&reparentFlags.Parent, "parent", "",
 		"parent branch to rebase onto",
 	)
+	reparentCmd.Flags().BoolVar(
+		&reparentFlags.Autostash, "autostash", false,
+		"stash the local changes before rebasing and restore them afterward\n(default: sync.autostash config)",
+	)
 
 	_ = reparentCmd.RegisterFlagCompletionFunc(
 		"parent",
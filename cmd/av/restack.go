@@ -9,23 +9,28 @@ import (
 	"charm.land/lipgloss/v2"
 	"emperror.dev/errors"
 	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/jsonoutput"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/sequencer"
 	"github.com/aviator-co/av/internal/sequencer/planner"
 	"github.com/aviator-co/av/internal/sequencer/sequencerui"
 	"github.com/aviator-co/av/internal/utils/uiutils"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
 var restackFlags struct {
-	All      bool
-	Current  bool
-	Abort    bool
-	Continue bool
-	Skip     bool
-	DryRun   bool
+	All       bool
+	Current   bool
+	Abort     bool
+	Continue  bool
+	Skip      bool
+	DryRun    bool
+	Label     string
+	Autostash bool
 }
 
 var restackCmd = &cobra.Command{
@@ -42,6 +47,12 @@ var restackCmd = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		if restackFlags.DryRun {
+			return restackDryRun(ctx, repo, db)
+		}
+		if !cmd.Flags().Changed("autostash") {
+			restackFlags.Autostash = config.Av.Sync.Autostash
+		}
 		return uiutils.RunBubbleTea(&restackViewModel{repo: repo, db: db})
 	},
 }
@@ -156,22 +167,73 @@ func (vm *restackViewModel) ExitError() error {
 }
 
 func (vm *restackViewModel) readState() (*sequencerui.RestackState, error) {
+	ctx := context.Background()
 	var state sequencerui.RestackState
 	if err := vm.repo.ReadStateFile(git.StateFileKindRestack, &state); err != nil &&
 		os.IsNotExist(err) {
-		return nil, nil
+		home, err := findStateInOtherWorktree(ctx, vm.repo, func(wtRepo *git.Repo) *sequencer.Sequencer {
+			var state sequencerui.RestackState
+			if err := wtRepo.ReadStateFile(git.StateFileKindRestack, &state); err != nil {
+				return nil
+			}
+			return state.Seq
+		})
+		if err != nil || home == nil {
+			return nil, err
+		}
+		// Continue the restack as if it's run in the worktree where it started.
+		vm.repo = home
+		return vm.readState()
 	} else if err != nil {
 		return nil, err
 	}
-	if !vm.repo.IsRebaseInProgress() {
+	if state.Seq == nil || !state.Seq.IsInterrupted(ctx, vm.repo) {
 		if err := vm.repo.WriteStateFile(git.StateFileKindRestack, nil); err != nil {
 			return nil, err
 		}
+		if state.Seq != nil {
+			// The rebase was concluded outside of av. Restore the changes
+			// stashed by --autostash anyway.
+			for _, msg := range state.Seq.RestoreStashes(ctx) {
+				logrus.Warn(msg)
+			}
+		}
 		return nil, nil
 	}
 	return &state, nil
 }
 
+// findStateInOtherWorktree finds the state file of the restack that is stopped
+// in the current worktree but was started in another worktree (see
+// sync.restackInWorktrees). readSeq reads the sequencer from the state file of
+// a worktree. Returns the repo of the worktree where the restack was started,
+// or nil if there is no such restack.
+func findStateInOtherWorktree(
+	ctx context.Context,
+	repo *git.Repo,
+	readSeq func(*git.Repo) *sequencer.Sequencer,
+) (*git.Repo, error) {
+	worktrees, err := repo.WorktreeList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, wt := range worktrees {
+		if wt.Path == repo.Dir() {
+			continue
+		}
+		wtRepo, err := repo.OpenWorktree(ctx, wt.Path)
+		if err != nil {
+			// The worktree may have been removed without `git worktree remove`.
+			logrus.WithError(err).Debug("cannot open the worktree")
+			continue
+		}
+		if seq := readSeq(wtRepo); seq != nil && seq.InterruptedWorktree == repo.Dir() {
+			return wtRepo, nil
+		}
+	}
+	return nil, nil
+}
+
 func (vm *restackViewModel) writeState(state *sequencerui.RestackState) error {
 	if state == nil {
 		return vm.repo.WriteStateFile(git.StateFileKindRestack, nil)
@@ -190,7 +252,12 @@ func (vm *restackViewModel) createState() (*sequencerui.RestackState, error) {
 	currentBranch := status.CurrentBranch
 	state.InitialBranch = currentBranch
 
-	if restackFlags.All {
+	if restackFlags.Label != "" {
+		state.RelatedBranches = meta.LabeledBranches(vm.db.ReadTx(), restackFlags.Label)
+		if len(state.RelatedBranches) == 0 {
+			return nil, errors.Errorf("no branches have the label %q", restackFlags.Label)
+		}
+	} else if restackFlags.All {
 		state.RestackingAll = true
 	} else {
 		if currentBranch == "" {
@@ -214,14 +281,53 @@ func (vm *restackViewModel) createState() (*sequencerui.RestackState, error) {
 		currentBranchRef,
 		restackFlags.All,
 		restackFlags.Current,
+		restackFlags.Label,
 	)
 	if err != nil {
 		return nil, err
 	}
 	state.Seq = sequencer.NewSequencer(vm.repo.GetRemoteName(), vm.db, ops)
+	if restackFlags.Autostash {
+		state.Seq.Autostash = true
+		state.Seq.AutostashWorktrees = config.Av.Sync.AutostashWorktrees
+	}
 	return &state, nil
 }
 
+func restackDryRun(ctx context.Context, repo *git.Repo, db meta.DB) error {
+	status, err := repo.Status(ctx)
+	if err != nil {
+		return err
+	}
+	currentBranch := status.CurrentBranch
+	tx := db.ReadTx()
+	if !restackFlags.All && restackFlags.Label == "" {
+		if currentBranch == "" {
+			return errors.New("not on any branch (detached HEAD state); please checkout a branch first")
+		}
+		if _, exist := tx.Branch(currentBranch); !exist {
+			return errors.New("current branch is not adopted to av")
+		}
+	}
+	var currentBranchRef plumbing.ReferenceName
+	if currentBranch != "" {
+		currentBranchRef = plumbing.NewBranchReferenceName(currentBranch)
+	}
+	ops, err := planner.PlanForRestack(
+		ctx,
+		tx,
+		repo,
+		currentBranchRef,
+		restackFlags.All,
+		restackFlags.Current,
+		restackFlags.Label,
+	)
+	if err != nil {
+		return err
+	}
+	return printRestackPlan(ctx, repo, db, ops, jsonoutput.FormatText)
+}
+
 func init() {
 	restackCmd.Flags().BoolVar(
 		&restackFlags.All, "all", false,
@@ -245,8 +351,20 @@ func init() {
 	)
 	restackCmd.Flags().BoolVar(
 		&restackFlags.DryRun, "dry-run", false,
-		"show the list of branches that will be rebased without actually rebasing them",
+		"show the branches that will be rebased and the predicted conflicts\nwithout actually rebasing them",
+	)
+	restackCmd.Flags().BoolVar(
+		&restackFlags.Autostash, "autostash", false,
+		"stash the local changes before rebasing and restore them afterward\n(default: sync.autostash config)",
 	)
 
+	restackCmd.Flags().StringVar(
+		&restackFlags.Label, "label", "",
+		"rebase the branches that have the given label",
+	)
 	restackCmd.MarkFlagsMutuallyExclusive("continue", "abort", "skip")
+	restackCmd.MarkFlagsMutuallyExclusive("dry-run", "continue")
+	restackCmd.MarkFlagsMutuallyExclusive("dry-run", "abort")
+	restackCmd.MarkFlagsMutuallyExclusive("dry-run", "skip")
+	restackCmd.MarkFlagsMutuallyExclusive("label", "all", "current")
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aviator-co/av/internal/config"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/jsonoutput"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/sequencer"
+	"github.com/aviator-co/av/internal/utils/colors"
+)
+
+// printRestackPlan prints the planned restack operations for --dry-run, with
+// the conflicts predicted by simulating the operations with git merge-tree.
+func printRestackPlan(
+	ctx context.Context,
+	repo *git.Repo,
+	db meta.DB,
+	ops []sequencer.RestackOp,
+	format string,
+) error {
+	sims, err := sequencer.Simulate(ctx, repo, db, ops)
+	if err != nil {
+		return err
+	}
+	operations := jsonoutput.RestackOperations(ctx, repo, db.ReadTx(), ops, sims)
+	if format == jsonoutput.FormatJSON {
+		return jsonoutput.Write(os.Stdout, &jsonoutput.SyncPlan{
+			SchemaVersion: jsonoutput.SchemaVersion,
+			Operations:    operations,
+		})
+	}
+
+	unknownReason := "the branch has merge commits"
+	if !repo.SupportsMergeTreeWriteTree(ctx) {
+		unknownReason = "git 2.38 or later is required"
+	}
+	var n, conflicts int
+	for _, op := range operations {
+		if !op.NeedsRestack {
+			fmt.Fprint(
+				os.Stdout,
+				colors.Faint("  - "+op.Branch+" is up to date with "+op.NewParent), "\n",
+			)
+			continue
+		}
+		n++
+		verb := "rebase onto"
+		if op.ParentChanged {
+			verb = "reparent onto"
+		} else if config.Av.Sync.UseMerge() {
+			verb = "merge"
+		}
+		var prediction string
+		switch op.Prediction {
+		case jsonoutput.PredictionClean:
+			prediction = colors.Success("applies cleanly")
+		case jsonoutput.PredictionConflict:
+			conflicts++
+			prediction = colors.Failure(fmt.Sprintf("%d commit(s) conflict", len(op.Conflicts)))
+		default:
+			prediction = colors.Warning("cannot predict conflicts (" + unknownReason + ")")
+		}
+		if op.AfterConflict {
+			prediction += colors.Faint(" (assuming the conflicts above are resolved)")
+		}
+		fmt.Fprint(
+			os.Stdout,
+			"  - ", colors.UserInput(op.Branch), ": ", verb, " ", colors.UserInput(op.NewParent),
+			": ", prediction, "\n",
+		)
+		for _, c := range op.Conflicts {
+			fmt.Fprint(
+				os.Stdout,
+				"      ", colors.Faint(git.ShortSha(c.Commit)), " ", c.Subject, "\n",
+				"        ", colors.Failure("conflicts in "+strings.Join(c.Files, ", ")), "\n",
+			)
+		}
+	}
+	if n == 0 {
+		fmt.Fprint(os.Stdout, colors.SuccessStyle.Render("✓ Nothing to restack"), "\n")
+		return nil
+	}
+	updated := "rebased"
+	if config.Av.Sync.UseMerge() {
+		updated = "updated"
+	}
+	fmt.Fprint(os.Stdout, "\n", n, " branch(es) would be ", updated)
+	if conflicts > 0 {
+		fmt.Fprint(os.Stdout, ", ", conflicts, " with conflicts")
+	}
+	fmt.Fprint(os.Stdout, ". No changes were made (dry run).\n")
+	return nil
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/spf13/cobra"
+)
+
+var splitFlags struct {
+	ByPath []string
+	Name   []string
+}
+
+var splitCmd = &cobra.Command{
+	Use:   "split --by-path <glob> [--by-path <glob>...]",
+	Short: "Split the current branch into stacked branches",
+	Long: strings.TrimSpace(`
+Split the current branch into stacked branches by the paths of the changed files.
+
+The changes of the current branch (the cumulative diff against its parent
+branch) are sliced into a chain of new branches, one per --by-path glob in the
+given order. Each new branch has a single commit with the changes to the files
+that match its glob and not any of the previous globs. The current branch is
+left at the tip of the chain with the remaining changes, so that its tree does
+not change: its commits are replayed with only the changes to the remaining
+files. At least one changed file must be left for the current branch.
+
+The globs are matched against the paths from the top of the repository, and
+"**" matches any number of directories (e.g., "infra/**").
+
+The new branches are named <branch>-1, <branch>-2, ... unless --name is given.`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return err
+		}
+		db, err := getDB(ctx, repo)
+		if err != nil {
+			return err
+		}
+		branchName, err := repo.CurrentBranchName()
+		if err != nil {
+			return errors.WrapIf(err, "failed to determine current branch")
+		}
+		if len(splitFlags.Name) > len(splitFlags.ByPath) {
+			return errors.New("--name is given more times than --by-path")
+		}
+
+		parts, err := splitBranchByPath(ctx, repo, db, branchName, splitFlags.ByPath, splitFlags.Name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(
+			os.Stderr,
+			colors.SuccessStyle.Render("✓ Split "+branchName+" into "+fmt.Sprint(len(parts))+" branches"),
+			"\n",
+		)
+		for _, part := range parts {
+			fmt.Fprint(
+				os.Stderr,
+				"  - ", colors.UserInput(part.Name), ": ", part.Description,
+				colors.Faint(fmt.Sprintf(" (%d files)", len(part.Files))), "\n",
+			)
+		}
+
+		// The tree of the current branch didn't change, but the commits did.
+		return runPostCommitRestack(repo, db)
+	},
+}
+
+// splitPart is a branch created by splitBranchByPath.
+type splitPart struct {
+	Name        string
+	Description string
+	Files       []string
+}
+
+// splitBranchByPath slices the changes of the branch into a chain of new
+// branches, one per glob. The branch is moved to the tip of the chain with the
+// remaining changes. The branches are created with plumbing commands, so the
+// working tree and the index are not touched.
+func splitBranchByPath(
+	ctx context.Context,
+	repo *git.Repo,
+	db meta.DB,
+	branchName string,
+	globs []string,
+	names []string,
+) ([]splitPart, error) {
+	tx := db.WriteTx()
+	defer tx.Abort()
+	branch, ok := tx.Branch(branchName)
+	if !ok {
+		return nil, errors.New("current branch is not adopted to av")
+	}
+	head, err := repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + branchName})
+	if err != nil {
+		return nil, err
+	}
+	base, err := splitBase(ctx, repo, branch, head)
+	if err != nil {
+		return nil, err
+	}
+
+	var parts []splitPart
+	assigned := map[string]bool{}
+	for i, glob := range globs {
+		files, err := splitChangedFiles(ctx, repo, base, head, ":(glob)"+glob)
+		if err != nil {
+			return nil, err
+		}
+		files = slices.DeleteFunc(files, func(f string) bool { return assigned[f] })
+		if len(files) == 0 {
+			return nil, errors.Errorf("no changes of %q match %q", branchName, glob)
+		}
+		for _, f := range files {
+			assigned[f] = true
+		}
+		name := fmt.Sprintf("%s-%d", branchName, i+1)
+		if i < len(names) {
+			name = applyBranchNamePrefix(names[i])
+		}
+		if _, exists := tx.Branch(name); exists {
+			return nil, errors.Errorf("branch %q is already adopted to av", name)
+		}
+		if exists, err := repo.DoesBranchExist(ctx, name); err != nil {
+			return nil, err
+		} else if exists {
+			return nil, errors.Errorf("branch %q already exists", name)
+		}
+		parts = append(parts, splitPart{Name: name, Description: glob, Files: files})
+	}
+	allFiles, err := splitChangedFiles(ctx, repo, base, head)
+	if err != nil {
+		return nil, err
+	}
+	var remaining []string
+	for _, f := range allFiles {
+		if !assigned[f] {
+			remaining = append(remaining, f)
+		}
+	}
+	if len(remaining) == 0 {
+		// The branch would be left without any changes.
+		return nil, errors.Errorf(
+			"all changes of %q match the globs; leave some files for %q (e.g., drop the last --by-path)",
+			branchName, branchName,
+		)
+	}
+
+	// Build the commits on a temporary index that starts from the base tree.
+	tmpDir, err := os.MkdirTemp(repo.AvTmpDir(), "split-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmpDir, "index")}
+	if _, err := repo.Run(ctx, &git.RunOpts{
+		Args:      []string{"read-tree", base},
+		Env:       env,
+		ExitError: true,
+	}); err != nil {
+		return nil, err
+	}
+
+	if !branch.Parent.Trunk {
+		branch.Parent.BranchingPointCommitHash = base
+	}
+	var updates []*git.UpdateRef
+	parent := base
+	for _, part := range parts {
+		if err := splitUpdateIndex(ctx, repo, env, head, part.Files); err != nil {
+			return nil, err
+		}
+		tree, err := repo.Run(ctx, &git.RunOpts{
+			Args:      []string{"write-tree"},
+			Env:       env,
+			ExitError: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		commit, err := repo.CommitTree(ctx, &git.CommitTree{
+			Tree:    strings.TrimSpace(string(tree.Stdout)),
+			Parents: []string{parent},
+			Message: fmt.Sprintf("Split %s from %s\n", part.Description, branchName),
+		})
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, &git.UpdateRef{
+			Ref: "refs/heads/" + part.Name,
+			New: commit,
+			Old: git.ZeroOID(head),
+		})
+		tx.SetBranch(meta.Branch{
+			Name:   part.Name,
+			Parent: branch.Parent,
+			Labels: slices.Clone(branch.Labels),
+		})
+		branch.Parent = meta.BranchState{
+			Name:                     part.Name,
+			BranchingPointCommitHash: commit,
+		}
+		parent = commit
+	}
+
+	newHead, err := splitReplayRemaining(ctx, repo, env, base, head, parent, remaining)
+	if err != nil {
+		return nil, err
+	}
+	parts = append(parts, splitPart{Name: branchName, Description: "remaining changes", Files: remaining})
+	updates = append(updates, &git.UpdateRef{
+		Ref: "refs/heads/" + branchName,
+		New: newHead,
+		Old: head,
+	})
+
+	if err := repo.UpdateRefs(ctx, updates); err != nil {
+		return nil, err
+	}
+	tx.SetBranch(branch)
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
+
+// splitReplayRemaining replays the commits of the branch onto parent, keeping
+// only the changes to the remaining files. The commits that don't change any of
+// the remaining files are dropped. The index of env must have the tree of
+// parent. Returns the new head of the branch.
+func splitReplayRemaining(
+	ctx context.Context,
+	repo *git.Repo,
+	env []string,
+	base, head, parent string,
+	remaining []string,
+) (string, error) {
+	isRemaining := map[string]bool{}
+	for _, f := range remaining {
+		isRemaining[f] = true
+	}
+	hashes, err := repo.RevList(ctx, git.RevListOpts{
+		Specifiers: []string{head, "^" + base},
+		Reverse:    true,
+	})
+	if err != nil {
+		return "", err
+	}
+	objects, err := repo.GetRefs(ctx, &git.GetRefs{Revisions: hashes})
+	if err != nil {
+		return "", err
+	}
+	for _, obj := range objects {
+		commit, err := git.ParseCommitContents(obj.Contents)
+		if err != nil {
+			return "", errors.WrapIff(err, "parsing commit %s", obj.OID)
+		}
+		if len(commit.Parents) == 0 {
+			continue
+		}
+		// Compare with the first parent so that the changes brought in by a
+		// merge are attributed to the merge commit.
+		files, err := splitChangedFiles(ctx, repo, commit.Parents[0], obj.OID)
+		if err != nil {
+			return "", err
+		}
+		files = slices.DeleteFunc(files, func(f string) bool { return !isRemaining[f] })
+		if len(files) == 0 {
+			continue
+		}
+		if err := splitUpdateIndex(ctx, repo, env, obj.OID, files); err != nil {
+			return "", err
+		}
+		tree, err := repo.Run(ctx, &git.RunOpts{
+			Args:      []string{"write-tree"},
+			Env:       env,
+			ExitError: true,
+		})
+		if err != nil {
+			return "", err
+		}
+		parent, err = repo.CommitTree(ctx, &git.CommitTree{
+			Tree:    strings.TrimSpace(string(tree.Stdout)),
+			Parents: []string{parent},
+			Message: commit.Message,
+			Author:  commit.Author,
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	return parent, nil
+}
+
+// splitBase returns the commit that the changes of the branch are based on.
+func splitBase(ctx context.Context, repo *git.Repo, branch meta.Branch, head string) (string, error) {
+	if bp := branch.Parent.BranchingPointCommitHash; bp != "" {
+		if ok, err := repo.IsAncestor(ctx, bp, head); err == nil && ok {
+			return bp, nil
+		}
+	}
+	parentRef := "refs/heads/" + branch.Parent.Name
+	if branch.Parent.Trunk {
+		parentRef = "refs/remotes/" + repo.GetRemoteName() + "/" + branch.Parent.Name
+		if exists, err := repo.DoesRefExist(ctx, parentRef); err != nil || !exists {
+			parentRef = "refs/heads/" + branch.Parent.Name
+		}
+	}
+	base, err := repo.MergeBase(ctx, parentRef, head)
+	if err != nil {
+		return "", errors.WrapIff(err, "failed to find the merge base of %q and %q", branch.Name, branch.Parent.Name)
+	}
+	return base, nil
+}
+
+// splitChangedFiles returns the files that are changed between base and head
+// and match the pathspecs.
+func splitChangedFiles(ctx context.Context, repo *git.Repo, base, head string, pathspecs ...string) ([]string, error) {
+	args := []string{"diff", "--name-only", "--no-renames", "-z", base, head, "--"}
+	out, err := repo.Run(ctx, &git.RunOpts{
+		Args:      append(args, pathspecs...),
+		ExitError: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range strings.Split(string(out.Stdout), "\x00") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// splitUpdateIndex sets the files in the index to their state in head. The
+// files that don't exist in head are removed from the index.
+func splitUpdateIndex(ctx context.Context, repo *git.Repo, env []string, head string, files []string) error {
+	out, err := repo.Run(ctx, &git.RunOpts{
+		Args:      append([]string{"--literal-pathspecs", "ls-tree", "-r", "-z", head, "--"}, files...),
+		ExitError: true,
+	})
+	if err != nil {
+		return err
+	}
+	// The output of ls-tree is in the format that update-index --index-info
+	// accepts.
+	var sb bytes.Buffer
+	sb.Write(out.Stdout)
+	existing := map[string]bool{}
+	for _, entry := range strings.Split(string(out.Stdout), "\x00") {
+		if _, path, ok := strings.Cut(entry, "\t"); ok {
+			existing[path] = true
+		}
+	}
+	for _, f := range files {
+		if !existing[f] {
+			// Mode 0 removes the path.
+			fmt.Fprintf(&sb, "0 %s\t%s\x00", git.ZeroOID(head), f)
+		}
+	}
+	_, err = repo.Run(ctx, &git.RunOpts{
+		Args:      []string{"update-index", "-z", "--index-info"},
+		Env:       env,
+		Stdin:     &sb,
+		ExitError: true,
+	})
+	return err
+}
+
+func init() {
+	splitCmd.Flags().StringArrayVar(
+		&splitFlags.ByPath, "by-path", nil,
+		"glob of the paths to split into a new branch (can be repeated)",
+	)
+	splitCmd.Flags().StringArrayVar(
+		&splitFlags.Name, "name", nil,
+		"name of the new branch for the corresponding --by-path (can be repeated)",
+	)
+	_ = splitCmd.MarkFlagRequired("by-path")
+}
@@ -7,13 +7,19 @@ import (
 
 	"emperror.dev/errors"
 	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/git"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/aviator-co/av/internal/utils/uiutils"
 	"github.com/shurcooL/githubv4"
 	"github.com/spf13/cobra"
 )
 
+var squashFlags struct {
+	Autostash bool
+}
+
 var squashCmd = &cobra.Command{
 	Use:   "squash",
 	Short: "Squash commits of the current branch into a single commit",
@@ -30,16 +36,44 @@ var squashCmd = &cobra.Command{
 			return err
 		}
 
-		if err := runSquash(ctx, repo, db); err != nil {
+		if !cmd.Flags().Changed("autostash") {
+			squashFlags.Autostash = config.Av.Sync.Autostash
+		}
+		var stash string
+		if squashFlags.Autostash {
+			// Untracked files are stashed as well since runSquash requires a
+			// clean working directory.
+			stash, err = autostash(ctx, repo, true)
+			if err != nil {
+				return err
+			}
+		}
+
+		squashErr := runSquash(ctx, repo, db)
+		if err := restoreAutostash(ctx, repo, stash); err != nil {
+			return err
+		}
+		if squashErr != nil {
 			fmt.Fprint(os.Stderr, colors.Failure("Failed to squash."), "\n")
-			fmt.Fprint(os.Stderr, colors.Failure(err.Error()), "\n")
+			fmt.Fprint(os.Stderr, colors.Failure(squashErr.Error()), "\n")
 			return actions.ErrExitSilently{ExitCode: 1}
 		}
 
-		return runPostCommitRestack(repo, db)
+		return uiutils.RunBubbleTea(&postCommitRestackViewModel{
+			repo:      repo,
+			db:        db,
+			autostash: squashFlags.Autostash,
+		})
 	},
 }
 
+func init() {
+	squashCmd.Flags().BoolVar(
+		&squashFlags.Autostash, "autostash", false,
+		"stash the local changes before squashing and restore them afterward\n(default: sync.autostash config)",
+	)
+}
+
 func runSquash(ctx context.Context, repo *git.Repo, db meta.DB) error {
 	status, err := repo.Status(ctx)
 	if err != nil {
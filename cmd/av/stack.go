@@ -8,7 +8,7 @@ var stackCmd = &cobra.Command{
 	Use:     "stack",
 	Aliases: []string{"st"},
 	Hidden:  true,
-	Short:   "Deprecated command to manage stacked pull requests",
+	Short:   "Export and import stacks (the other subcommands are deprecated)",
 }
 
 func init() {
@@ -123,5 +123,7 @@ func init() {
 		deprecatedTreeCmd,
 		stackForEachCmd,
 		deprecatedRestackCmd,
+		stackExportCmd,
+		stackImportCmd,
 	)
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/stackbundle"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/spf13/cobra"
+)
+
+var stackExportFlags struct {
+	Output    string
+	GitBundle bool
+}
+
+var stackExportCmd = &cobra.Command{
+	Use:   "export [-o <file>] [--git-bundle]",
+	Short: "Export the current stack to a file",
+	Long: strings.TrimSpace(`
+Export the current stack to a self-contained file that can be imported into
+another clone of the repository with "av stack import".
+
+The file contains the av metadata of every branch in the stack (the parent
+branches, the branching points, and the pull request links) and the commit that
+each branch points to. By default, the importer fetches the commits from the
+remote, so the branches must be pushed. Use --git-bundle to embed the commits
+of the stack in the file instead.`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) (reterr error) {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return err
+		}
+		db, err := getDB(ctx, repo)
+		if err != nil {
+			return err
+		}
+		tx := db.ReadTx()
+		currentBranch, err := repo.CurrentBranchName()
+		if err != nil {
+			return err
+		}
+		branches, err := meta.StackBranches(tx, currentBranch)
+		if err != nil {
+			return err
+		}
+
+		b, err := stackbundle.Export(ctx, repo, tx, branches, stackbundle.ExportOpts{
+			GitBundle: stackExportFlags.GitBundle,
+		})
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if stackExportFlags.Output != "" && stackExportFlags.Output != "-" {
+			f, err := os.Create(stackExportFlags.Output)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if err := f.Close(); err != nil && reterr == nil {
+					reterr = err
+				}
+			}()
+			w = f
+		}
+		if err := b.Write(w); err != nil {
+			return err
+		}
+		if w != os.Stdout {
+			fmt.Fprint(
+				os.Stderr,
+				"Exported ", colors.UserInput(strings.Join(branches, ", ")),
+				" to ", colors.UserInput(stackExportFlags.Output), "\n",
+			)
+		}
+		return nil
+	},
+}
+
+func init() {
+	stackExportCmd.Flags().StringVarP(
+		&stackExportFlags.Output, "output", "o", "",
+		"write the stack to the file instead of stdout",
+	)
+	stackExportCmd.Flags().BoolVar(
+		&stackExportFlags.GitBundle, "git-bundle", false,
+		"embed the commits of the stack in the file",
+	)
+}
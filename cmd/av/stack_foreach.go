@@ -22,7 +22,7 @@ var stackForEachCmd = &cobra.Command{
 	Use:        "for-each [flags] -- <command> [args...] ggit ",
 	Aliases:    []string{"foreach", "fe"},
 	Hidden:     true,
-	Deprecated: "this command has been deprecated and will be removed in a future release",
+	Deprecated: "this command has been deprecated and will be removed in a future release; use av exec instead",
 	Short:      "execute a command for each branch in the current stack",
 	Long: `Execute a command for each branch in the current stack.
 
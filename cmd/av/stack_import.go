@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"charm.land/lipgloss/v2"
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/stackbundle"
+	"github.com/aviator-co/av/internal/utils/cleanup"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var stackImportFlags struct {
+	Force bool
+}
+
+var stackImportCmd = &cobra.Command{
+	Use:   "import [--force] <file>",
+	Short: "Import a stack exported with av stack export",
+	Long: strings.TrimSpace(`
+Import a stack exported with "av stack export". Use "-" to read from stdin.
+
+The branches in the stack are created at the exported commits and their av
+metadata is recreated. The commits are taken from the file if it was exported
+with --git-bundle. Otherwise, the branches are fetched from the remote.
+
+The imported metadata is validated with the same checks as "av validate-db". If
+there is any error, nothing is imported.
+
+A branch that already exists at a different commit is not modified unless
+--force is given.`),
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) (reterr error) {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return err
+		}
+		db, err := getDB(ctx, repo)
+		if err != nil {
+			return err
+		}
+
+		var r io.Reader = os.Stdin
+		if args[0] != "-" {
+			f, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		b, err := stackbundle.Read(r)
+		if err != nil {
+			return err
+		}
+
+		tx := db.WriteTx()
+		cu := cleanup.New(func() {
+			logrus.WithError(reterr).Debug("aborting db transaction")
+			tx.Abort()
+		})
+		defer cu.Cleanup()
+
+		res, err := stackbundle.Import(ctx, repo, tx, b, stackbundle.ImportOpts{
+			Force: stackImportFlags.Force,
+		})
+		if err != nil {
+			return err
+		}
+		cu.Add(func() {
+			if err := res.Rollback(ctx, repo); err != nil {
+				logrus.WithError(err).Error("failed to revert the imported branches")
+			}
+		})
+
+		issues, err := validateDB(ctx, repo, tx)
+		if err != nil {
+			return err
+		}
+		imported := res.Branches()
+		issues = slices.DeleteFunc(issues, func(issue diagnosticIssue) bool {
+			return !slices.Contains(imported, issue.branch)
+		})
+		if slices.ContainsFunc(issues, func(issue diagnosticIssue) bool {
+			return issue.severity == diagnosticError
+		}) {
+			_, _ = lipgloss.Print(renderValidation(issues))
+			return errors.New("the imported stack is invalid; nothing was imported")
+		}
+
+		cu.Cancel()
+		if err := tx.Commit(); err != nil {
+			if rerr := res.Rollback(ctx, repo); rerr != nil {
+				logrus.WithError(rerr).Error("failed to revert the imported branches")
+			}
+			return err
+		}
+		if len(issues) > 0 {
+			_, _ = lipgloss.Print(renderValidation(issues))
+		}
+
+		fmt.Fprint(os.Stderr, colors.SuccessStyle.Render("✓ Imported the stack"), "\n")
+		for _, name := range res.Created {
+			fmt.Fprint(os.Stderr, "  - created ", colors.UserInput(name), "\n")
+		}
+		for _, name := range res.Reset {
+			fmt.Fprint(os.Stderr, "  - reset ", colors.UserInput(name), "\n")
+		}
+		for _, name := range res.Unchanged {
+			fmt.Fprint(os.Stderr, "  - updated the metadata of ", colors.UserInput(name), "\n")
+		}
+		return nil
+	},
+}
+
+func init() {
+	stackImportCmd.Flags().BoolVar(
+		&stackImportFlags.Force, "force", false,
+		"reset the branches that already exist at a different commit",
+	)
+}
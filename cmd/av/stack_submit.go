@@ -20,6 +20,6 @@ Create pull requests for every branch in the stack
 If the --current flag is given, this command will create pull requests up to the current branch.`),
 	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, _ []string) error {
-		return submitAll(cmd.Context(), stackSubmitFlags.Current, stackSubmitFlags.Draft)
+		return submitAll(cmd.Context(), stackSubmitFlags.Current, stackSubmitFlags.Draft, "")
 	},
 }
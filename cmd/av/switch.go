@@ -24,6 +24,10 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var switchFlags struct {
+	Label string
+}
+
 var switchCmd = &cobra.Command{
 	Use:               "switch [<branch> | <url>]",
 	Short:             "Interactively switch to a different branch",
@@ -60,7 +64,15 @@ var switchCmd = &cobra.Command{
 			return nil
 		}
 
-		rootNodes := stackutils.BuildStackTreeAllBranches(tx, currentBranch, true)
+		var rootNodes []*stackutils.StackTreeNode
+		if switchFlags.Label != "" {
+			rootNodes, err = stackutils.BuildStackTreeLabeledBranches(tx, currentBranch, true, switchFlags.Label)
+			if err != nil {
+				return err
+			}
+		} else {
+			rootNodes = stackutils.BuildStackTreeAllBranches(tx, currentBranch, true)
+		}
 		var branchList []*stackTreeBranchInfo
 		branches := map[string]*stackTreeBranchInfo{}
 		for _, node := range rootNodes {
@@ -357,3 +369,10 @@ func (vm switchViewModel) ExitError() error {
 	}
 	return nil
 }
+
+func init() {
+	switchCmd.Flags().StringVar(
+		&switchFlags.Label, "label", "",
+		"show only the branches that have the given label",
+	)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/aviator-co/av/internal/gh/ghui"
 	"github.com/aviator-co/av/internal/git"
 	"github.com/aviator-co/av/internal/git/gitui"
+	"github.com/aviator-co/av/internal/jsonoutput"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/sequencer"
 	"github.com/aviator-co/av/internal/sequencer/planner"
@@ -23,6 +24,7 @@ import (
 	"github.com/aviator-co/av/internal/utils/uiutils"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/mattn/go-isatty"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -36,6 +38,10 @@ var syncFlags struct {
 	Push             string
 	Prune            string
 	FastForwardTrunk bool
+	Label            string
+	DryRun           bool
+	Format           string
+	Autostash        bool
 }
 
 var syncCmd = &cobra.Command{
@@ -62,6 +68,14 @@ base branch.
 Branches can be excluded from --all operations using av sync-exclude.
 Excluded branches and their descendants will be skipped when running av sync --all,
 but can still be synced explicitly.
+
+If the --label flag is given, this command will sync the branches that have the
+label (see av branch label), regardless of the stack they belong to.
+
+If the --dry-run flag is given, this command will show the branches that would be
+rebased without fetching from GitHub or modifying anything. Since the latest
+pull request states are not fetched, the plan is based on the local metadata.
+Use --format json for machine-readable output (see av-json(7)).
 `),
 	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, _ []string) error {
@@ -87,9 +101,20 @@ but can still be synced explicitly.
 		if cmd.Flags().Changed("parent") {
 			return actions.ErrExitSilently{ExitCode: 1}
 		}
+		if err := jsonoutput.ValidateFormat(
+			syncFlags.Format, jsonoutput.FormatText, jsonoutput.FormatJSON,
+		); err != nil {
+			return err
+		}
+		if syncFlags.Format != jsonoutput.FormatText && !syncFlags.DryRun {
+			return errors.New("--format can only be used with --dry-run")
+		}
 		if !cmd.Flags().Changed("ff-trunk") {
 			syncFlags.FastForwardTrunk = config.Av.Sync.FastForwardTrunk
 		}
+		if !cmd.Flags().Changed("autostash") {
+			syncFlags.Autostash = config.Av.Sync.Autostash
+		}
 		repo, err := getRepo(ctx)
 		if err != nil {
 			return err
@@ -98,6 +123,9 @@ but can still be synced explicitly.
 		if err != nil {
 			return err
 		}
+		if syncFlags.DryRun {
+			return syncDryRun(ctx, repo, db)
+		}
 		client, err := getGitHubClient(ctx)
 		if err != nil {
 			return err
@@ -160,7 +188,7 @@ func (vm *syncViewModel) initSync() tea.Cmd {
 	if err != nil {
 		return uiutils.ErrCmd(err)
 	}
-	if isTrunkBranch && !syncFlags.All {
+	if isTrunkBranch && !syncFlags.All && syncFlags.Label == "" {
 		return vm.initTrunkCheck()
 	}
 	return vm.initPreAvHook()
@@ -195,7 +223,22 @@ func (vm *syncViewModel) initGitFetch() tea.Cmd {
 	currentBranch := status.CurrentBranch
 
 	var targetBranches []plumbing.ReferenceName
-	if syncFlags.All {
+	if syncFlags.Label != "" {
+		var err error
+		targetBranches, err = planner.GetLabeledTargetBranches(
+			ctx,
+			vm.db.ReadTx(),
+			vm.repo,
+			true,
+			syncFlags.Label,
+		)
+		if err != nil {
+			return uiutils.ErrCmd(err)
+		}
+		if len(targetBranches) == 0 {
+			return uiutils.ErrCmd(errors.Errorf("no branches have the label %q", syncFlags.Label))
+		}
+	} else if syncFlags.All {
 		var err error
 		targetBranches, err = planner.GetTargetBranches(
 			ctx,
@@ -233,10 +276,17 @@ func (vm *syncViewModel) initGitFetch() tea.Cmd {
 		vm.client,
 		currentBranchRef,
 		targetBranches,
-		vm.initSequencerState,
+		vm.initPullMetadata,
 	))
 }
 
+func (vm *syncViewModel) initPullMetadata() tea.Cmd {
+	if !config.Av.Sync.ShareMetadata {
+		return vm.initSequencerState()
+	}
+	return vm.AddView(gitui.NewShareMetadataModel(vm.repo, vm.db, false, vm.initSequencerState))
+}
+
 func (vm *syncViewModel) initSequencerState() tea.Cmd {
 	state, err := vm.createState()
 	if err != nil {
@@ -296,10 +346,17 @@ func (vm *syncViewModel) initPruneBranches() tea.Cmd {
 		vm.state.Prune,
 		vm.state.TargetBranches,
 		vm.restackState.InitialBranch,
-		vm.initFastForwardTrunk,
+		vm.initPushMetadata,
 	))
 }
 
+func (vm *syncViewModel) initPushMetadata() tea.Cmd {
+	if !config.Av.Sync.ShareMetadata || vm.state.Push == "no" {
+		return vm.initFastForwardTrunk()
+	}
+	return vm.AddView(gitui.NewShareMetadataModel(vm.repo, vm.db, true, vm.initFastForwardTrunk))
+}
+
 func (vm *syncViewModel) initFastForwardTrunk() tea.Cmd {
 	if !vm.state.FastForwardTrunk {
 		return tea.Quit
@@ -313,17 +370,42 @@ func (vm *syncViewModel) initFastForwardTrunk() tea.Cmd {
 }
 
 func (vm *syncViewModel) readState() (*savedSyncState, error) {
+	ctx := context.Background()
 	var state savedSyncState
 	if err := vm.repo.ReadStateFile(git.StateFileKindSyncV2, &state); err != nil &&
 		os.IsNotExist(err) {
-		return nil, nil
+		home, err := findStateInOtherWorktree(ctx, vm.repo, func(wtRepo *git.Repo) *sequencer.Sequencer {
+			var state savedSyncState
+			if err := wtRepo.ReadStateFile(git.StateFileKindSyncV2, &state); err != nil ||
+				state.RestackState == nil {
+				return nil
+			}
+			return state.RestackState.Seq
+		})
+		if err != nil || home == nil {
+			return nil, err
+		}
+		// Continue the sync as if it's run in the worktree where it started.
+		vm.repo = home
+		return vm.readState()
 	} else if err != nil {
 		return nil, err
 	}
-	if !vm.repo.IsRebaseInProgress() {
+	var seq *sequencer.Sequencer
+	if state.RestackState != nil {
+		seq = state.RestackState.Seq
+	}
+	if seq == nil || !seq.IsInterrupted(ctx, vm.repo) {
 		if err := vm.repo.WriteStateFile(git.StateFileKindSyncV2, nil); err != nil {
 			return nil, err
 		}
+		if seq != nil {
+			// The rebase was concluded outside of av. Restore the changes
+			// stashed by --autostash anyway.
+			for _, msg := range seq.RestoreStashes(ctx) {
+				logrus.Warn(msg)
+			}
+		}
 		return nil, nil
 	}
 	return &state, nil
@@ -357,7 +439,22 @@ func (vm *syncViewModel) createState() (*savedSyncState, error) {
 	state.RestackState.InitialBranch = currentBranch
 
 	var targetBranches []plumbing.ReferenceName
-	if syncFlags.All {
+	if syncFlags.Label != "" {
+		var err error
+		targetBranches, err = planner.GetLabeledTargetBranches(
+			ctx,
+			vm.db.ReadTx(),
+			vm.repo,
+			true,
+			syncFlags.Label,
+		)
+		if err != nil {
+			return nil, err
+		}
+		for _, br := range targetBranches {
+			state.RestackState.RelatedBranches = append(state.RestackState.RelatedBranches, br.Short())
+		}
+	} else if syncFlags.All {
 		var err error
 		targetBranches, err = planner.GetTargetBranches(
 			ctx,
@@ -399,14 +496,51 @@ func (vm *syncViewModel) createState() (*savedSyncState, error) {
 		syncFlags.All,
 		syncFlags.Current,
 		syncFlags.RebaseToTrunk,
+		syncFlags.Label,
 	)
 	if err != nil {
 		return nil, err
 	}
 	state.RestackState.Seq = sequencer.NewSequencer(vm.repo.GetRemoteName(), vm.db, ops)
+	if syncFlags.Autostash {
+		state.RestackState.Seq.Autostash = true
+		state.RestackState.Seq.AutostashWorktrees = config.Av.Sync.AutostashWorktrees
+	}
 	return &state, nil
 }
 
+func syncDryRun(ctx context.Context, repo *git.Repo, db meta.DB) error {
+	status, err := repo.Status(ctx)
+	if err != nil {
+		return err
+	}
+	currentBranch := status.CurrentBranch
+	tx := db.ReadTx()
+	if !syncFlags.All && syncFlags.Label == "" {
+		if _, exist := tx.Branch(currentBranch); !exist {
+			return errors.New("current branch is not adopted to av (use --all to plan for all branches)")
+		}
+	}
+	var currentBranchRef plumbing.ReferenceName
+	if currentBranch != "" {
+		currentBranchRef = plumbing.NewBranchReferenceName(currentBranch)
+	}
+	ops, err := planner.PlanForSync(
+		ctx,
+		tx,
+		repo,
+		currentBranchRef,
+		syncFlags.All,
+		syncFlags.Current,
+		syncFlags.RebaseToTrunk,
+		syncFlags.Label,
+	)
+	if err != nil {
+		return err
+	}
+	return printRestackPlan(ctx, repo, db, ops, syncFlags.Format)
+}
+
 func (vm *syncViewModel) ExitError() error {
 	if errors.Is(vm.Err, nothingToRestackError) {
 		return nil
@@ -545,8 +679,27 @@ func init() {
 		&syncFlags.Skip, "skip", false,
 		"skip the current commit and continue an in-progress sync",
 	)
-	syncCmd.MarkFlagsMutuallyExclusive("current", "all")
+	syncCmd.Flags().StringVar(
+		&syncFlags.Label, "label", "",
+		"synchronize the branches that have the given label",
+	)
+	syncCmd.Flags().BoolVar(
+		&syncFlags.DryRun, "dry-run", false,
+		"show the branches that would be rebased and the predicted conflicts\nwithout making any changes",
+	)
+	syncCmd.Flags().StringVar(
+		&syncFlags.Format, "format", jsonoutput.FormatText,
+		"output format of --dry-run (text|json); see av-json(7) for the JSON schema",
+	)
+	syncCmd.Flags().BoolVar(
+		&syncFlags.Autostash, "autostash", false,
+		"stash the local changes before rebasing and restore them afterward\n(default: sync.autostash config)",
+	)
+	syncCmd.MarkFlagsMutuallyExclusive("current", "all", "label")
 	syncCmd.MarkFlagsMutuallyExclusive("continue", "abort", "skip")
+	syncCmd.MarkFlagsMutuallyExclusive("dry-run", "continue")
+	syncCmd.MarkFlagsMutuallyExclusive("dry-run", "abort")
+	syncCmd.MarkFlagsMutuallyExclusive("dry-run", "skip")
 
 	// Deprecated flags
 	syncCmd.Flags().Bool(
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/aviator-co/av/internal/utils/executils"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var testFlags struct {
+	Parallel int
+	All      bool
+	Force    bool
+}
+
+var testCmd = &cobra.Command{
+	Use:   "test [--parallel <n>] [--all] [--force] -- <command> [args...]",
+	Short: "Run a command on every branch of the stack and cache the results",
+	Long: strings.TrimSpace(`
+Run a command on every branch of the current stack (or all stacks with --all)
+and cache the results by the tree of the branch.
+
+This works like "av exec", but the result of the command is recorded against
+the tree hash of each branch and the command line. The branches whose tree
+already passed the same command are skipped, so after a restack that doesn't
+change the content of the branches, the whole stack is reported as passed
+without running the command again. Failed results are always run again. Use
+--force to ignore the cache.
+
+The cached results are shown in "av tree --verbose".`),
+	Example: strings.TrimSpace(`
+  Run the tests on every branch of the stack:
+    $ av test -- make test`),
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return err
+		}
+		db, err := getDB(ctx, repo)
+		if err != nil {
+			return err
+		}
+		parallel := testFlags.Parallel
+		if parallel < 0 {
+			return errors.New("--parallel must not be negative")
+		} else if parallel == 0 {
+			parallel = runtime.NumCPU()
+		}
+		branches, err := execTargetBranches(ctx, repo, db.ReadTx(), testFlags.All)
+		if err != nil {
+			return err
+		}
+		if len(branches) == 0 {
+			return errors.New("there are no branches to run the command on")
+		}
+
+		command := executils.FormatCommandLine(args)
+		cache := readTestResultCache(repo)
+		trees := map[string]string{}
+		var toRun []string
+		for _, branch := range branches {
+			tree, err := repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + branch + "^{tree}"})
+			if err != nil {
+				return errors.WrapIff(err, "failed to get the tree of %q", branch)
+			}
+			trees[branch] = tree
+			if e := cache.Results[testResultCacheKey(tree, command)]; e != nil && e.Passed &&
+				!testFlags.Force {
+				continue
+			}
+			toRun = append(toRun, branch)
+		}
+
+		fmt.Fprint(
+			os.Stderr,
+			"Testing ", colors.CliCmd(command),
+			" on ", colors.UserInput(len(branches)), " branches",
+		)
+		if cached := len(branches) - len(toRun); cached > 0 {
+			fmt.Fprint(os.Stderr, colors.Faint(fmt.Sprintf(" (%d cached)", cached)))
+		}
+		fmt.Fprint(os.Stderr, "\n")
+
+		var runDir string
+		ran := map[string]execResult{}
+		if len(toRun) > 0 {
+			runDir, err = os.MkdirTemp(repo.AvTmpDir(), "test-*")
+			if err != nil {
+				return err
+			}
+			now := time.Now()
+			for _, r := range execOnBranches(ctx, repo, runDir, toRun, args, parallel) {
+				ran[r.Branch] = r
+				// Only the results of the command are cached, not the errors
+				// that prevented the command from running.
+				var exitErr execExitError
+				if r.Err != nil && !errors.As(r.Err, &exitErr) {
+					continue
+				}
+				cache.Results[testResultCacheKey(trees[r.Branch], command)] = &testResultCacheEntry{
+					Tree:     trees[r.Branch],
+					Command:  command,
+					Passed:   r.Err == nil,
+					Branch:   r.Branch,
+					TestedAt: now,
+				}
+			}
+			writeTestResultCache(repo, cache, now)
+		}
+
+		var results []execResult
+		for _, branch := range branches {
+			if r, ok := ran[branch]; ok {
+				results = append(results, r)
+			} else {
+				results = append(results, execResult{Branch: branch, Cached: true})
+			}
+		}
+		failed := printExecResults(results, runDir)
+		if failed > 0 {
+			fmt.Fprint(
+				os.Stderr,
+				colors.Failure(fmt.Sprintf("The command failed on %d of %d branches.", failed, len(results))),
+				"\n",
+			)
+			return actions.ErrExitSilently{ExitCode: 1}
+		}
+		fmt.Fprint(
+			os.Stderr,
+			colors.SuccessStyle.Render(fmt.Sprintf("✓ The command passed on all %d branches", len(results))),
+			"\n",
+		)
+		return nil
+	},
+}
+
+// testResultCache is the cache of the av test results shared by all the
+// worktrees. It's stored in .git/av/test-cache.json.
+type testResultCache struct {
+	// The results keyed by testResultCacheKey.
+	Results map[string]*testResultCacheEntry `json:"results"`
+}
+
+type testResultCacheEntry struct {
+	Tree    string `json:"tree"`
+	Command string `json:"command"`
+	Passed  bool   `json:"passed"`
+	// The branch that the command was run on. This is informational only,
+	// since the same tree can be on multiple branches.
+	Branch   string    `json:"branch"`
+	TestedAt time.Time `json:"testedAt"`
+}
+
+func testResultCacheKey(tree, command string) string {
+	return tree + " " + command
+}
+
+func testResultCachePath(repo *git.Repo) string {
+	return filepath.Join(repo.AvDir(), "test-cache.json")
+}
+
+func readTestResultCache(repo *git.Repo) *testResultCache {
+	cache := &testResultCache{Results: map[string]*testResultCacheEntry{}}
+	if bs, err := os.ReadFile(testResultCachePath(repo)); err == nil {
+		if err := json.Unmarshal(bs, cache); err != nil || cache.Results == nil {
+			logrus.WithError(err).Debug("ignoring the invalid test result cache")
+			cache.Results = map[string]*testResultCacheEntry{}
+		}
+	}
+	return cache
+}
+
+func writeTestResultCache(repo *git.Repo, cache *testResultCache, now time.Time) {
+	// Drop the old entries to keep the cache small.
+	for key, e := range cache.Results {
+		if now.Sub(e.TestedAt) > 30*24*time.Hour {
+			delete(cache.Results, key)
+		}
+	}
+	bs, err := json.Marshal(cache)
+	if err != nil {
+		logrus.WithError(err).Debug("failed to marshal the test result cache")
+		return
+	}
+	if err := os.WriteFile(testResultCachePath(repo), bs, 0o644); err != nil {
+		logrus.WithError(err).Debug("failed to write the test result cache")
+	}
+}
+
+// getCachedTestResults returns the latest cached av test result of the tree of
+// each branch, if any.
+func getCachedTestResults(
+	ctx context.Context,
+	repo *git.Repo,
+	branchNames []string,
+) map[string]*testResultCacheEntry {
+	cache := readTestResultCache(repo)
+	if len(cache.Results) == 0 {
+		return nil
+	}
+	latest := map[string]*testResultCacheEntry{}
+	for _, e := range cache.Results {
+		if l := latest[e.Tree]; l == nil || e.TestedAt.After(l.TestedAt) {
+			latest[e.Tree] = e
+		}
+	}
+	ret := map[string]*testResultCacheEntry{}
+	for _, name := range branchNames {
+		tree, err := repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + name + "^{tree}"})
+		if err != nil {
+			continue
+		}
+		if e := latest[tree]; e != nil {
+			ret[name] = e
+		}
+	}
+	return ret
+}
+
+func init() {
+	testCmd.Flags().IntVar(
+		&testFlags.Parallel, "parallel", 0,
+		"the maximum number of commands to run at a time (default: the number of CPUs)",
+	)
+	testCmd.Flags().BoolVar(
+		&testFlags.All, "all", false,
+		"run the command on the branches of all stacks",
+	)
+	testCmd.Flags().BoolVar(
+		&testFlags.Force, "force", false,
+		"run the command even if the result is cached",
+	)
+}
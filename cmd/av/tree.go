@@ -3,18 +3,25 @@ package main
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strings"
 
 	"charm.land/lipgloss/v2"
 	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/jsonoutput"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/utils/colors"
 	"github.com/aviator-co/av/internal/utils/stackutils"
 	"github.com/spf13/cobra"
 )
 
-var flagTreeCurrent bool
+var (
+	flagTreeCurrent bool
+	flagTreeVerbose bool
+	flagTreeLabel   string
+	flagTreeFormat  string
+)
 
 var treeCmd = &cobra.Command{
 	Use:   "tree",
@@ -22,6 +29,12 @@ var treeCmd = &cobra.Command{
 	Args:  cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		ctx := cmd.Context()
+		if err := jsonoutput.ValidateFormat(
+			flagTreeFormat,
+			jsonoutput.FormatText, jsonoutput.FormatJSON, treeFormatMermaid, treeFormatDOT,
+		); err != nil {
+			return err
+		}
 		repo, err := getRepo(ctx)
 		if err != nil {
 			return err
@@ -49,7 +62,12 @@ var treeCmd = &cobra.Command{
 		currentBranch := status.CurrentBranch
 		tx := db.ReadTx()
 		var rootNodes []*stackutils.StackTreeNode
-		if flagTreeCurrent {
+		if flagTreeLabel != "" {
+			rootNodes, err = stackutils.BuildStackTreeLabeledBranches(tx, currentBranch, true, flagTreeLabel)
+			if err != nil {
+				return err
+			}
+		} else if flagTreeCurrent {
 			node, err := stackutils.BuildStackTreeCurrentStack(tx, currentBranch, true)
 			if err != nil {
 				return err
@@ -58,6 +76,27 @@ var treeCmd = &cobra.Command{
 		} else {
 			rootNodes = stackutils.BuildStackTreeAllBranches(tx, currentBranch, true)
 		}
+		switch flagTreeFormat {
+		case jsonoutput.FormatJSON:
+			builder := jsonoutput.NewBranchBuilder(ctx, repo, tx, currentBranch)
+			return jsonoutput.Write(os.Stdout, builder.Tree(ctx, rootNodes))
+		case treeFormatMermaid, treeFormatDOT:
+			labelFn := func(branchName string, isTrunk bool) []string {
+				return stackutils.GraphNodeLabel(
+					tx, branchName, isTrunk, countBranchCommits(ctx, repo, tx, branchName, isTrunk),
+				)
+			}
+			if flagTreeFormat == treeFormatMermaid {
+				fmt.Print(stackutils.RenderMermaid(rootNodes, currentBranch, labelFn))
+			} else {
+				fmt.Print(stackutils.RenderDOT(rootNodes, currentBranch, labelFn))
+			}
+			return nil
+		}
+		var columns map[string]*treeBranchColumns
+		if flagTreeVerbose {
+			columns = getTreeBranchColumns(ctx, repo, tx, treeBranchNames(rootNodes))
+		}
 		for _, node := range rootNodes {
 			ss = append(
 				ss,
@@ -69,6 +108,8 @@ var treeCmd = &cobra.Command{
 						branchName,
 						isTrunk,
 						worktreesByBranch,
+						flagTreeVerbose,
+						columns[branchName],
 					)
 				}),
 			)
@@ -86,6 +127,56 @@ var treeCmd = &cobra.Command{
 
 func init() {
 	treeCmd.Flags().BoolVar(&flagTreeCurrent, "current", false, "show only the current stack")
+	treeCmd.Flags().BoolVarP(&flagTreeVerbose, "verbose", "v", false, "show more information about each branch (commits, push and restack state,\nand pull request review state)")
+	treeCmd.Flags().StringVar(&flagTreeLabel, "label", "", "show only the branches that have the given label")
+	treeCmd.Flags().StringVar(
+		&flagTreeFormat, "format", jsonoutput.FormatText,
+		"output format (text|json|mermaid|dot); see av-json(7) for the JSON schema",
+	)
+	treeCmd.MarkFlagsMutuallyExclusive("current", "label")
+}
+
+// treeBranchNames returns the names of the branches in the trees.
+func treeBranchNames(nodes []*stackutils.StackTreeNode) []string {
+	var ret []string
+	for _, node := range nodes {
+		ret = append(ret, node.Branch.BranchName)
+		ret = append(ret, treeBranchNames(node.Children)...)
+	}
+	return ret
+}
+
+const (
+	treeFormatMermaid = "mermaid"
+	treeFormatDOT     = "dot"
+)
+
+// countBranchCommits returns the number of commits on the branch that are not
+// on its parent branch, or -1 if it cannot be determined.
+func countBranchCommits(
+	ctx context.Context,
+	repo *git.Repo,
+	tx meta.ReadTx,
+	branchName string,
+	isTrunk bool,
+) int {
+	if isTrunk {
+		return -1
+	}
+	bi, _ := tx.Branch(branchName)
+	base := bi.Parent.Name
+	if bi.Parent.BranchingPointCommitHash != "" {
+		// The parent may have moved since the branch was last restacked.
+		// The branching point is what the branch is actually based on.
+		base = bi.Parent.BranchingPointCommitHash
+	}
+	commits, err := repo.RevList(ctx, git.RevListOpts{
+		Specifiers: []string{"refs/heads/" + branchName, "^" + base},
+	})
+	if err != nil {
+		return -1
+	}
+	return len(commits)
 }
 
 type stackBranchInfoStyles struct {
@@ -107,6 +198,8 @@ func renderStackTreeBranchInfo(
 	branchName string,
 	isTrunk bool,
 	worktrees map[string]string,
+	verbose bool,
+	columns *treeBranchColumns,
 ) string {
 	bi, _ := tx.Branch(branchName)
 
@@ -126,6 +219,9 @@ func renderStackTreeBranchInfo(
 			stats = append(stats, colors.Faint("excluded from sync --all"))
 		}
 	}
+	if len(bi.Labels) > 0 {
+		stats = append(stats, colors.Faint("labels: "+strings.Join(bi.Labels, ", ")))
+	}
 	if len(stats) > 0 {
 		sb.WriteString(" (")
 		sb.WriteString(strings.Join(stats, ", "))
@@ -139,6 +235,16 @@ func renderStackTreeBranchInfo(
 		} else {
 			sb.WriteString(styles.PullRequestLink.Render("No pull request"))
 		}
+		if columns != nil {
+			sb.WriteString("\n")
+			sb.WriteString(renderTreeBranchColumns(columns))
+		}
+		if verbose && bi.Description != "" {
+			for line := range strings.SplitSeq(bi.Description, "\n") {
+				sb.WriteString("\n")
+				sb.WriteString(colors.Faint(line))
+			}
+		}
 	}
 	return sb.String()
 }
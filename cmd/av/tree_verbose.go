@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aviator-co/av/internal/gh"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/jsonoutput"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/shurcooL/githubv4"
+	"github.com/sirupsen/logrus"
+)
+
+// treeBranchColumns is the extra information shown for each branch by
+// `av tree --verbose`.
+type treeBranchColumns struct {
+	// The number of commits on the branch that are not on the parent, or -1
+	// if unknown.
+	Commits int
+	// Whether the branch has been pushed by av (i.e., av-pushed-commit is
+	// recorded).
+	Pushed bool
+	// The number of commits ahead of and behind the pushed commit.
+	Ahead, Behind int
+	// Whether the parent branch has moved past the branching point.
+	NeedsRestack bool
+	// The review state of the pull request, if fetched.
+	PullRequest *gh.PullRequestReviewState
+	// The latest av test result of the tree of the branch, if cached.
+	Test *testResultCacheEntry
+}
+
+// getTreeBranchColumns collects the columns of the given branches. The pull
+// request states are fetched from GitHub in one batch and cached between runs
+// (see prReviewStateCache).
+func getTreeBranchColumns(
+	ctx context.Context,
+	repo *git.Repo,
+	tx meta.ReadTx,
+	branchNames []string,
+) map[string]*treeBranchColumns {
+	ret := map[string]*treeBranchColumns{}
+	var prIDs []string
+	for _, name := range branchNames {
+		bi, ok := tx.Branch(name)
+		if !ok {
+			continue
+		}
+		cols := &treeBranchColumns{
+			Commits: countBranchCommits(ctx, repo, tx, name, false),
+		}
+		if pushed, err := repo.BranchGetConfig(ctx, name, "av-pushed-commit"); err == nil && pushed != "" {
+			if ahead, behind, err := repo.AheadBehind(ctx, pushed, "refs/heads/"+name); err == nil {
+				cols.Pushed = true
+				cols.Ahead, cols.Behind = ahead, behind
+			}
+		}
+		if !bi.Parent.Trunk && bi.MergeCommit == "" {
+			cols.NeedsRestack = jsonoutput.NeedsRestack(ctx, repo, bi.Parent.Name, "refs/heads/"+name)
+		}
+		if bi.PullRequest != nil && bi.PullRequest.ID != "" {
+			prIDs = append(prIDs, bi.PullRequest.ID)
+		}
+		ret[name] = cols
+	}
+
+	states := getPullRequestReviewStates(ctx, repo, prIDs)
+	tests := getCachedTestResults(ctx, repo, branchNames)
+	for _, name := range branchNames {
+		bi, _ := tx.Branch(name)
+		cols := ret[name]
+		if cols == nil {
+			continue
+		}
+		if bi.PullRequest != nil {
+			cols.PullRequest = states[bi.PullRequest.ID]
+		}
+		cols.Test = tests[name]
+	}
+	return ret
+}
+
+func renderTreeBranchColumns(cols *treeBranchColumns) string {
+	var ss []string
+	switch cols.Commits {
+	case -1:
+	case 1:
+		ss = append(ss, "1 commit")
+	default:
+		ss = append(ss, fmt.Sprintf("%d commits", cols.Commits))
+	}
+	if !cols.Pushed {
+		ss = append(ss, "not pushed")
+	} else if cols.Ahead == 0 && cols.Behind == 0 {
+		ss = append(ss, "pushed")
+	} else {
+		var ab []string
+		if cols.Ahead > 0 {
+			ab = append(ab, fmt.Sprintf("%d ahead", cols.Ahead))
+		}
+		if cols.Behind > 0 {
+			ab = append(ab, fmt.Sprintf("%d behind", cols.Behind))
+		}
+		ss = append(ss, strings.Join(ab, ", ")+" of pushed")
+	}
+	if pr := cols.PullRequest; pr != nil {
+		prs := fmt.Sprintf("#%d", pr.Number)
+		if pr.State == githubv4.PullRequestStateOpen && pr.IsDraft {
+			prs += " draft"
+		} else {
+			prs += " " + strings.ToLower(string(pr.State))
+		}
+		if pr.State == githubv4.PullRequestStateOpen && pr.ReviewDecision != "" {
+			prs += ", " + strings.ReplaceAll(strings.ToLower(string(pr.ReviewDecision)), "_", " ")
+		}
+		ss = append(ss, prs)
+	}
+	ret := colors.Faint(strings.Join(ss, " · "))
+	if t := cols.Test; t != nil {
+		if t.Passed {
+			ret += colors.Faint(" · ") + colors.Success("✓ "+t.Command)
+		} else {
+			ret += colors.Faint(" · ") + colors.Failure("✗ "+t.Command)
+		}
+	}
+	if cols.NeedsRestack {
+		ret += colors.Faint(" · ") + colors.Warning("needs restack")
+	}
+	return ret
+}
+
+// prReviewStateCacheTTL is how long the cached pull request states are used
+// before they are fetched again.
+const prReviewStateCacheTTL = 5 * time.Minute
+
+// prReviewStateCache is the cache of the pull request review states shared by
+// all the worktrees. It's stored in .git/av/pr-review-cache.json.
+type prReviewStateCache struct {
+	PullRequests map[string]*prReviewStateCacheEntry `json:"pullRequests"`
+}
+
+type prReviewStateCacheEntry struct {
+	State     gh.PullRequestReviewState `json:"state"`
+	FetchedAt time.Time                 `json:"fetchedAt"`
+}
+
+func prReviewStateCachePath(repo *git.Repo) string {
+	return filepath.Join(repo.AvDir(), "pr-review-cache.json")
+}
+
+// getPullRequestReviewStates returns the review states of the pull requests
+// keyed by the node ID. The states that are not in the cache or have expired
+// are fetched from GitHub. If GitHub cannot be reached, the expired states are
+// used as-is.
+func getPullRequestReviewStates(
+	ctx context.Context,
+	repo *git.Repo,
+	ids []string,
+) map[string]*gh.PullRequestReviewState {
+	cache := prReviewStateCache{PullRequests: map[string]*prReviewStateCacheEntry{}}
+	if bs, err := os.ReadFile(prReviewStateCachePath(repo)); err == nil {
+		if err := json.Unmarshal(bs, &cache); err != nil || cache.PullRequests == nil {
+			logrus.WithError(err).Debug("ignoring the invalid pull request cache")
+			cache.PullRequests = map[string]*prReviewStateCacheEntry{}
+		}
+	}
+
+	now := time.Now()
+	var stale []string
+	for _, id := range ids {
+		if e, ok := cache.PullRequests[id]; !ok || now.Sub(e.FetchedAt) > prReviewStateCacheTTL {
+			stale = append(stale, id)
+		}
+	}
+	if len(stale) > 0 {
+		if err := fetchPullRequestReviewStates(ctx, &cache, stale, now); err != nil {
+			logrus.WithError(err).Debug("failed to fetch the pull request states; using the cache")
+		} else if bs, err := json.Marshal(cache); err == nil {
+			if err := os.WriteFile(prReviewStateCachePath(repo), bs, 0o644); err != nil {
+				logrus.WithError(err).Debug("failed to write the pull request cache")
+			}
+		}
+	}
+
+	ret := map[string]*gh.PullRequestReviewState{}
+	for _, id := range ids {
+		if e, ok := cache.PullRequests[id]; ok {
+			ret[id] = &e.State
+		}
+	}
+	return ret
+}
+
+func fetchPullRequestReviewStates(
+	ctx context.Context,
+	cache *prReviewStateCache,
+	ids []string,
+	now time.Time,
+) error {
+	client, err := getGitHubClient(ctx)
+	if err != nil {
+		return err
+	}
+	states, err := client.PullRequestReviewStates(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, st := range states {
+		cache.PullRequests[st.ID] = &prReviewStateCacheEntry{State: st, FetchedAt: now}
+	}
+	// Drop the entries that have expired long ago (e.g., the pull requests of
+	// the deleted branches) to keep the cache small.
+	for id, e := range cache.PullRequests {
+		if now.Sub(e.FetchedAt) > 30*24*time.Hour {
+			delete(cache.PullRequests, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/journal"
+	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var undoFlags struct {
+	List  bool
+	Force bool
+}
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Undo the last av operation",
+	Long: strings.TrimSpace(`
+Undo the last av operation that modified the branches or the av metadata.
+
+The commands that rewrite branches (sync, restack, reorder, reparent, squash,
+absorb, commit move, fold, split, orphan, branch --delete, branch --insert,
+stack import, and validate-db --fix) record the commit of every branch they
+touched and the metadata before the change. This command restores the branches
+(including the branches deleted by "av sync --prune") and the metadata to the
+state before the last operation.
+
+Use --list to see the operations that can be undone, newest first.`),
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return err
+		}
+		if undoFlags.List {
+			return listJournal(repo)
+		}
+		db, err := getDB(ctx, repo)
+		if err != nil {
+			return err
+		}
+
+		entry, err := journal.Undo(ctx, repo, db, journal.UndoOpts{Force: undoFlags.Force})
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(os.Stderr, colors.SuccessStyle.Render("✓ Undid "+entry.Command), "\n")
+		for _, rc := range entry.Refs {
+			switch {
+			case rc.Before == "":
+				fmt.Fprint(os.Stderr, "  - deleted ", colors.UserInput(rc.Branch), "\n")
+			case rc.After == "":
+				fmt.Fprint(
+					os.Stderr,
+					"  - restored ", colors.UserInput(rc.Branch),
+					" at ", git.ShortSha(rc.Before), "\n",
+				)
+			default:
+				fmt.Fprint(
+					os.Stderr,
+					"  - reset ", colors.UserInput(rc.Branch),
+					" from ", git.ShortSha(rc.After), " to ", git.ShortSha(rc.Before), "\n",
+				)
+			}
+		}
+		fmt.Fprint(
+			os.Stderr,
+			colors.Faint("Note that the changes pushed to the remote are not reverted."),
+			"\n",
+		)
+		return nil
+	},
+}
+
+func listJournal(repo *git.Repo) error {
+	entries, err := journal.List(repo)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Fprint(os.Stderr, "There is no operation to undo.\n")
+		return nil
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		fmt.Fprint(
+			os.Stdout,
+			colors.UserInput(fmt.Sprintf("#%d", e.ID)), " ",
+			e.Time.Local().Format("2006-01-02 15:04:05"), " ",
+			e.Command,
+			colors.Faint(fmt.Sprintf(" (%d branches, %d metadata changes)", len(e.Refs), len(e.Metadata))),
+			"\n",
+		)
+	}
+	return nil
+}
+
+// recordOperation wraps the RunE of a command so that the changes it makes to
+// the branches and the av metadata are recorded in the operation journal.
+func recordOperation(
+	runE func(*cobra.Command, []string) error,
+) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		repo, err := getRepo(ctx)
+		if err != nil {
+			return runE(cmd, args)
+		}
+		db, err := getDB(ctx, repo)
+		if err != nil {
+			return runE(cmd, args)
+		}
+		op, err := journal.Begin(ctx, repo, db, "av "+strings.Join(os.Args[1:], " "))
+		if err != nil {
+			return errors.WrapIf(err, "failed to start recording the operation")
+		}
+
+		reterr := runE(cmd, args)
+
+		// The command opens its own database, so reopen it to see the changes.
+		db, err = getDB(ctx, repo)
+		if err == nil {
+			err = op.Finish(ctx, repo, db)
+		}
+		if err != nil {
+			logrus.WithError(err).Warn("failed to record the operation for av undo")
+		}
+		return reterr
+	}
+}
+
+func init() {
+	undoCmd.Flags().BoolVar(
+		&undoFlags.List, "list", false,
+		"list the operations that can be undone",
+	)
+	undoCmd.Flags().BoolVar(
+		&undoFlags.Force, "force", false,
+		"restore the branches even if they were modified after the operation",
+	)
+	undoCmd.MarkFlagsMutuallyExclusive("list", "force")
+
+	for _, cmd := range []*cobra.Command{
+		absorbCmd,
+		commitMoveCmd,
+		foldCmd,
+		orphanCmd,
+		reorderCmd,
+		reparentCmd,
+		restackCmd,
+		splitCmd,
+		squashCmd,
+		stackImportCmd,
+		syncCmd,
+		validateDBCmd,
+	} {
+		cmd.RunE = recordOperation(cmd.RunE)
+	}
+
+	// Only --delete and --insert of av branch rewrite the stack.
+	branchRunE := branchCmd.RunE
+	recordedBranchRunE := recordOperation(branchRunE)
+	branchCmd.RunE = func(cmd *cobra.Command, args []string) error {
+		if branchFlags.Delete || branchFlags.Insert {
+			return recordedBranchRunE(cmd, args)
+		}
+		return branchRunE(cmd, args)
+	}
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
 
 	"charm.land/lipgloss/v2"
 	"github.com/aviator-co/av/internal/git"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/utils/colors"
+	"github.com/shurcooL/githubv4"
 	"github.com/spf13/cobra"
 )
 
@@ -22,13 +29,43 @@ type diagnosticIssue struct {
 	severity diagnosticSeverity
 	branch   string
 	message  string
+	// fix is the proposed repair of the issue, if any.
+	fix *diagnosticFix
+	// findFix finds the repair of the issue if it's costly to find (e.g., it
+	// runs git). It's called only with --fix and can return nil.
+	findFix func() *diagnosticFix
+}
+
+type diagnosticFix struct {
+	// description is a human-readable description of the repair.
+	description string
+	// apply applies the repair to the transaction.
+	apply func(tx meta.WriteTx)
+}
+
+var validateDBFlags struct {
+	Fix bool
+	Yes bool
 }
 
 var validateDBCmd = &cobra.Command{
 	Use:   "validate-db",
 	Short: "Validate av metadata",
-	Long: `Validate av metadata for common consistency issues, including cyclical
-branch dependencies and missing parents.`,
+	Long: strings.TrimSpace(`
+Validate av metadata for common consistency issues, including cyclical
+branch dependencies and missing parents.
+
+If the --fix flag is given, this command proposes a repair for each issue that
+can be fixed automatically and applies it after confirmation:
+
+  * Branches that no longer exist are removed from the metadata. Their children
+    are reparented to the parent of the removed branch.
+  * Branches with a missing parent or a cyclical parent are reparented to the
+    trunk.
+  * Invalid branching points are recomputed from the reflog of the parent
+    branch (or the merge-base if the reflog doesn't have it).
+  * Stale pull request entries (incomplete or closed pull requests) are
+    cleared so that "av pr" creates a new pull request.`),
 	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, _ []string) error {
 		ctx := cmd.Context()
@@ -41,6 +78,10 @@ branch dependencies and missing parents.`,
 			return err
 		}
 
+		if validateDBFlags.Fix {
+			return fixDB(ctx, repo, db, os.Stdin, validateDBFlags.Yes)
+		}
+
 		issues, err := validateDB(ctx, repo, db.ReadTx())
 		if err != nil {
 			return err
@@ -55,7 +96,8 @@ func validateDB(ctx context.Context, repo *git.Repo, tx meta.ReadTx) ([]diagnost
 	branches := tx.AllBranches()
 	issues := make([]diagnosticIssue, 0)
 
-	for branchName, branch := range branches {
+	for _, branchName := range slices.Sorted(maps.Keys(branches)) {
+		branch := branches[branchName]
 		if branchName == "" {
 			continue
 		}
@@ -69,6 +111,7 @@ func validateDB(ctx context.Context, repo *git.Repo, tx meta.ReadTx) ([]diagnost
 				severity: diagnosticError,
 				branch:   branchName,
 				message:  "branch is missing from the Git repository",
+				fix:      dropBranchFix(ctx, repo, tx, branch),
 			})
 			continue
 		}
@@ -78,6 +121,7 @@ func validateDB(ctx context.Context, repo *git.Repo, tx meta.ReadTx) ([]diagnost
 				severity: diagnosticError,
 				branch:   branchName,
 				message:  "parent is empty but not marked as trunk",
+				fix:      reparentToTrunkFix(repo, branchName),
 			})
 		}
 
@@ -86,19 +130,266 @@ func validateDB(ctx context.Context, repo *git.Repo, tx meta.ReadTx) ([]diagnost
 				severity: diagnosticError,
 				branch:   branchName,
 				message:  "parent points to itself",
+				fix:      reparentToTrunkFix(repo, branchName),
 			})
 		} else if err := meta.ValidateNoCycle(tx, branchName, branch.Parent); err != nil {
-			issues = append(issues, diagnosticIssue{
+			issue := diagnosticIssue{
 				severity: diagnosticError,
 				branch:   branchName,
 				message:  err.Error(),
-			})
+			}
+			// If an ancestor further up is missing, the issue is fixed by
+			// reparenting the branch whose parent is missing.
+			if _, ok := tx.Branch(branch.Parent.Name); !ok || isCyclical(tx, branchName) {
+				issue.fix = reparentToTrunkFix(repo, branchName)
+			}
+			issues = append(issues, issue)
+		} else if issue := validateBranchingPoint(ctx, repo, branch); issue != nil {
+			issues = append(issues, *issue)
+		}
+
+		if issue := validatePullRequest(branch); issue != nil {
+			issues = append(issues, *issue)
 		}
 	}
 
 	return issues, nil
 }
 
+// isCyclical returns true if the branch is part of a parent cycle.
+func isCyclical(tx meta.ReadTx, branchName string) bool {
+	visited := map[string]bool{}
+	current := branchName
+	for !visited[current] {
+		visited[current] = true
+		branch, ok := tx.Branch(current)
+		if !ok || branch.Parent.Trunk {
+			return false
+		}
+		if branch.Parent.Name == branchName {
+			return true
+		}
+		current = branch.Parent.Name
+	}
+	return false
+}
+
+func validateBranchingPoint(ctx context.Context, repo *git.Repo, branch meta.Branch) *diagnosticIssue {
+	bp := branch.Parent.BranchingPointCommitHash
+	if branch.Parent.Trunk || bp == "" {
+		return nil
+	}
+	if ok, _ := repo.IsAncestor(ctx, bp, "refs/heads/"+branch.Name); ok {
+		return nil
+	}
+	issue := &diagnosticIssue{
+		severity: diagnosticWarning,
+		branch:   branch.Name,
+		message: fmt.Sprintf(
+			"branching point %s is not in the history of the branch",
+			git.ShortSha(bp),
+		),
+	}
+	issue.findFix = func() *diagnosticFix {
+		newBP, err := computeBranchingPoint(ctx, repo, branch.Parent.Name, branch.Name)
+		if err != nil || newBP == "" || newBP == bp {
+			return nil
+		}
+		return &diagnosticFix{
+			description: fmt.Sprintf("set the branching point to %s", git.ShortSha(newBP)),
+			apply: func(tx meta.WriteTx) {
+				br, _ := tx.Branch(branch.Name)
+				br.Parent.BranchingPointCommitHash = newBP
+				tx.SetBranch(br)
+			},
+		}
+	}
+	return issue
+}
+
+// computeBranchingPoint finds the commit where the branch forked from its
+// parent. The reflog of the parent is used if possible so that the original
+// fork point is found even if the parent was rebased afterwards.
+func computeBranchingPoint(ctx context.Context, repo *git.Repo, parent, branch string) (string, error) {
+	parentRef := "refs/heads/" + parent
+	branchRef := "refs/heads/" + branch
+	bp, err := repo.ForkPoint(ctx, parentRef, branchRef)
+	if err != nil || bp != "" {
+		return bp, err
+	}
+	return repo.MergeBase(ctx, parentRef, branchRef)
+}
+
+func validatePullRequest(branch meta.Branch) *diagnosticIssue {
+	pr := branch.PullRequest
+	if pr == nil {
+		return nil
+	}
+	var message string
+	switch {
+	case pr.ID == "" || pr.Number == 0:
+		message = "pull request entry is incomplete"
+	case pr.State == githubv4.PullRequestStateClosed && branch.MergeCommit == "":
+		message = fmt.Sprintf("pull request #%d is closed without being merged", pr.Number)
+	default:
+		return nil
+	}
+	return &diagnosticIssue{
+		severity: diagnosticWarning,
+		branch:   branch.Name,
+		message:  message,
+		fix: &diagnosticFix{
+			description: "clear the pull request entry",
+			apply: func(tx meta.WriteTx) {
+				br, _ := tx.Branch(branch.Name)
+				br.PullRequest = nil
+				tx.SetBranch(br)
+			},
+		},
+	}
+}
+
+func reparentToTrunkFix(repo *git.Repo, branchName string) *diagnosticFix {
+	trunk := repo.DefaultBranch()
+	return &diagnosticFix{
+		description: fmt.Sprintf("reparent the branch to the trunk %q", trunk),
+		apply: func(tx meta.WriteTx) {
+			br, _ := tx.Branch(branchName)
+			br.Parent = meta.BranchState{Name: trunk, Trunk: true}
+			tx.SetBranch(br)
+		},
+	}
+}
+
+func dropBranchFix(
+	ctx context.Context,
+	repo *git.Repo,
+	tx meta.ReadTx,
+	branch meta.Branch,
+) *diagnosticFix {
+	children := meta.Children(tx, branch.Name)
+	description := "remove the branch from the av metadata"
+	if len(children) > 0 {
+		description += fmt.Sprintf(" and reparent its children to %q", branch.Parent.Name)
+	}
+	// The branching points of the children are recomputed because they
+	// pointed to the removed branch.
+	bps := map[string]string{}
+	for _, child := range children {
+		if branch.Parent.Trunk {
+			continue
+		}
+		bp, err := computeBranchingPoint(ctx, repo, branch.Parent.Name, child.Name)
+		if err == nil {
+			bps[child.Name] = bp
+		}
+	}
+	return &diagnosticFix{
+		description: description,
+		apply: func(tx meta.WriteTx) {
+			for _, child := range meta.Children(tx, branch.Name) {
+				child.Parent = branch.Parent
+				child.Parent.BranchingPointCommitHash = bps[child.Name]
+				tx.SetBranch(child)
+			}
+			tx.DeleteBranch(branch.Name)
+		},
+	}
+}
+
+// fixDB proposes the repairs of the issues one by one and applies the accepted
+// ones. The metadata is validated again after each repair since a repair can
+// resolve other issues (e.g., breaking a cycle fixes all the branches in it).
+func fixDB(ctx context.Context, repo *git.Repo, db meta.DB, stdin io.Reader, yes bool) error {
+	tx := db.WriteTx()
+	defer tx.Abort()
+
+	reader := bufio.NewReader(stdin)
+	handled := map[string]bool{}
+	var applied []diagnosticIssue
+	all := yes
+loop:
+	for {
+		issues, err := validateDB(ctx, repo, tx)
+		if err != nil {
+			return err
+		}
+		idx := slices.IndexFunc(issues, func(issue diagnosticIssue) bool {
+			return (issue.fix != nil || issue.findFix != nil) && !handled[issue.branch+"\x00"+issue.message]
+		})
+		if idx < 0 {
+			break
+		}
+		issue := issues[idx]
+		handled[issue.branch+"\x00"+issue.message] = true
+		if issue.fix == nil {
+			if issue.fix = issue.findFix(); issue.fix == nil {
+				continue
+			}
+		}
+
+		fmt.Fprint(
+			os.Stderr,
+			"\n", colors.UserInput(issue.branch), ": ", issue.message, "\n",
+			"  Fix: ", issue.fix.description, "\n",
+		)
+		if !all {
+			switch promptFix(reader) {
+			case "n":
+				continue
+			case "a":
+				all = true
+			case "q":
+				break loop
+			}
+		}
+		issue.fix.apply(tx)
+		applied = append(applied, issue)
+	}
+
+	if len(applied) == 0 {
+		fmt.Fprint(os.Stderr, "\nNo fix was applied.\n")
+	} else {
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		fmt.Fprint(os.Stderr, "\n", colors.SuccessStyle.Render(fmt.Sprintf("✓ Applied %d fixes", len(applied))), "\n")
+		for _, issue := range applied {
+			fmt.Fprint(os.Stderr, "  - ", colors.UserInput(issue.branch), ": ", issue.fix.description, "\n")
+		}
+	}
+
+	issues, err := validateDB(ctx, repo, db.ReadTx())
+	if err != nil {
+		return err
+	}
+	_, _ = lipgloss.Print(renderValidation(issues))
+	return nil
+}
+
+// promptFix asks whether to apply a fix until a valid answer is given. Returns
+// "y", "n", "a", or "q". The end of the input is treated as "q".
+func promptFix(reader *bufio.Reader) string {
+	for {
+		fmt.Fprint(os.Stderr, "Apply this fix? [y]es/[n]o/[a]ll/[q]uit: ")
+		choice, err := reader.ReadString('\n')
+		if err != nil && strings.TrimSpace(choice) == "" {
+			fmt.Fprint(os.Stderr, "\n")
+			return "q"
+		}
+		switch strings.ToLower(strings.TrimSpace(choice)) {
+		case "y", "yes":
+			return "y"
+		case "n", "no":
+			return "n"
+		case "a", "all":
+			return "a"
+		case "q", "quit":
+			return "q"
+		}
+	}
+}
+
 func renderValidation(issues []diagnosticIssue) string {
 	if len(issues) == 0 {
 		return lipgloss.NewStyle().MarginTop(1).MarginBottom(1).MarginLeft(2).Render(
@@ -107,6 +398,7 @@ func renderValidation(issues []diagnosticIssue) string {
 	}
 
 	var errors, warnings []diagnosticIssue
+	fixable := 0
 	for _, issue := range issues {
 		switch issue.severity {
 		case diagnosticError:
@@ -114,6 +406,9 @@ func renderValidation(issues []diagnosticIssue) string {
 		case diagnosticWarning:
 			warnings = append(warnings, issue)
 		}
+		if issue.fix != nil || issue.findFix != nil {
+			fixable++
+		}
 	}
 
 	var ss []string
@@ -139,7 +434,25 @@ func renderValidation(issues []diagnosticIssue) string {
 		}
 	}
 
+	if fixable > 0 {
+		ss = append(ss, "")
+		ss = append(ss, colors.Faint(fmt.Sprintf(
+			"  %d of the issues can be repaired with av validate-db --fix", fixable,
+		)))
+	}
+
 	return lipgloss.NewStyle().MarginTop(1).MarginBottom(1).MarginLeft(2).Render(
 		lipgloss.JoinVertical(0, ss...),
 	) + "\n"
 }
+
+func init() {
+	validateDBCmd.Flags().BoolVar(
+		&validateDBFlags.Fix, "fix", false,
+		"propose and apply repairs for the issues",
+	)
+	validateDBCmd.Flags().BoolVarP(
+		&validateDBFlags.Yes, "yes", "y", false,
+		"with --fix, apply all the repairs without asking",
+	)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixDB(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	repo.Git(t, "checkout", "-b", "one")
+	repo.CommitFile(t, "one.txt", "one")
+	repo.Git(t, "checkout", "-b", "two")
+	repo.CommitFile(t, "two.txt", "two")
+	repo.Git(t, "checkout", "-b", "three")
+	repo.CommitFile(t, "three.txt", "three")
+	repo.Git(t, "checkout", "-b", "four")
+	repo.CommitFile(t, "four.txt", "four")
+	repo.Git(t, "checkout", "main")
+	repo.Git(t, "branch", "-D", "two")
+
+	db := repo.OpenDB(t)
+	tx := db.WriteTx()
+	tx.SetBranch(meta.Branch{Name: "one", Parent: meta.BranchState{Name: "main", Trunk: true}})
+	tx.SetBranch(meta.Branch{Name: "two", Parent: meta.BranchState{Name: "one"}})
+	tx.SetBranch(meta.Branch{
+		Name:        "three",
+		Parent:      meta.BranchState{Name: "two"},
+		PullRequest: &meta.PullRequest{Number: 3},
+	})
+	// A cycle between four and a branch that doesn't exist in Git.
+	tx.SetBranch(meta.Branch{Name: "four", Parent: meta.BranchState{Name: "five"}})
+	tx.SetBranch(meta.Branch{Name: "five", Parent: meta.BranchState{Name: "four"}})
+	require.NoError(t, tx.Commit())
+
+	avRepo := repo.AsAvGitRepo()
+	issues, err := validateDB(t.Context(), avRepo, db.ReadTx())
+	require.NoError(t, err)
+	require.NotEmpty(t, issues)
+
+	// Decline the first fix (dropping "five"), and accept the rest.
+	require.NoError(t, fixDB(t.Context(), avRepo, db, strings.NewReader("n\na\n"), false))
+
+	tx2 := db.ReadTx()
+	_, ok := tx2.Branch("two")
+	require.False(t, ok, "missing branch should be dropped")
+	three, _ := tx2.Branch("three")
+	require.Equal(t, "one", three.Parent.Name, "children should be reparented to the parent")
+	require.NotEmpty(t, three.Parent.BranchingPointCommitHash)
+	require.Nil(t, three.PullRequest, "incomplete pull request should be cleared")
+	four, _ := tx2.Branch("four")
+	require.True(t, four.Parent.Trunk, "cycle should be broken by reparenting to trunk")
+	_, ok = tx2.Branch("five")
+	require.True(t, ok, "declined fix should not be applied")
+}
+
+func TestFixDBBranchingPoint(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	repo.Git(t, "checkout", "-b", "other")
+	other := repo.CommitFile(t, "other.txt", "other")
+	repo.Git(t, "checkout", "main")
+	repo.Git(t, "checkout", "-b", "one")
+	repo.CommitFile(t, "one.txt", "one")
+	repo.Git(t, "checkout", "-b", "two")
+	repo.CommitFile(t, "two.txt", "two")
+	repo.Git(t, "checkout", "main")
+
+	db := repo.OpenDB(t)
+	tx := db.WriteTx()
+	tx.SetBranch(meta.Branch{Name: "one", Parent: meta.BranchState{Name: "main", Trunk: true}})
+	tx.SetBranch(meta.Branch{
+		Name:   "two",
+		Parent: meta.BranchState{Name: "one", BranchingPointCommitHash: other.String()},
+	})
+	require.NoError(t, tx.Commit())
+
+	// The fix is not computed without --fix.
+	avRepo := repo.AsAvGitRepo()
+	issues, err := validateDB(t.Context(), avRepo, db.ReadTx())
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	require.Nil(t, issues[0].fix)
+	require.NotNil(t, issues[0].findFix)
+
+	// An invalid answer is asked again.
+	require.NoError(t, fixDB(t.Context(), avRepo, db, strings.NewReader("maybe\ny\n"), false))
+
+	two, _ := db.ReadTx().Branch("two")
+	one := strings.TrimSpace(repo.Git(t, "rev-parse", "one"))
+	require.Equal(t, one, two.Parent.BranchingPointCommitHash)
+}
@@ -15,7 +15,10 @@ type mockLogger interface {
 
 const (
 	// These are ugly, but this is easy way to tell which query is being used.
-	prQuery = "query($after:String$baseRefName:String$first:Int!$headRefName:String$owner:String!$repo:String!$states:[PullRequestState!]){repository(owner: $owner, name: $repo){pullRequests(states: $states, headRefName: $headRefName, baseRefName: $baseRefName, first: $first, after: $after){nodes{id,number,headRefName,baseRefName,isDraft,permalink,state,title,body,author{login},createdAt,mergeCommit{oid},timelineItems(last: 10, itemTypes: [CLOSED_EVENT, MERGED_EVENT]){nodes{... on ClosedEvent{closer{... on Commit{oid}}},... on MergedEvent{commit{oid}}}}},pageInfo{endCursor,hasNextPage,hasPreviousPage,startCursor}}}}"
+	prQuery             = "query($after:String$baseRefName:String$first:Int!$headRefName:String$owner:String!$repo:String!$states:[PullRequestState!]){repository(owner: $owner, name: $repo){pullRequests(states: $states, headRefName: $headRefName, baseRefName: $baseRefName, first: $first, after: $after){nodes{id,number,headRefName,baseRefName,isDraft,permalink,state,title,body,author{login},createdAt,mergeCommit{oid},timelineItems(last: 10, itemTypes: [CLOSED_EVENT, MERGED_EVENT]){nodes{... on ClosedEvent{closer{... on Commit{oid}}},... on MergedEvent{commit{oid}}}}},pageInfo{endCursor,hasNextPage,hasPreviousPage,startCursor}}}}"
+	prReviewStatesQuery = "query($ids:[ID!]!){nodes(ids: $ids){... on PullRequest{id,number,isDraft,state,reviewDecision}}}"
+	addCommentMutation  = "mutation($input:AddCommentInput!){addComment(input: $input){clientMutationId}}"
+	closePRMutation     = "mutation($input:ClosePullRequestInput!){closePullRequest(input: $input){pullRequest{id,number,headRefName,baseRefName,isDraft,permalink,state,title,body,author{login},createdAt,mergeCommit{oid},timelineItems(last: 10, itemTypes: [CLOSED_EVENT, MERGED_EVENT]){nodes{... on ClosedEvent{closer{... on Commit{oid}}},... on MergedEvent{commit{oid}}}}}}}"
 )
 
 func RunMockGitHubServer(t *testing.T) *mockGitHubServer {
@@ -45,6 +48,8 @@ type mockPR struct {
 
 	MergeCommitOID  string
 	ClosedCommitOID string
+	ReviewDecision  string
+	Comments        []string
 }
 
 type graphqlRequest struct {
@@ -72,6 +77,33 @@ func (s *mockGitHubServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Query == prReviewStatesQuery {
+		s.t.Logf("Received PR review states query: %s", req.Variables)
+		if err := json.NewEncoder(w).Encode(s.handlePRReviewStatesQuery(req)); err != nil {
+			s.t.Logf("Failed to encode response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if req.Query == addCommentMutation {
+		s.t.Logf("Received addComment mutation: %s", req.Variables)
+		if err := json.NewEncoder(w).Encode(s.handleAddComment(req)); err != nil {
+			s.t.Logf("Failed to encode response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if req.Query == closePRMutation {
+		s.t.Logf("Received closePullRequest mutation: %s", req.Variables)
+		if err := json.NewEncoder(w).Encode(s.handleClosePR(req)); err != nil {
+			s.t.Logf("Failed to encode response: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
 	s.t.Logf("Received unexpected query: %s", req.Query)
 	w.WriteHeader(http.StatusInternalServerError)
 }
@@ -83,36 +115,7 @@ func (s *mockGitHubServer) handlePRQuery(req graphqlRequest) graphqlResponse {
 		if pr.HeadRefName != headRefName {
 			continue
 		}
-		gqlpr := map[string]any{
-			"id":          pr.ID,
-			"number":      pr.Number,
-			"headRefName": pr.HeadRefName,
-			"baseRefName": pr.BaseRefName,
-			"isDraft":     pr.IsDraft,
-			"permalink":   fmt.Sprintf("https://github.invalid/mock/mock/pulls/%d", pr.Number),
-			"state":       pr.State,
-			"title":       pr.Title,
-			"body":        pr.Body,
-			"author":      map[string]string{"login": "mock-user"},
-			"createdAt":   "2026-01-01T00:00:00Z",
-		}
-		if pr.MergeCommitOID != "" {
-			gqlpr["mergeCommit"] = map[string]string{"oid": pr.MergeCommitOID}
-		}
-		if pr.ClosedCommitOID != "" {
-			gqlpr["timelineItems"] = map[string]any{
-				"nodes": []any{
-					map[string]any{
-						"__typename": "ClosedEvent",
-						"closer": map[string]any{
-							"__typename": "Commit",
-							"oid":        pr.ClosedCommitOID,
-						},
-					},
-				},
-			}
-		}
-		prs = append(prs, gqlpr)
+		prs = append(prs, mockPRNode(pr))
 	}
 	return graphqlResponse{
 		Data: map[string]any{
@@ -124,3 +127,98 @@ func (s *mockGitHubServer) handlePRQuery(req graphqlRequest) graphqlResponse {
 		},
 	}
 }
+
+func (s *mockGitHubServer) handlePRReviewStatesQuery(req graphqlRequest) graphqlResponse {
+	ids, _ := req.Variables["ids"].([]any)
+	nodes := []any{}
+	for _, id := range ids {
+		var node any
+		for _, pr := range s.pulls {
+			if pr.ID != id {
+				continue
+			}
+			var reviewDecision any
+			if pr.ReviewDecision != "" {
+				reviewDecision = pr.ReviewDecision
+			}
+			node = map[string]any{
+				"id":             pr.ID,
+				"number":         pr.Number,
+				"isDraft":        pr.IsDraft,
+				"state":          pr.State,
+				"reviewDecision": reviewDecision,
+			}
+		}
+		nodes = append(nodes, node)
+	}
+	return graphqlResponse{
+		Data: map[string]any{
+			"nodes": nodes,
+		},
+	}
+}
+
+func (s *mockGitHubServer) handleAddComment(req graphqlRequest) graphqlResponse {
+	input, _ := req.Variables["input"].(map[string]any)
+	for i := range s.pulls {
+		if s.pulls[i].ID == input["subjectId"] {
+			body, _ := input["body"].(string)
+			s.pulls[i].Comments = append(s.pulls[i].Comments, body)
+		}
+	}
+	return graphqlResponse{
+		Data: map[string]any{
+			"addComment": map[string]any{"clientMutationId": nil},
+		},
+	}
+}
+
+func (s *mockGitHubServer) handleClosePR(req graphqlRequest) graphqlResponse {
+	input, _ := req.Variables["input"].(map[string]any)
+	var node any
+	for i := range s.pulls {
+		if s.pulls[i].ID == input["pullRequestId"] {
+			s.pulls[i].State = "CLOSED"
+			node = mockPRNode(s.pulls[i])
+		}
+	}
+	return graphqlResponse{
+		Data: map[string]any{
+			"closePullRequest": map[string]any{"pullRequest": node},
+		},
+	}
+}
+
+// mockPRNode returns the GraphQL PullRequest object of the mock PR.
+func mockPRNode(pr mockPR) map[string]any {
+	gqlpr := map[string]any{
+		"id":          pr.ID,
+		"number":      pr.Number,
+		"headRefName": pr.HeadRefName,
+		"baseRefName": pr.BaseRefName,
+		"isDraft":     pr.IsDraft,
+		"permalink":   fmt.Sprintf("https://github.invalid/mock/mock/pulls/%d", pr.Number),
+		"state":       pr.State,
+		"title":       pr.Title,
+		"body":        pr.Body,
+		"author":      map[string]string{"login": "mock-user"},
+		"createdAt":   "2026-01-01T00:00:00Z",
+	}
+	if pr.MergeCommitOID != "" {
+		gqlpr["mergeCommit"] = map[string]string{"oid": pr.MergeCommitOID}
+	}
+	if pr.ClosedCommitOID != "" {
+		gqlpr["timelineItems"] = map[string]any{
+			"nodes": []any{
+				map[string]any{
+					"__typename": "ClosedEvent",
+					"closer": map[string]any{
+						"__typename": "Commit",
+						"oid":        pr.ClosedCommitOID,
+					},
+				},
+			},
+		}
+	}
+	return gqlpr
+}
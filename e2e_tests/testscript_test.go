@@ -37,6 +37,8 @@ func TestScript(t *testing.T) {
 			"set-branch-pr":           cmdSetBranchPR,
 			"set-branch-merge-commit": cmdSetBranchMergeCommit,
 			"mock-pull":               cmdMockPull,
+			"mock-pull-review":        cmdMockPullReview,
+			"mock-pull-state":         cmdMockPullState,
 			"set-branch-prefix":       cmdSetBranchPrefix,
 		},
 	})
@@ -380,6 +382,65 @@ func cmdMockPull(ts *testscript.TestScript, neg bool, args []string) {
 	server.pulls = append(server.pulls, pr)
 }
 
+// mock-pull-review <number> <reviewDecision> [draft]
+//
+// Sets the review decision (e.g., APPROVED) and optionally the draft state of a
+// mock PR.
+func cmdMockPullReview(ts *testscript.TestScript, neg bool, args []string) {
+	if neg {
+		ts.Fatalf("mock-pull-review does not support negation")
+	}
+	if len(args) < 2 {
+		ts.Fatalf("usage: mock-pull-review <number> <reviewDecision> [draft]")
+	}
+	number, err := strconv.Atoi(args[0])
+	if err != nil {
+		ts.Fatalf("invalid number: %v", err)
+	}
+	server := ts.Value(mockServerKey{}).(*mockGitHubServer)
+	for i := range server.pulls {
+		if server.pulls[i].Number == number {
+			server.pulls[i].ReviewDecision = args[1]
+			server.pulls[i].IsDraft = len(args) >= 3 && args[2] == "draft"
+			return
+		}
+	}
+	ts.Fatalf("mock PR #%d not found", number)
+}
+
+// mock-pull-state <number> <state> [comment]
+//
+// Asserts the state of a mock PR and, if given, that the PR has a comment that
+// contains the given text.
+func cmdMockPullState(ts *testscript.TestScript, neg bool, args []string) {
+	if neg {
+		ts.Fatalf("mock-pull-state does not support negation")
+	}
+	if len(args) < 2 {
+		ts.Fatalf("usage: mock-pull-state <number> <state> [comment]")
+	}
+	number, err := strconv.Atoi(args[0])
+	if err != nil {
+		ts.Fatalf("invalid number: %v", err)
+	}
+	server := ts.Value(mockServerKey{}).(*mockGitHubServer)
+	for _, pr := range server.pulls {
+		if pr.Number != number {
+			continue
+		}
+		if pr.State != args[1] {
+			ts.Fatalf("mock PR #%d is %s, want %s", number, pr.State, args[1])
+		}
+		if len(args) >= 3 && !slices.ContainsFunc(pr.Comments, func(c string) bool {
+			return strings.Contains(c, args[2])
+		}) {
+			ts.Fatalf("mock PR #%d has no comment containing %q: %q", number, args[2], pr.Comments)
+		}
+		return
+	}
+	ts.Fatalf("mock PR #%d not found", number)
+}
+
 // set-branch-prefix <prefix>
 //
 // Updates the branchNamePrefix in the av config.
@@ -0,0 +1,449 @@
+// Package absorb distributes the staged changes to the commits of the stack
+// that last touched the changed lines, as if a fixup commit was created for
+// each of those commits and the stack was rebased with --autosquash.
+//
+// The commits are rewritten without touching the working tree: every commit
+// from the first fixed up commit to the tip of the current branch gets the
+// staged hunks that belong to it or to an earlier commit, merged into its tree
+// with `git merge-tree`. Since the hunks only touch lines that no later commit
+// touched, the merges don't conflict in practice.
+package absorb
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+)
+
+// Commit is a commit of the stack that can be fixed up.
+type Commit struct {
+	Hash   string
+	Branch string
+	git.Commit
+}
+
+// Assignment is a staged hunk and the commit that it's absorbed into.
+type Assignment struct {
+	File *FileDiff
+	// The hunk. Nil if the whole file cannot be absorbed (e.g., a new file).
+	Hunk *Hunk
+	// The commit that the hunk is absorbed into. Nil if the hunk cannot be
+	// attributed to a commit of the stack; Reason explains why.
+	Target *Commit
+	Reason string
+}
+
+// Plan is the result of attributing the staged hunks to the commits.
+type Plan struct {
+	// The current branch and its ancestor branches, starting from the stack
+	// root.
+	Branches []string
+	// The commits of Branches, oldest first.
+	Commits []*Commit
+	// The staged hunks in the order of the diff.
+	Assignments []*Assignment
+	// The commit of the current branch.
+	Head string
+
+	files []*FileDiff
+}
+
+// Absorbed returns the number of hunks that are absorbed.
+func (p *Plan) Absorbed() int {
+	n := 0
+	for _, a := range p.Assignments {
+		if a.Target != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// CreatePlan attributes each staged hunk to the most recent commit of the
+// current branch or its ancestor branches that last touched the lines of the
+// hunk (or, for added lines, the lines around them).
+func CreatePlan(ctx context.Context, repo *git.Repo, tx meta.ReadTx, branchName string) (*Plan, error) {
+	if _, ok := tx.Branch(branchName); !ok {
+		return nil, errors.Errorf("branch %q is not adopted to av", branchName)
+	}
+	previous, err := meta.PreviousBranches(tx, branchName)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{Branches: append(previous, branchName)}
+	plan.Head, err = repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + branchName})
+	if err != nil {
+		return nil, err
+	}
+	if err := plan.readCommits(ctx, repo, tx); err != nil {
+		return nil, err
+	}
+
+	out, err := repo.Run(ctx, &git.RunOpts{
+		Args: []string{
+			"diff", "--cached", "-U0", "--no-renames", "--no-color", "--no-ext-diff",
+			"--no-textconv", "--full-index", "HEAD",
+		},
+		ExitError: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	plan.files, err = ParseDiff(out.Stdout)
+	if err != nil {
+		return nil, errors.WrapIf(err, "failed to parse the staged changes")
+	}
+
+	index := map[string]int{}
+	for i, c := range plan.Commits {
+		index[c.Hash] = i
+	}
+	for _, f := range plan.files {
+		var reason string
+		switch {
+		case f.IsNew:
+			reason = "new file"
+		case f.IsBinary:
+			reason = "binary file"
+		case f.IsSubmodule:
+			reason = "submodule"
+		case len(f.Hunks) == 0:
+			reason = "file mode change"
+		}
+		var blame []string
+		if reason == "" {
+			blame, err = blameFile(ctx, repo, plan.Head, f.Path)
+			if err != nil {
+				reason = "cannot blame the file"
+			}
+		}
+		if reason != "" {
+			// The whole file is left staged.
+			plan.Assignments = append(plan.Assignments, &Assignment{File: f, Reason: reason})
+			continue
+		}
+		for _, h := range f.Hunks {
+			a := &Assignment{File: f, Hunk: h}
+			plan.Assignments = append(plan.Assignments, a)
+			target := -1
+			for _, line := range blameLinesOf(h, len(blame)-1) {
+				if line >= len(blame) {
+					continue
+				}
+				i, ok := index[blame[line]]
+				if !ok {
+					// Touched by a commit that is not in the stack. Since
+					// the commits of the stack are newer, it doesn't affect
+					// the most recent one.
+					continue
+				}
+				target = max(target, i)
+			}
+			if target < 0 {
+				a.Reason = "the lines were not changed in the stack"
+				continue
+			}
+			a.Target = plan.Commits[target]
+		}
+	}
+	return plan, nil
+}
+
+// readCommits reads the commits of the branches. The branches must be up to
+// date with their parents.
+func (p *Plan) readCommits(ctx context.Context, repo *git.Repo, tx meta.ReadTx) error {
+	for i, name := range p.Branches {
+		branch, _ := tx.Branch(name)
+		head, err := repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + name})
+		if err != nil {
+			return err
+		}
+		var base string
+		if i == 0 {
+			base, err = stackBase(ctx, repo, branch, head)
+			if err != nil {
+				return err
+			}
+		} else {
+			parentHead, err := repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + branch.Parent.Name})
+			if err != nil {
+				return err
+			}
+			if branch.Parent.BranchingPointCommitHash != parentHead {
+				return errors.Errorf(
+					"branch %q is not up to date with %q; run av restack first",
+					name, branch.Parent.Name,
+				)
+			}
+			base = parentHead
+		}
+		hashes, err := repo.RevList(ctx, git.RevListOpts{
+			Specifiers: []string{head, "^" + base},
+			Reverse:    true,
+		})
+		if err != nil {
+			return err
+		}
+		if len(hashes) == 0 {
+			continue
+		}
+		objects, err := repo.GetRefs(ctx, &git.GetRefs{Revisions: hashes})
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			commit, err := git.ParseCommitContents(obj.Contents)
+			if err != nil {
+				return errors.WrapIff(err, "parsing commit %s", obj.OID)
+			}
+			if len(commit.Parents) != 1 {
+				return errors.Errorf(
+					"commit %s of %q is a merge commit, which is not supported",
+					git.ShortSha(obj.OID), name,
+				)
+			}
+			p.Commits = append(p.Commits, &Commit{Hash: obj.OID, Branch: name, Commit: commit})
+		}
+	}
+	return nil
+}
+
+// stackBase returns the commit that the stack root is based on.
+func stackBase(ctx context.Context, repo *git.Repo, branch meta.Branch, head string) (string, error) {
+	if bp := branch.Parent.BranchingPointCommitHash; bp != "" {
+		return bp, nil
+	}
+	parentRef := "refs/remotes/" + repo.GetRemoteName() + "/" + branch.Parent.Name
+	if exists, err := repo.DoesRefExist(ctx, parentRef); err != nil || !exists {
+		parentRef = "refs/heads/" + branch.Parent.Name
+	}
+	return repo.MergeBase(ctx, parentRef, head)
+}
+
+// blameLinesOf returns the lines of the old file whose blame determines the
+// target of the hunk: the changed lines, or the lines around the added lines.
+func blameLinesOf(h *Hunk, numLines int) []int {
+	var lines []int
+	if h.OldLines > 0 {
+		for l := h.OldStart; l < h.OldStart+h.OldLines; l++ {
+			lines = append(lines, l)
+		}
+		return lines
+	}
+	// Lines are added after the line OldStart.
+	for _, l := range []int{h.OldStart, h.OldStart + 1} {
+		if l >= 1 && l <= numLines {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// blameFile returns the commit that last touched each line of the file. The
+// slice is indexed by the line number (starting from 1).
+func blameFile(ctx context.Context, repo *git.Repo, rev, path string) ([]string, error) {
+	out, err := repo.Run(ctx, &git.RunOpts{
+		Args:      []string{"blame", "--porcelain", rev, "--", path},
+		ExitError: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	blame := []string{""}
+	for _, line := range strings.Split(string(out.Stdout), "\n") {
+		// Each line of the file is preceded by
+		// "<commit> <original line> <final line>[ <lines in group>]".
+		fields := strings.Fields(line)
+		if len(fields) < 3 || len(fields[0]) < 40 || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		if _, err := strconv.ParseUint(fields[0][:8], 16, 32); err != nil {
+			continue
+		}
+		final, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		for len(blame) <= final {
+			blame = append(blame, "")
+		}
+		blame[final] = fields[0]
+	}
+	return blame, nil
+}
+
+// Result is the result of Apply.
+type Result struct {
+	// The new commit of each branch that was rewritten.
+	Branches map[string]string
+	// The branches in the order of the stack.
+	Order []string
+}
+
+// Apply rewrites the commits so that each absorbed hunk is included in its
+// target commit, and updates the branches and their metadata. The working
+// tree and the index are not modified; since the tip of the current branch
+// gets all the absorbed hunks, they're no longer shown as staged.
+func (p *Plan) Apply(ctx context.Context, repo *git.Repo, db meta.DB) (*Result, error) {
+	commitIdx := map[*Commit]int{}
+	for i, c := range p.Commits {
+		commitIdx[c] = i
+	}
+	// The index of the target commit of each absorbed hunk.
+	targetIdx := map[*Hunk]int{}
+	isTarget := map[int]bool{}
+	first := -1
+	for _, a := range p.Assignments {
+		if a.Target == nil {
+			continue
+		}
+		i := commitIdx[a.Target]
+		targetIdx[a.Hunk] = i
+		isTarget[i] = true
+		if first < 0 || i < first {
+			first = i
+		}
+	}
+	if first < 0 {
+		return nil, errors.New("nothing to absorb")
+	}
+
+	tmpDir, err := os.MkdirTemp(repo.AvTmpDir(), "absorb-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(tmpDir, "index")}
+
+	rewritten := map[string]string{}
+	parent := p.Commits[first].Parents[0]
+	var fixupCommit string
+	for i := first; i < len(p.Commits); i++ {
+		c := p.Commits[i]
+		if isTarget[i] {
+			// The set of the hunks grows at each target commit. Build the
+			// commit that has those hunks on top of the current HEAD.
+			fixupCommit, err = p.fixupCommit(ctx, repo, env, func(h *Hunk) bool {
+				ti, ok := targetIdx[h]
+				return ok && ti <= i
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		// Merge the hunks into the commit. Both sides are based on HEAD so
+		// that the merge base is HEAD (i.e., it's a cherry-pick of the
+		// fixups onto the commit).
+		ours, err := repo.CommitTree(ctx, &git.CommitTree{
+			Tree:    c.Tree,
+			Parents: []string{p.Head},
+			Message: "absorb\n",
+		})
+		if err != nil {
+			return nil, err
+		}
+		merged, err := repo.MergeTree(ctx, &git.MergeTree{Branch1: ours, Branch2: fixupCommit})
+		if err != nil {
+			return nil, err
+		}
+		if len(merged.ConflictedFiles) > 0 {
+			return nil, errors.Errorf(
+				"the staged changes conflict with commit %s (%s) in %s",
+				git.ShortSha(c.Hash), c.MessageTitle(), strings.Join(merged.ConflictedFiles, ", "),
+			)
+		}
+		newCommit, err := repo.CommitTree(ctx, &git.CommitTree{
+			Tree:    merged.Tree,
+			Parents: []string{parent},
+			Message: c.Message,
+			Author:  c.Author,
+		})
+		if err != nil {
+			return nil, err
+		}
+		rewritten[c.Hash] = newCommit
+		parent = newCommit
+	}
+
+	tx := db.WriteTx()
+	defer tx.Abort()
+	result := &Result{Branches: map[string]string{}}
+	var updates []*git.UpdateRef
+	var newParentHead string
+	for _, name := range p.Branches {
+		head, err := repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + name})
+		if err != nil {
+			return nil, err
+		}
+		branch, _ := tx.Branch(name)
+		if newParentHead != "" {
+			branch.Parent.BranchingPointCommitHash = newParentHead
+			tx.SetBranch(branch)
+		}
+		newHead, ok := rewritten[head]
+		if !ok {
+			continue
+		}
+		updates = append(updates, &git.UpdateRef{
+			Ref: "refs/heads/" + name,
+			New: newHead,
+			Old: head,
+		})
+		result.Branches[name] = newHead
+		result.Order = append(result.Order, name)
+		newParentHead = newHead
+	}
+	if err := repo.UpdateRefs(ctx, updates); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// fixupCommit creates a commit on top of HEAD that has the selected hunks.
+func (p *Plan) fixupCommit(
+	ctx context.Context,
+	repo *git.Repo,
+	env []string,
+	include func(*Hunk) bool,
+) (string, error) {
+	if _, err := repo.Run(ctx, &git.RunOpts{
+		Args:      []string{"read-tree", p.Head},
+		Env:       env,
+		ExitError: true,
+	}); err != nil {
+		return "", err
+	}
+	patch := Patch(p.files, func(_ *FileDiff, h *Hunk) bool { return include(h) })
+	if patch != "" {
+		if _, err := repo.Run(ctx, &git.RunOpts{
+			Args:      []string{"apply", "--cached", "--unidiff-zero", "-"},
+			Env:       env,
+			Stdin:     strings.NewReader(patch),
+			ExitError: true,
+		}); err != nil {
+			return "", errors.WrapIf(err, "failed to apply the staged changes")
+		}
+	}
+	tree, err := repo.Run(ctx, &git.RunOpts{
+		Args:      []string{"write-tree"},
+		Env:       env,
+		ExitError: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	return repo.CommitTree(ctx, &git.CommitTree{
+		Tree:    strings.TrimSpace(string(tree.Stdout)),
+		Parents: []string{p.Head},
+		Message: "fixup\n",
+	})
+}
@@ -0,0 +1,194 @@
+package absorb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// FileDiff is the diff of a single file in a patch generated by
+// `git diff -U0 --no-renames`.
+type FileDiff struct {
+	// The path of the file.
+	Path string
+	// The lines before the first hunk ("diff --git", "index", "---", "+++",
+	// etc.), including the trailing newline.
+	Header string
+	// True if the file is created or deleted by the diff.
+	IsNew, IsDeleted bool
+	// True if the file is a binary file.
+	IsBinary bool
+	// True if the file is a submodule.
+	IsSubmodule bool
+	Hunks       []*Hunk
+}
+
+// Hunk is a hunk of a FileDiff without context lines.
+type Hunk struct {
+	// The range of the lines in the old file. If OldLines is zero, the hunk
+	// adds lines after the line OldStart.
+	OldStart, OldLines int
+	// The range of the lines in the new file.
+	NewStart, NewLines int
+	// The hunk as it appears in the patch (starting with "@@").
+	Raw string
+}
+
+// Location returns a human-readable location of the hunk (e.g., "foo.go:10-12").
+func (h *Hunk) Location(path string) string {
+	start, n := h.NewStart, h.NewLines
+	if n == 0 {
+		// Deleted lines. Show the location in the old file.
+		start, n = h.OldStart, h.OldLines
+	}
+	if n <= 1 {
+		return fmt.Sprintf("%s:%d", path, start)
+	}
+	return fmt.Sprintf("%s:%d-%d", path, start, start+n-1)
+}
+
+// ParseDiff parses the output of `git diff -U0 --no-renames`.
+func ParseDiff(patch []byte) ([]*FileDiff, error) {
+	var files []*FileDiff
+	var file *FileDiff
+	var hunk *Hunk
+	var header strings.Builder
+	inHeader := false
+
+	s := bufio.NewScanner(bytes.NewReader(patch))
+	s.Buffer(nil, 64*1024*1024)
+	for s.Scan() {
+		line := s.Text()
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			if file != nil {
+				if inHeader {
+					file.Header = header.String()
+				}
+				files = append(files, file)
+			}
+			file = &FileDiff{Path: parseDiffGitPath(strings.TrimPrefix(line, "diff --git "))}
+			hunk = nil
+			header.Reset()
+			header.WriteString(line + "\n")
+			inHeader = true
+		case file == nil:
+			return nil, errors.Errorf("unexpected line before the first file: %q", line)
+		case strings.HasPrefix(line, "@@ "):
+			if inHeader {
+				file.Header = header.String()
+				inHeader = false
+			}
+			hunk = &Hunk{Raw: line + "\n"}
+			if err := parseHunkHeader(line, hunk); err != nil {
+				return nil, err
+			}
+			file.Hunks = append(file.Hunks, hunk)
+		case inHeader:
+			header.WriteString(line + "\n")
+			switch {
+			case strings.HasPrefix(line, "new file mode "):
+				file.IsNew = true
+			case strings.HasPrefix(line, "deleted file mode "):
+				file.IsDeleted = true
+			case strings.HasPrefix(line, "Binary files ") || line == "GIT binary patch":
+				file.IsBinary = true
+			case strings.HasPrefix(line, "index ") && strings.HasSuffix(line, " 160000"):
+				file.IsSubmodule = true
+			case strings.HasPrefix(line, "+++ ") && line != "+++ /dev/null":
+				file.Path = diffPath(strings.TrimPrefix(line, "+++ "))
+			case strings.HasPrefix(line, "--- ") && line != "--- /dev/null":
+				file.Path = diffPath(strings.TrimPrefix(line, "--- "))
+			}
+		default:
+			hunk.Raw += line + "\n"
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if file != nil {
+		if inHeader {
+			file.Header = header.String()
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// parseDiffGitPath parses the path from "a/<path> b/<path>". With
+// --no-renames, both paths are the same.
+func parseDiffGitPath(s string) string {
+	n := (len(s) - 1) / 2
+	return diffPath(s[n+1:])
+}
+
+// diffPath returns the path of "a/<path>" or "b/<path>". The path is unquoted
+// if Git quoted it because it has special characters.
+func diffPath(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		if u, err := strconv.Unquote(s); err == nil {
+			s = u
+		}
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		return s[2:]
+	}
+	return s
+}
+
+func parseHunkHeader(line string, hunk *Hunk) error {
+	// @@ -<start>[,<lines>] +<start>[,<lines>] @@ ...
+	fields := strings.Fields(line)
+	if len(fields) < 4 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return errors.Errorf("invalid hunk header: %q", line)
+	}
+	var err error
+	if hunk.OldStart, hunk.OldLines, err = parseHunkRange(fields[1][1:]); err != nil {
+		return errors.WrapIff(err, "invalid hunk header: %q", line)
+	}
+	if hunk.NewStart, hunk.NewLines, err = parseHunkRange(fields[2][1:]); err != nil {
+		return errors.WrapIff(err, "invalid hunk header: %q", line)
+	}
+	return nil
+}
+
+func parseHunkRange(s string) (start, lines int, err error) {
+	startStr, linesStr, ok := strings.Cut(s, ",")
+	if start, err = strconv.Atoi(startStr); err != nil {
+		return 0, 0, err
+	}
+	if !ok {
+		return start, 1, nil
+	}
+	if lines, err = strconv.Atoi(linesStr); err != nil {
+		return 0, 0, err
+	}
+	return start, lines, nil
+}
+
+// Patch returns a patch that contains only the given hunks of the files. The
+// patch must be applied with `git apply --unidiff-zero`.
+func Patch(files []*FileDiff, include func(*FileDiff, *Hunk) bool) string {
+	var sb strings.Builder
+	for _, f := range files {
+		var hunks []string
+		for _, h := range f.Hunks {
+			if include(f, h) {
+				hunks = append(hunks, h.Raw)
+			}
+		}
+		if len(hunks) == 0 {
+			continue
+		}
+		sb.WriteString(f.Header)
+		for _, h := range hunks {
+			sb.WriteString(h)
+		}
+	}
+	return sb.String()
+}
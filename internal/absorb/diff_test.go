@@ -0,0 +1,82 @@
+package absorb
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPatch = `diff --git a/a.txt b/a.txt
+index 1111111111111111111111111111111111111111..2222222222222222222222222222222222222222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -3 +3 @@ a2
+-a3
++A3
+@@ -5,0 +6,2 @@ a5
++a6
++a7
+diff --git a/new.txt b/new.txt
+new file mode 100644
+index 0000000000000000000000000000000000000000..3333333333333333333333333333333333333333
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++new
+diff --git "a/sp ace\tx.txt" "b/sp ace\tx.txt"
+deleted file mode 100644
+index 4444444444444444444444444444444444444444..0000000000000000000000000000000000000000
+--- "a/sp ace\tx.txt"
++++ /dev/null
+@@ -1,2 +0,0 @@
+-x
+-y
+\ No newline at end of file
+diff --git a/img.png b/img.png
+index 5555555555555555555555555555555555555555..6666666666666666666666666666666666666666 100644
+Binary files a/img.png and b/img.png differ
+`
+
+func TestParseDiff(t *testing.T) {
+	files, err := ParseDiff([]byte(testPatch))
+	require.NoError(t, err)
+	require.Len(t, files, 4)
+
+	a := files[0]
+	assert.Equal(t, "a.txt", a.Path)
+	require.Len(t, a.Hunks, 2)
+	assert.Equal(t, Hunk{OldStart: 3, OldLines: 1, NewStart: 3, NewLines: 1, Raw: "@@ -3 +3 @@ a2\n-a3\n+A3\n"}, *a.Hunks[0])
+	assert.Equal(t, 5, a.Hunks[1].OldStart)
+	assert.Equal(t, 0, a.Hunks[1].OldLines)
+	assert.Equal(t, "a.txt:3", a.Hunks[0].Location(a.Path))
+	assert.Equal(t, "a.txt:6-7", a.Hunks[1].Location(a.Path))
+
+	assert.Equal(t, "new.txt", files[1].Path)
+	assert.True(t, files[1].IsNew)
+
+	assert.Equal(t, "sp ace\tx.txt", files[2].Path)
+	assert.True(t, files[2].IsDeleted)
+	assert.Equal(t, "-x\n-y\n\\ No newline at end of file\n", files[2].Hunks[0].Raw[len("@@ -1,2 +0,0 @@\n"):])
+	assert.Equal(t, "sp ace\tx.txt:1-2", files[2].Hunks[0].Location(files[2].Path))
+
+	assert.Equal(t, "img.png", files[3].Path)
+	assert.True(t, files[3].IsBinary)
+	assert.Empty(t, files[3].Hunks)
+}
+
+func TestPatch(t *testing.T) {
+	files, err := ParseDiff([]byte(testPatch))
+	require.NoError(t, err)
+	patch := Patch(files, func(f *FileDiff, h *Hunk) bool {
+		return f.Path == "a.txt" && h.OldStart == 5
+	})
+	assert.Equal(t, `diff --git a/a.txt b/a.txt
+index 1111111111111111111111111111111111111111..2222222222222222222222222222222222222222 100644
+--- a/a.txt
++++ b/a.txt
+@@ -5,0 +6,2 @@ a5
++a6
++a7
+`, patch)
+}
@@ -195,10 +195,11 @@ func CreatePullRequest(
 
 		if opts.ForcePush {
 			pushFlags = append(pushFlags, "--force")
-		} else {
+		} else if !config.Av.Sync.UseMerge() {
 			// Use --force-with-lease to allow pushing branches that have been
 			// rebased but don't overwrite changes if we don't expect them to
-			// be there.
+			// be there. With the merge strategy, the branches are never
+			// rewritten, so the push should be a fast-forward.
 			pushFlags = append(pushFlags, "--force-with-lease")
 		}
 
@@ -304,7 +305,12 @@ func CreatePullRequest(
 		}
 	}
 
-	if opts.Edit || (opts.Body == "" && opts.Title == "") {
+	launchEditor := opts.Edit || (opts.Body == "" && opts.Title == "")
+	// Use the branch description (see `av branch describe`) as the body of a
+	// new pull request unless another body is given (or saved below).
+	useDescription := existingPR == nil
+
+	if launchEditor {
 		var commits []git.CommitInfo
 		for commitHash := range strings.SplitSeq(commitsList, "\n") {
 			commit, err := repo.CommitInfo(ctx, git.CommitInfoOpts{Rev: commitHash})
@@ -333,6 +339,9 @@ func CreatePullRequest(
 				}
 			}
 		}
+		if useDescription && opts.Body == "" {
+			opts.Body = branchMeta.Description
+		}
 
 		// Try to populate the editor text using contextual information from the
 		// repository and commits included in this pull request.
@@ -383,6 +392,8 @@ func CreatePullRequest(
 			// lost forever (and we can reuse it if they try again).
 			savePRDescriptionToTemporaryFile(saveFile, res)
 		}()
+	} else if useDescription && opts.Body == "" {
+		opts.Body = branchMeta.Description
 	}
 	if opts.Title == "" {
 		return nil, errors.New("aborting pull request due to empty message")
@@ -892,6 +903,19 @@ func AddPRMetadataAndStack(
 		sb.WriteString("</summary>")
 		sb.WriteString("\n\n")
 		sb.WriteString(stackString)
+		if config.Av.PullRequest.WriteStackMermaid {
+			// The commit counts are omitted since they would go stale as soon
+			// as a branch is pushed without updating the comment.
+			sb.WriteString("\n```mermaid\n")
+			sb.WriteString(stackutils.RenderMermaid(
+				[]*stackutils.StackTreeNode{stack},
+				branchName,
+				func(name string, isTrunk bool) []string {
+					return stackutils.GraphNodeLabel(tx, name, isTrunk, -1)
+				},
+			))
+			sb.WriteString("```\n")
+		}
 		sb.WriteString("</details>")
 		sb.WriteString("</td></tr></table>\n")
 		sb.WriteString(PRStackCommentEnd)
@@ -4,9 +4,11 @@ import (
 	"testing"
 
 	"github.com/aviator-co/av/internal/actions"
+	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/utils/maputils"
 	"github.com/aviator-co/av/internal/utils/stackutils"
+	"github.com/shurcooL/githubv4"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -246,6 +248,56 @@ This information is embedded by the av CLI when creating PRs to track the status
 `, body1)
 }
 
+func TestPRWithStackMermaid(t *testing.T) {
+	config.Av.PullRequest.WriteStackMermaid = true
+	t.Cleanup(func() { config.Av.PullRequest.WriteStackMermaid = false })
+
+	tx := fakeReadTx{
+		"baz": {
+			Name:   "baz",
+			Parent: meta.BranchState{Name: "main", Trunk: true},
+			PullRequest: &meta.PullRequest{
+				Number: 1001,
+				State:  githubv4.PullRequestStateMerged,
+			},
+		},
+		"foo": {
+			Name:   "foo",
+			Parent: meta.BranchState{Name: "baz"},
+			PullRequest: &meta.PullRequest{
+				Number: 1002,
+				State:  githubv4.PullRequestStateOpen,
+			},
+		},
+	}
+	stack := &stackutils.StackTreeNode{
+		Branch: &stackutils.StackTreeBranchInfo{BranchName: "main"},
+		Children: []*stackutils.StackTreeNode{
+			{
+				Branch: &stackutils.StackTreeBranchInfo{BranchName: "baz"},
+				Children: []*stackutils.StackTreeNode{
+					{Branch: &stackutils.StackTreeBranchInfo{BranchName: "foo"}},
+				},
+			},
+		},
+	}
+	body := actions.AddPRMetadataAndStack("Hello!", actions.PRMetadata{}, "foo", stack, tx)
+	assert.Contains(t, body, `* **#1001**
+* `+"`"+`main`+"`"+`
+
+`+"```"+`mermaid
+flowchart TD
+    n0["main"]
+    n1["baz<br/>#1001 merged"]
+    n2["foo<br/>#1002 open"]
+    n0 --> n1
+    n1 --> n2
+    classDef current stroke-width:3px
+    class n2 current
+`+"```"+`
+</details>`)
+}
+
 type fakeReadTx map[string]meta.Branch
 
 func (tx fakeReadTx) Repository() meta.Repository {
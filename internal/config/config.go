@@ -42,12 +42,52 @@ type PullRequest struct {
 	// If true, the CLI will automatically add/update a comment to all PRs linking other PRs in the stack.
 	// False by default, since Aviator's MergeQueue also adds a similar comment.
 	WriteStack bool
+
+	// If true, the stack comment written by WriteStack also includes a Mermaid
+	// diagram of the stack, which GitHub renders as a graph.
+	WriteStackMermaid bool
 }
 
 type Sync struct {
 	// If true, fast-forward the local trunk branch to match the remote
 	// tracking branch after syncing.
 	FastForwardTrunk bool
+	// If true, share the av branch metadata (parent branches, pull requests,
+	// etc.) with the remote via the refs/av/meta/* refs when running av fetch
+	// and av sync. Other clones with this option enabled pick up the stack
+	// structure of the branches that they have locally.
+	ShareMetadata bool
+	// How the branches are updated when their parent branch changes. Either
+	// SyncStrategyRebase (default) or SyncStrategyMerge. With the merge
+	// strategy, the parent branch is merged into the child branches instead of
+	// rebasing them, so that the branches are never rewritten and can be
+	// pushed without force pushes.
+	Strategy string
+	// The default of the --autostash flag of sync, restack, reparent, reorder
+	// and squash. If true, the local changes in the current worktree are
+	// stashed before the branches are rewritten and restored afterward.
+	Autostash bool
+	// If true, --autostash also stashes the local changes in the other
+	// worktrees whose branches are restacked, instead of skipping the
+	// branches.
+	AutostashWorktrees bool
+	// If true, the branches that are checked out in other worktrees are
+	// restacked in those worktrees (running git there) instead of detaching
+	// the worktrees. The local changes in the worktrees are kept with the
+	// --autostash of git rebase / git merge, so the branches are not skipped
+	// even if the worktrees are dirty.
+	RestackInWorktrees bool
+}
+
+const (
+	SyncStrategyRebase = "rebase"
+	SyncStrategyMerge  = "merge"
+)
+
+// UseMerge returns true if the branches should be updated by merging the parent
+// branch instead of rebasing.
+func (s Sync) UseMerge() bool {
+	return s.Strategy == SyncStrategyMerge
 }
 
 type Aviator struct {
@@ -139,6 +179,14 @@ func loadFromFile(repoConfigDir string) error {
 	if err := config.Unmarshal(&Av); err != nil {
 		return errors.Wrap(err, "failed to read av configs")
 	}
+	switch Av.Sync.Strategy {
+	case "", SyncStrategyRebase, SyncStrategyMerge:
+	default:
+		return errors.Errorf(
+			"invalid sync.strategy %q (must be %q or %q)",
+			Av.Sync.Strategy, SyncStrategyRebase, SyncStrategyMerge,
+		)
+	}
 	return nil
 }
 
@@ -304,16 +304,21 @@ func (vm *GitHubPushModel) runGitPush() error {
 		}
 		chunk := vm.pushCandidates[start:end]
 		pushArgs := []string{"push", vm.repo.GetRemoteName(), "--atomic"}
-		for _, branch := range chunk {
-			// Do a compare-and-swap to be strict on what we show as a difference.
-			pushArgs = append(
-				pushArgs,
-				fmt.Sprintf(
-					"--force-with-lease=%s:%s",
-					branch.branch.String(),
-					branch.remoteCommit.Hash.String(),
-				),
-			)
+		// The branches are never rewritten with the merge strategy. Push without
+		// forcing so that a non-fast-forward update is rejected instead of
+		// overwriting the remote branch.
+		if !avconfig.Av.Sync.UseMerge() {
+			for _, branch := range chunk {
+				// Do a compare-and-swap to be strict on what we show as a difference.
+				pushArgs = append(
+					pushArgs,
+					fmt.Sprintf(
+						"--force-with-lease=%s:%s",
+						branch.branch.String(),
+						branch.remoteCommit.Hash.String(),
+					),
+				)
+			}
 		}
 		for _, branch := range chunk {
 			// Push the exact commit hash to be strict on what we show as a difference.
@@ -291,6 +291,36 @@ func (c *Client) MarkPullRequestReadyForReview(
 	return &mutation.MarkPullRequestReadyForReview.PullRequest, nil
 }
 
+// ClosePullRequest closes the pull request without merging it.
+func (c *Client) ClosePullRequest(ctx context.Context, id string) (*PullRequest, error) {
+	var mutation struct {
+		ClosePullRequest struct {
+			PullRequest PullRequest
+		} `graphql:"closePullRequest(input: $input)"`
+	}
+	if err := c.mutate(ctx, &mutation, githubv4.ClosePullRequestInput{PullRequestID: id}, nil); err != nil {
+		return nil, errors.Wrap(err, "failed to close pull request: github error")
+	}
+	return &mutation.ClosePullRequest.PullRequest, nil
+}
+
+// AddComment adds a comment to the pull request (or issue) with the given node
+// ID.
+func (c *Client) AddComment(ctx context.Context, subjectID string, body string) error {
+	var mutation struct {
+		AddComment struct {
+			ClientMutationID string
+		} `graphql:"addComment(input: $input)"`
+	}
+	if err := c.mutate(ctx, &mutation, githubv4.AddCommentInput{
+		SubjectID: subjectID,
+		Body:      githubv4.String(body),
+	}, nil); err != nil {
+		return errors.Wrap(err, "failed to add comment: github error")
+	}
+	return nil
+}
+
 type RepoPullRequestOpts struct {
 	Owner  string
 	Repo   string
@@ -344,3 +374,49 @@ func (c *Client) RepoPullRequests(
 		PullRequests: query.Repository.PullRequests.Nodes,
 	}, nil
 }
+
+// PullRequestReviewState is the draft and review state of a pull request.
+type PullRequestReviewState struct {
+	ID             string
+	Number         int64
+	IsDraft        bool
+	State          githubv4.PullRequestState
+	ReviewDecision githubv4.PullRequestReviewDecision
+}
+
+// pullRequestReviewStatesBatchSize is the maximum number of nodes that GitHub
+// returns for a single nodes(ids:) query.
+const pullRequestReviewStatesBatchSize = 100
+
+// PullRequestReviewStates returns the review states of the pull requests with
+// the given node IDs. This fetches the pull requests in as few queries as
+// possible. The pull requests that cannot be found are omitted.
+func (c *Client) PullRequestReviewStates(
+	ctx context.Context,
+	ids []string,
+) ([]PullRequestReviewState, error) {
+	var ret []PullRequestReviewState
+	for start := 0; start < len(ids); start += pullRequestReviewStatesBatchSize {
+		end := min(start+pullRequestReviewStatesBatchSize, len(ids))
+		gqlIDs := make([]githubv4.ID, 0, end-start)
+		for _, id := range ids[start:end] {
+			gqlIDs = append(gqlIDs, githubv4.ID(id))
+		}
+		var query struct {
+			Nodes []struct {
+				PullRequest PullRequestReviewState `graphql:"... on PullRequest"`
+			} `graphql:"nodes(ids: $ids)"`
+		}
+		if err := c.query(ctx, &query, map[string]any{
+			"ids": gqlIDs,
+		}); err != nil {
+			return nil, errors.Wrap(err, "failed to query pull request review states")
+		}
+		for _, node := range query.Nodes {
+			if node.PullRequest.ID != "" {
+				ret = append(ret, node.PullRequest)
+			}
+		}
+	}
+	return ret, nil
+}
@@ -3,6 +3,9 @@ package git
 import (
 	"context"
 	"fmt"
+	"strings"
+
+	"emperror.dev/errors"
 )
 
 // BranchDelete deletes the given branches (equivalent to `git branch -D`).
@@ -33,3 +36,23 @@ func (r *Repo) BranchSetUpstream(ctx context.Context, branch, remote string) err
 	})
 	return err
 }
+
+// BranchGetConfig returns a config of the given branch (equivalent to `git
+// config branch.<branch>.<key>`). Returns an empty string if the config is not
+// set.
+func (r *Repo) BranchGetConfig(ctx context.Context, name, key string) (string, error) {
+	out, err := r.Run(ctx, &RunOpts{
+		Args: []string{"config", "--get", fmt.Sprintf("branch.%s.%s", name, key)},
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.ExitCode == 1 {
+		// The config is not set.
+		return "", nil
+	}
+	if out.ExitCode != 0 {
+		return "", errors.Errorf("git config failed: %s", out.Stderr)
+	}
+	return strings.TrimSpace(string(out.Stdout)), nil
+}
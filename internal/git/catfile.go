@@ -139,7 +139,7 @@ func ParseCommitContents(contents []byte) (Commit, error) {
 			break
 		}
 
-		meta, value, ok := strings.Cut(line, " ")
+		meta, value, ok := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
 		if !ok {
 			return commit, errors.New("invalid commit format")
 		}
@@ -0,0 +1,56 @@
+package git
+
+import (
+	"context"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+type CommitTree struct {
+	// The tree object of the commit.
+	Tree string
+	// The parent commits.
+	Parents []string
+	// The commit message.
+	Message string
+	// The author identity in the format of the commit object header (e.g.,
+	// "Jane Doe <jane@example.com> 1700000000 +0000"). If empty, the
+	// current user and time are used.
+	Author string
+}
+
+// CommitTree creates a commit object with the given tree and parents without
+// touching the index or the working tree (equivalent to `git commit-tree`).
+// Returns the hash of the new commit.
+func (r *Repo) CommitTree(ctx context.Context, opts *CommitTree) (string, error) {
+	args := []string{"commit-tree", opts.Tree}
+	for _, p := range opts.Parents {
+		args = append(args, "-p", p)
+	}
+	// Read the message from stdin so that it's used verbatim.
+	args = append(args, "-F", "-")
+	var env []string
+	if opts.Author != "" {
+		name, rest, ok := strings.Cut(opts.Author, " <")
+		email, date, ok2 := strings.Cut(rest, "> ")
+		if !ok || !ok2 {
+			return "", errors.Errorf("invalid author identity %q", opts.Author)
+		}
+		env = append(env,
+			"GIT_AUTHOR_NAME="+name,
+			"GIT_AUTHOR_EMAIL="+email,
+			"GIT_AUTHOR_DATE="+date,
+		)
+	}
+	out, err := r.Run(ctx, &RunOpts{
+		Args:      args,
+		Env:       env,
+		Stdin:     strings.NewReader(opts.Message),
+		ExitError: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out.Stdout)), nil
+}
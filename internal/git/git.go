@@ -477,6 +477,37 @@ func (r *Repo) UpdateRef(ctx context.Context, update *UpdateRef) error {
 	return errors.WrapIff(err, "failed to write ref %q (%s)", update.Ref, ShortSha(update.New))
 }
 
+// UpdateRefs updates the specified refs in a single transaction: either all
+// the refs are updated or none of them are. An update with an empty New
+// deletes the ref. If Old is specified, the ref is verified to have that value
+// before updating (the zero OID means that the ref must not exist).
+func (r *Repo) UpdateRefs(ctx context.Context, updates []*UpdateRef) error {
+	var sb strings.Builder
+	for _, u := range updates {
+		if u.New == "" {
+			fmt.Fprintf(&sb, "delete %s", u.Ref)
+		} else {
+			fmt.Fprintf(&sb, "update %s %s", u.Ref, u.New)
+		}
+		if u.Old != "" {
+			fmt.Fprintf(&sb, " %s", u.Old)
+		}
+		sb.WriteString("\n")
+	}
+	_, err := r.Run(ctx, &RunOpts{
+		Args:      []string{"update-ref", "--stdin"},
+		Stdin:     strings.NewReader(sb.String()),
+		ExitError: true,
+	})
+	return errors.WrapIf(err, "failed to update refs")
+}
+
+// DeleteRef deletes the specified ref within the Git repository.
+func (r *Repo) DeleteRef(ctx context.Context, ref string) error {
+	_, err := r.Git(ctx, "update-ref", "-d", ref)
+	return errors.WrapIff(err, "failed to delete ref %q", ref)
+}
+
 type Origin struct {
 	URL *url.URL
 	// The URL slug that corresponds to repository.
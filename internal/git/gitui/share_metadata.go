@@ -0,0 +1,104 @@
+package gitui
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/meta/refmeta"
+	"github.com/aviator-co/av/internal/utils/colors"
+)
+
+// ShareMetadataModel is a Bubbletea model that pulls the av branch metadata
+// from the remote (or pushes it to the remote) via the refs/av/meta/* refs.
+type ShareMetadataModel struct {
+	repo   *git.Repo
+	db     meta.DB
+	push   bool
+	onDone func() tea.Cmd
+
+	result *refmeta.Result
+}
+
+type shareMetadataDone struct {
+	result *refmeta.Result
+}
+
+func NewShareMetadataModel(
+	repo *git.Repo,
+	db meta.DB,
+	push bool,
+	onDone func() tea.Cmd,
+) *ShareMetadataModel {
+	return &ShareMetadataModel{
+		repo:   repo,
+		db:     db,
+		push:   push,
+		onDone: onDone,
+	}
+}
+
+func (m *ShareMetadataModel) Init() tea.Cmd {
+	return m.run
+}
+
+func (m *ShareMetadataModel) run() tea.Msg {
+	ctx := context.Background()
+	var res *refmeta.Result
+	var err error
+	if m.push {
+		res, err = refmeta.Push(ctx, m.repo, m.db)
+	} else {
+		res, err = refmeta.Pull(ctx, m.repo, m.db)
+	}
+	if err != nil {
+		return err
+	}
+	return shareMetadataDone{result: res}
+}
+
+func (m *ShareMetadataModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case shareMetadataDone:
+		m.result = msg.result
+		return m, m.onDone()
+	}
+	return m, nil
+}
+
+func (m *ShareMetadataModel) View() tea.View {
+	if m.result == nil {
+		if m.push {
+			return tea.NewView(colors.ProgressStyle.Render("Pushing av metadata...") + "\n")
+		}
+		return tea.NewView(colors.ProgressStyle.Render("Pulling av metadata...") + "\n")
+	}
+	return tea.NewView(ShareMetadataResultView(m.result, m.push))
+}
+
+// ShareMetadataResultView renders the result of a metadata synchronization.
+func ShareMetadataResultView(res *refmeta.Result, push bool) string {
+	var sb strings.Builder
+	if push {
+		if len(res.Pushed) == 0 {
+			sb.WriteString(colors.SuccessStyle.Render("✓ av metadata is up-to-date on the remote") + "\n")
+		} else {
+			sb.WriteString(colors.SuccessStyle.Render(
+				fmt.Sprintf("✓ Pushed av metadata of %d branches", len(res.Pushed)),
+			) + "\n")
+		}
+		return sb.String()
+	}
+	sb.WriteString(colors.SuccessStyle.Render(
+		fmt.Sprintf("✓ Pulled av metadata (%d updated, %d deleted)", len(res.Updated), len(res.Deleted)),
+	) + "\n")
+	for _, c := range res.Conflicts {
+		sb.WriteString("  " + colors.Warning(
+			fmt.Sprintf("%s: %q was modified on both sides, keeping the local value", c.Branch, c.Field),
+		) + "\n")
+	}
+	return sb.String()
+}
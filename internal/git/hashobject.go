@@ -0,0 +1,21 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"strings"
+)
+
+// HashObject writes the given data into the object database as a blob and
+// returns the object ID (equivalent to `git hash-object -w --stdin`).
+func (r *Repo) HashObject(ctx context.Context, data []byte) (string, error) {
+	out, err := r.Run(ctx, &RunOpts{
+		Args:      []string{"hash-object", "-w", "--stdin"},
+		Stdin:     bytes.NewReader(data),
+		ExitError: true,
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out.Stdout)), nil
+}
@@ -0,0 +1,95 @@
+package git
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+type MergeOpts struct {
+	// The commit to merge into the current branch. Required unless Continue
+	// or Abort is true.
+	Commit string
+	// The message of the merge commit.
+	Message string
+	// If set, use `git merge --autostash` to stash the local changes during
+	// the merge.
+	Autostash bool
+	// Optional (mutually exclusive with all other options)
+	// If set, conclude a merge that stopped with conflicts.
+	Continue bool
+	// Optional (mutually exclusive with all other options)
+	Abort bool
+}
+
+var mergeConflictRegex = regexp.MustCompile(`(?m)^CONFLICT .+$`)
+
+// MergeParse runs a `git merge` and parses the output into a RebaseResult, so
+// that a merge can be handled the same way as a rebase.
+func (r *Repo) MergeParse(ctx context.Context, opts MergeOpts) (*RebaseResult, error) {
+	var runOpts *RunOpts
+	switch {
+	case opts.Continue:
+		runOpts = &RunOpts{
+			Args: []string{"merge", "--continue"},
+			// Use the prepared merge message without opening an editor.
+			Env: []string{"GIT_EDITOR=true"},
+		}
+	case opts.Abort:
+		runOpts = &RunOpts{Args: []string{"merge", "--abort"}}
+	default:
+		args := []string{"merge", "--no-edit"}
+		if opts.Message != "" {
+			args = append(args, "-m", opts.Message)
+		}
+		if opts.Autostash {
+			args = append(args, "--autostash")
+		}
+		runOpts = &RunOpts{Args: append(args, opts.Commit)}
+	}
+	out, err := r.Run(ctx, runOpts)
+	if err != nil {
+		return nil, err
+	}
+	stdout := string(out.Stdout)
+	stderr := string(out.Stderr)
+	if out.ExitCode == 0 {
+		switch {
+		case opts.Abort:
+			return &RebaseResult{Status: RebaseAborted}, nil
+		case strings.Contains(stdout, "Already up to date"):
+			return &RebaseResult{Status: RebaseAlreadyUpToDate}, nil
+		}
+		return &RebaseResult{Status: RebaseUpdated}, nil
+	}
+	if strings.Contains(stderr, "MERGE_HEAD missing") {
+		return &RebaseResult{Status: RebaseNotInProgress}, nil
+	}
+	conflicts := mergeConflictRegex.FindAllString(stdout, -1)
+	if len(conflicts) == 0 {
+		logrus.WithField("exit_code", out.ExitCode).
+			Warn("unexpected output from git merge with non-zero exit code (assuming merge had conflicts): ", stderr)
+		return &RebaseResult{
+			Status: RebaseConflict,
+			Hint:   stdout + stderr,
+		}, nil
+	}
+	return &RebaseResult{
+		Status:        RebaseConflict,
+		Hint:          strings.Join(conflicts, "\n"),
+		ErrorHeadline: "could not merge " + ShortSha(opts.Commit),
+	}, nil
+}
+
+// IsMergeInProgress reports whether git has an in-progress merge.
+// `.git/MERGE_HEAD` is removed by `git merge --abort` / `--continue`, so this is
+// also a way to detect whether a previously-conflicted merge has since been
+// aborted.
+func (r *Repo) IsMergeInProgress() bool {
+	stat, err := os.Stat(filepath.Join(r.WorktreeGitDir(), "MERGE_HEAD"))
+	return err == nil && !stat.IsDir()
+}
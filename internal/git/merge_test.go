@@ -0,0 +1,36 @@
+package git_test
+
+import (
+	"testing"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo_MergeParse(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	avRepo := repo.AsAvGitRepo()
+
+	repo.CommitFile(t, "file", "a\n")
+	repo.Git(t, "checkout", "-b", "other")
+	other := repo.CommitFile(t, "file", "a\nb\n")
+	repo.Git(t, "checkout", "-")
+	repo.CommitFile(t, "file", "a\nc\n")
+
+	res, err := avRepo.MergeParse(t.Context(), git.MergeOpts{Commit: other.String()})
+	require.NoError(t, err)
+	assert.Equal(t, git.RebaseConflict, res.Status)
+	assert.Contains(t, res.Hint, "Merge conflict in file")
+	assert.True(t, avRepo.IsMergeInProgress())
+
+	res, err = avRepo.MergeParse(t.Context(), git.MergeOpts{Abort: true})
+	require.NoError(t, err)
+	assert.Equal(t, git.RebaseAborted, res.Status)
+	assert.False(t, avRepo.IsMergeInProgress())
+
+	res, err = avRepo.MergeParse(t.Context(), git.MergeOpts{Continue: true})
+	require.NoError(t, err)
+	assert.Equal(t, git.RebaseNotInProgress, res.Status)
+}
@@ -1,6 +1,9 @@
 package git
 
-import "context"
+import (
+	"context"
+	"strings"
+)
 
 func (r *Repo) IsAncestor(ctx context.Context, ancestor, descendant string) (bool, error) {
 	out, err := r.Run(ctx, &RunOpts{
@@ -14,3 +17,21 @@ func (r *Repo) IsAncestor(ctx context.Context, ancestor, descendant string) (boo
 	}
 	return out.ExitCode == 0, nil
 }
+
+// ForkPoint returns the commit at which the branch forked from the upstream,
+// taking the reflog of the upstream into account (see the --fork-point option
+// of git-merge-base(1)). This finds the original fork point even if the
+// upstream was rebased afterwards. Returns an empty string if the fork point
+// cannot be determined from the reflog.
+func (r *Repo) ForkPoint(ctx context.Context, upstream, branch string) (string, error) {
+	out, err := r.Run(ctx, &RunOpts{
+		Args: []string{"merge-base", "--fork-point", upstream, branch},
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.ExitCode != 0 {
+		return "", nil
+	}
+	return strings.TrimSpace(string(out.Stdout)), nil
+}
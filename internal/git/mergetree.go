@@ -0,0 +1,86 @@
+package git
+
+import (
+	"context"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+type MergeTree struct {
+	// The two commits to merge.
+	Branch1, Branch2 string
+	// The merge base. If empty, the merge base is computed from the history
+	// of the two commits.
+	MergeBase string
+}
+
+type MergeTreeResult struct {
+	// The tree object of the merge result. If there are conflicts, the tree
+	// contains the files with the conflict markers.
+	Tree string
+	// The files that have conflicts.
+	ConflictedFiles []string
+}
+
+// MergeTree merges two commits without touching the index or the working tree
+// (equivalent to `git merge-tree --write-tree`). Requires Git 2.38 or later.
+func (r *Repo) MergeTree(ctx context.Context, opts *MergeTree) (*MergeTreeResult, error) {
+	branch1, branch2 := opts.Branch1, opts.Branch2
+	if opts.MergeBase != "" {
+		// `git merge-tree --merge-base` requires Git 2.40. Instead, merge
+		// the trees of the commits re-parented onto a parentless commit of the
+		// merge base tree, so that it's the only merge base.
+		base, err := r.CommitTree(ctx, &CommitTree{
+			Tree:    opts.MergeBase + "^{tree}",
+			Message: "merge base\n",
+		})
+		if err != nil {
+			return nil, err
+		}
+		if branch1, err = r.CommitTree(ctx, &CommitTree{
+			Tree:    branch1 + "^{tree}",
+			Parents: []string{base},
+			Message: "ours\n",
+		}); err != nil {
+			return nil, err
+		}
+		if branch2, err = r.CommitTree(ctx, &CommitTree{
+			Tree:    branch2 + "^{tree}",
+			Parents: []string{base},
+			Message: "theirs\n",
+		}); err != nil {
+			return nil, err
+		}
+	}
+	out, err := r.Run(ctx, &RunOpts{
+		Args: []string{
+			"merge-tree", "--write-tree", "--name-only", "--no-messages",
+			branch1, branch2,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Exit code 1 means that the merge has conflicts. Other non-zero exit codes
+	// are errors.
+	if out.ExitCode != 0 && out.ExitCode != 1 {
+		return nil, errors.Errorf(
+			"git merge-tree failed: %s",
+			strings.TrimSpace(string(out.Stderr)),
+		)
+	}
+	lines := out.Lines()
+	if len(lines) == 0 {
+		return nil, errors.New("git merge-tree returned no tree")
+	}
+	ret := &MergeTreeResult{Tree: lines[0]}
+	if out.ExitCode == 1 {
+		for _, l := range lines[1:] {
+			if l != "" {
+				ret.ConflictedFiles = append(ret.ConflictedFiles, l)
+			}
+		}
+	}
+	return ret, nil
+}
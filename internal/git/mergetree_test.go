@@ -0,0 +1,44 @@
+package git_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepo_MergeTreeWithMergeBase(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	avRepo := repo.AsAvGitRepo()
+
+	c1 := repo.CommitFile(t, "file", "a\nb\nc\nd\ne\nf\ng\nh\n")
+	c2 := repo.CommitFile(t, "file", "a\nB\nc\nd\ne\nf\ng\nh\n")
+	c3 := repo.CommitFile(t, "file", "a\nB\nc\nd\ne\nf\nG\nh\n")
+	c4 := repo.CommitFile(t, "file", "a\nX\nc\nd\ne\nf\nG\nh\n")
+
+	// Cherry-pick c3 onto c1. Only the change of c3 is applied.
+	res, err := avRepo.MergeTree(t.Context(), &git.MergeTree{
+		Branch1:   c1.String(),
+		Branch2:   c3.String(),
+		MergeBase: c2.String(),
+	})
+	require.NoError(t, err)
+	assert.Empty(t, res.ConflictedFiles)
+	assert.Equal(
+		t,
+		"a\nb\nc\nd\ne\nf\nG\nh",
+		strings.TrimSpace(repo.Git(t, "cat-file", "blob", res.Tree+":file")),
+	)
+
+	// Cherry-pick c4 onto c1. c4 changes the line that c1 doesn't have.
+	res, err = avRepo.MergeTree(t.Context(), &git.MergeTree{
+		Branch1:   c1.String(),
+		Branch2:   c4.String(),
+		MergeBase: c3.String(),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file"}, res.ConflictedFiles)
+}
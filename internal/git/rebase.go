@@ -26,6 +26,10 @@ type RebaseOpts struct {
 	// If set, this is the branch that will be rebased; otherwise, the current
 	// branch is rebased.
 	Branch string
+	// Optional
+	// If set, use `git rebase --autostash` to stash the local changes during
+	// the rebase.
+	Autostash bool
 }
 
 func (r *Repo) Rebase(ctx context.Context, opts RebaseOpts) (*Output, error) {
@@ -50,6 +54,9 @@ func (r *Repo) Rebase(ctx context.Context, opts RebaseOpts) (*Output, error) {
 			Args: []string{"rebase", "--skip"},
 		})
 	}
+	if opts.Autostash {
+		args = append(args, "--autostash")
+	}
 	if opts.Onto != "" {
 		args = append(args, "--onto", opts.Onto)
 	}
@@ -1,6 +1,12 @@
 package git
 
-import "context"
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"emperror.dev/errors"
+)
 
 type RevListOpts struct {
 	// A list of commit roots, or exclusions if the commit sha starts with a
@@ -35,3 +41,20 @@ func (r *Repo) RevList(ctx context.Context, opts RevListOpts) ([]string, error)
 	}
 	return res.Lines(), nil
 }
+
+// AheadBehind returns the number of commits that are reachable from head but
+// not from base (ahead) and the number of commits that are reachable from base
+// but not from head (behind).
+func (r *Repo) AheadBehind(ctx context.Context, base, head string) (ahead int, behind int, err error) {
+	res, err := r.Run(ctx, &RunOpts{
+		Args:      []string{"rev-list", "--left-right", "--count", base + "..." + head, "--"},
+		ExitError: true,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(res.Stdout)), "%d\t%d", &behind, &ahead); err != nil {
+		return 0, 0, errors.WrapIff(err, "unexpected git rev-list output %q", res.Stdout)
+	}
+	return ahead, behind, nil
+}
@@ -0,0 +1,88 @@
+package git
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"emperror.dev/errors"
+)
+
+// StashPush stashes the local changes of the worktree and resets the worktree
+// to HEAD. Returns the stash commit, or an empty string if there was nothing to
+// stash.
+//
+// The stash is added to the stash list (`git stash list`) as well, so that the
+// changes are not lost even if they cannot be restored automatically.
+func StashPush(ctx context.Context, worktreePath, message string, includeUntracked bool) (string, error) {
+	before, err := stashTop(ctx, worktreePath)
+	if err != nil {
+		return "", err
+	}
+	args := []string{"-C", worktreePath, "stash", "push", "--quiet", "--message", message}
+	if includeUntracked {
+		args = append(args, "--include-untracked")
+	}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", errors.Errorf("failed to stash the changes in %s: %s", worktreePath, string(out))
+	}
+	after, err := stashTop(ctx, worktreePath)
+	if err != nil {
+		return "", err
+	}
+	if after == before {
+		// Nothing was stashed.
+		return "", nil
+	}
+	return after, nil
+}
+
+// StashRestore applies the stash created by StashPush to the worktree and drops
+// it from the stash list. The staged changes are restored to the index, unless
+// that fails (e.g., the index cannot be restored on top of the new HEAD), in
+// which case they are restored as unstaged changes. If the stash cannot be
+// applied cleanly, it's kept in the stash list and an error is returned.
+func StashRestore(ctx context.Context, worktreePath, stash string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", worktreePath, "stash", "apply", "--quiet", "--index", stash)
+	if _, err := cmd.CombinedOutput(); err != nil {
+		cmd := exec.CommandContext(ctx, "git", "-C", worktreePath, "stash", "apply", "--quiet", stash)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return errors.Errorf(
+				"failed to restore the stashed changes in %s (the changes are kept in `git stash list`): %s",
+				worktreePath, strings.TrimSpace(string(out)),
+			)
+		}
+	}
+	cmd = exec.CommandContext(ctx, "git", "-C", worktreePath, "stash", "list", "--format=%H")
+	out, err := cmd.Output()
+	if err != nil {
+		return errors.Errorf("failed to list the stashes in %s: %v", worktreePath, err)
+	}
+	for i, h := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if h != stash {
+			continue
+		}
+		cmd := exec.CommandContext(ctx, "git", "-C", worktreePath, "stash", "drop", "--quiet", "stash@{"+strconv.Itoa(i)+"}")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return errors.Errorf("failed to drop the stash in %s: %s", worktreePath, string(out))
+		}
+		break
+	}
+	return nil
+}
+
+func stashTop(ctx context.Context, worktreePath string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", worktreePath, "rev-parse", "--verify", "--quiet", "refs/stash")
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			// No stash.
+			return "", nil
+		}
+		return "", errors.Errorf("failed to read the stash in %s: %v", worktreePath, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,78 @@
+package git_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStash(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	repo.CommitFile(t, "file", "a\n")
+
+	// Nothing to stash.
+	stash, err := git.StashPush(t.Context(), repo.RepoDir, "av autostash", false)
+	require.NoError(t, err)
+	assert.Empty(t, stash)
+
+	// Untracked files are stashed only if requested.
+	repo.CreateFile(t, "untracked", "u\n")
+	stash, err = git.StashPush(t.Context(), repo.RepoDir, "av autostash", false)
+	require.NoError(t, err)
+	assert.Empty(t, stash)
+
+	repo.CreateFile(t, "file", "b\n")
+	stash, err = git.StashPush(t.Context(), repo.RepoDir, "av autostash", true)
+	require.NoError(t, err)
+	assert.NotEmpty(t, stash)
+	assert.True(t, repo.IsWorkdirClean(t))
+
+	// Another stash on top of it is kept when restoring.
+	repo.CreateFile(t, "file", "c\n")
+	repo.Git(t, "stash", "push", "--quiet")
+
+	require.NoError(t, git.StashRestore(t.Context(), repo.RepoDir, stash))
+	assert.Equal(t, " M file\n?? untracked\n", repo.Git(t, "status", "--porcelain"))
+	assert.Equal(t, "1\n", repo.Git(t, "rev-list", "--walk-reflogs", "--count", "refs/stash"))
+
+	// A stash that conflicts with the worktree is kept.
+	stash, err = git.StashPush(t.Context(), repo.RepoDir, "av autostash", true)
+	require.NoError(t, err)
+	repo.CommitFile(t, "file", "d\n")
+	repo.CreateFile(t, "untracked", "u\n")
+	require.Error(t, git.StashRestore(t.Context(), repo.RepoDir, stash))
+	assert.Equal(t, "2\n", repo.Git(t, "rev-list", "--walk-reflogs", "--count", "refs/stash"))
+}
+
+func TestStashRestoreIndex(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	repo.CommitFile(t, "file", "1\n2\n3\n4\n")
+	repo.CommitFile(t, "other", "a\n")
+
+	repo.CreateFile(t, "file", "x\n2\n3\n4\n")
+	repo.Git(t, "add", "file")
+	repo.CreateFile(t, "other", "b\n")
+	stash, err := git.StashPush(t.Context(), repo.RepoDir, "av autostash", false)
+	require.NoError(t, err)
+
+	// The staged change is restored to the index.
+	require.NoError(t, git.StashRestore(t.Context(), repo.RepoDir, stash))
+	assert.Equal(t, "M  file\n M other\n", repo.Git(t, "status", "--porcelain"))
+
+	// If the staged change cannot be applied to the index of the new HEAD
+	// (the context of the change is modified), it's restored as an unstaged
+	// change.
+	stash, err = git.StashPush(t.Context(), repo.RepoDir, "av autostash", false)
+	require.NoError(t, err)
+	repo.CommitFile(t, "file", "1\n2\ny\n4\n")
+	require.NoError(t, git.StashRestore(t.Context(), repo.RepoDir, stash))
+	assert.Equal(t, " M file\n M other\n", repo.Git(t, "status", "--porcelain"))
+	content, err := os.ReadFile(filepath.Join(repo.RepoDir, "file"))
+	require.NoError(t, err)
+	assert.Equal(t, "x\n2\ny\n4\n", string(content))
+}
@@ -13,6 +13,7 @@ const (
 	StateFileKindReorder StateFileKind = "stack-reorder.state.json"
 	StateFileKindRestack StateFileKind = "stack-restack.state.json"
 	StateFileKindSyncV2  StateFileKind = "stack-sync-v2.state.json"
+	StateFileKindJournal StateFileKind = "journal-pending.state.json"
 )
 
 func (r *Repo) stateFilePath(kind StateFileKind) string {
@@ -1,8 +1,19 @@
 package git
 
+import "strings"
+
 func ShortSha(sha string) string {
 	if len(sha) > 7 {
 		return sha[:7]
 	}
 	return sha
 }
+
+// ZeroOID returns the null object ID (see Missing) with the same length as the
+// given object ID, since SHA-1 and SHA-256 object IDs have different lengths.
+func ZeroOID(oid string) string {
+	if len(oid) == 0 {
+		return Missing
+	}
+	return strings.Repeat("0", len(oid))
+}
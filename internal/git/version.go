@@ -39,6 +39,19 @@ func parseGitVersion(out string) (int, int, error) {
 	return major, minor, nil
 }
 
+// SupportsMergeTreeWriteTree reports whether `git merge-tree --write-tree`
+// (see MergeTree) is available. It was introduced in git 2.38.
+func (r *Repo) SupportsMergeTreeWriteTree(ctx context.Context) bool {
+	major, minor, err := r.Version(ctx)
+	if err != nil {
+		// Unlike the hook flag, the callers have a fallback that works with
+		// any git, so assume an old git.
+		r.log.WithError(err).Debug("failed to determine git version")
+		return false
+	}
+	return major > 2 || (major == 2 && minor >= 38)
+}
+
 // HookRunArgs returns the arguments to pass to `git` to run a custom
 // (non-native) hook. The --allow-unknown-hook-name flag is appended on git
 // 2.54+, which introduced it and simultaneously began rejecting non-native
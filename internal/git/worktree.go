@@ -48,6 +48,20 @@ func (r *Repo) WorktreeList(ctx context.Context) ([]WorktreeInfo, error) {
 	return worktrees, nil
 }
 
+// OpenWorktree opens another worktree of the repository. Returns the repo
+// itself if the path is the current worktree.
+func (r *Repo) OpenWorktree(ctx context.Context, worktreePath string) (*Repo, error) {
+	if worktreePath == r.Dir() {
+		return r, nil
+	}
+	cmd := exec.CommandContext(ctx, "git", "-C", worktreePath, "rev-parse", "--path-format=absolute", "--git-dir")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Errorf("failed to open the worktree at %s: %v", worktreePath, err)
+	}
+	return OpenRepo(worktreePath, r.GitDir(), strings.TrimSpace(string(out)))
+}
+
 func DetachWorktreeHEAD(ctx context.Context, worktreePath string) error {
 	cmd := exec.CommandContext(ctx, "git", "-C", worktreePath, "checkout", "--detach")
 	if out, err := cmd.CombinedOutput(); err != nil {
@@ -72,3 +86,22 @@ func IsWorktreeClean(ctx context.Context, worktreePath string) (bool, error) {
 	}
 	return strings.TrimSpace(string(out)) == "", nil
 }
+
+// WorktreeAdd creates a new worktree at the path with a detached HEAD at the
+// given commit.
+func (r *Repo) WorktreeAdd(ctx context.Context, path string, commit string) error {
+	_, err := r.Run(ctx, &RunOpts{
+		Args:      []string{"worktree", "add", "--detach", "--quiet", path, commit},
+		ExitError: true,
+	})
+	return err
+}
+
+// WorktreeRemove removes the worktree at the path even if it has changes.
+func (r *Repo) WorktreeRemove(ctx context.Context, path string) error {
+	_, err := r.Run(ctx, &RunOpts{
+		Args:      []string{"worktree", "remove", "--force", path},
+		ExitError: true,
+	})
+	return err
+}
@@ -0,0 +1,474 @@
+// Package journal records the changes that av commands make to the branches
+// and the av metadata so that they can be reverted with `av undo`.
+//
+// An operation starts with Begin, which takes a snapshot of all the local
+// branches and the branch metadata, and ends with Finish, which compares the
+// snapshot with the current state and appends an Entry to the journal. If the
+// command is interrupted by a conflict, the snapshot is kept in a per-worktree
+// state file until the command is continued, so that an operation that spans
+// multiple invocations (e.g., `av sync` followed by `av sync --continue`) is
+// recorded as a single entry.
+package journal
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/sequencer"
+	"github.com/aviator-co/av/internal/sequencer/sequencerui"
+	"github.com/sirupsen/logrus"
+)
+
+// maxEntries is the number of entries that are kept in the journal. Older
+// entries are discarded.
+const maxEntries = 50
+
+// Entry is a record of a single operation.
+type Entry struct {
+	// ID is a sequential number that identifies the entry.
+	ID int `json:"id"`
+	// Command is the command line of the operation (e.g., "av sync --all").
+	Command string `json:"command"`
+	// Time is the time when the operation started.
+	Time time.Time `json:"time"`
+	// Head is the branch that was checked out when the operation started.
+	// Empty if the HEAD was detached.
+	Head string `json:"head,omitempty"`
+	// Refs is the list of the branches whose commit was changed by the
+	// operation.
+	Refs []RefChange `json:"refs,omitempty"`
+	// Metadata is the list of the branches whose metadata was changed by the
+	// operation.
+	Metadata []MetadataChange `json:"metadata,omitempty"`
+}
+
+// RefChange is a change to a branch ref.
+type RefChange struct {
+	Branch string `json:"branch"`
+	// Before is the commit hash of the branch before the operation. Empty if
+	// the branch was created by the operation.
+	Before string `json:"before,omitempty"`
+	// After is the commit hash of the branch after the operation. Empty if the
+	// branch was deleted by the operation.
+	After string `json:"after,omitempty"`
+}
+
+// MetadataChange is a change to the metadata of a branch.
+type MetadataChange struct {
+	Branch string `json:"branch"`
+	// Before is the metadata of the branch before the operation. Nil if the
+	// branch was not managed by av before the operation.
+	Before *meta.Branch `json:"before,omitempty"`
+}
+
+// Operation is an in-progress operation started by Begin.
+type Operation struct {
+	Command  string                 `json:"command"`
+	Time     time.Time              `json:"time"`
+	Head     string                 `json:"head,omitempty"`
+	Refs     map[string]string      `json:"refs"`
+	Branches map[string]meta.Branch `json:"branches"`
+
+	// home is the worktree that keeps the snapshot while the operation is
+	// interrupted.
+	home *git.Repo
+}
+
+// Begin starts recording an operation.
+//
+// If an operation was interrupted in this worktree (by a rebase or
+// cherry-pick conflict) and is still in progress, that operation is resumed
+// instead so that its original snapshot is used. The same goes for an
+// operation started in another worktree that stopped with a conflict in this
+// worktree (a branch restacked in place with sync.restackInWorktrees).
+func Begin(ctx context.Context, repo *git.Repo, db meta.DB, command string) (*Operation, error) {
+	var op Operation
+	home := repo
+	err := home.ReadStateFile(git.StateFileKindJournal, &op)
+	if os.IsNotExist(err) && (repo.IsRebaseInProgress() || repo.IsMergeInProgress()) {
+		if home = homeWorktree(ctx, repo); home != repo {
+			err = home.ReadStateFile(git.StateFileKindJournal, &op)
+		}
+	}
+	if err == nil {
+		if isInterrupted(ctx, home) {
+			logrus.WithField("command", op.Command).Debug("resuming an interrupted operation")
+			op.home = home
+			return &op, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	refs, err := branchRefs(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	status, err := repo.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Operation{
+		Command:  command,
+		Time:     time.Now(),
+		Head:     status.CurrentBranch,
+		Refs:     refs,
+		Branches: db.ReadTx().AllBranches(),
+		home:     repo,
+	}, nil
+}
+
+// Finish finishes recording the operation. If the operation is interrupted by
+// a conflict, the snapshot is saved so that the operation can be resumed by
+// the next Begin. Otherwise, the changes are appended to the journal.
+func (op *Operation) Finish(ctx context.Context, repo *git.Repo, db meta.DB) error {
+	home := op.home
+	if home == nil {
+		home = repo
+	}
+	if isInterrupted(ctx, home) {
+		return home.WriteStateFile(git.StateFileKindJournal, op)
+	}
+	if err := home.WriteStateFile(git.StateFileKindJournal, nil); err != nil {
+		return err
+	}
+
+	refs, err := branchRefs(ctx, repo)
+	if err != nil {
+		return err
+	}
+	entry := Entry{Command: op.Command, Time: op.Time, Head: op.Head}
+	for _, name := range sortedKeys(op.Refs, refs) {
+		if op.Refs[name] != refs[name] {
+			entry.Refs = append(entry.Refs, RefChange{
+				Branch: name,
+				Before: op.Refs[name],
+				After:  refs[name],
+			})
+		}
+	}
+	branches := db.ReadTx().AllBranches()
+	for _, name := range sortedKeys(op.Branches, branches) {
+		before, existed := op.Branches[name]
+		after, exists := branches[name]
+		if existed == exists && equal(before, after) {
+			continue
+		}
+		change := MetadataChange{Branch: name}
+		if existed {
+			change.Before = &before
+		}
+		entry.Metadata = append(entry.Metadata, change)
+	}
+	if len(entry.Refs) == 0 && len(entry.Metadata) == 0 {
+		return nil
+	}
+
+	entries, err := List(repo)
+	if err != nil {
+		return err
+	}
+	entry.ID = 1
+	if len(entries) > 0 {
+		entry.ID = entries[len(entries)-1].ID + 1
+	}
+	entries = append(entries, entry)
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+	return write(repo, entries)
+}
+
+// List returns the journal entries, oldest first.
+func List(repo *git.Repo) ([]Entry, error) {
+	bs, err := os.ReadFile(journalPath(repo))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	if err := json.Unmarshal(bs, &entries); err != nil {
+		return nil, errors.WrapIff(err, "failed to read the operation journal %q", journalPath(repo))
+	}
+	return entries, nil
+}
+
+// UndoOpts are the options for Undo.
+type UndoOpts struct {
+	// Force restores the branches even if they were modified after the
+	// operation.
+	Force bool
+}
+
+// Undo reverts the last operation in the journal and removes it from the
+// journal. The branch refs are restored in a single transaction, followed by
+// the metadata.
+func Undo(ctx context.Context, repo *git.Repo, db meta.DB, opts UndoOpts) (*Entry, error) {
+	if isInterrupted(ctx, repo) {
+		return nil, errors.New(
+			"a rebase or cherry-pick is in progress; please finish or abort it first",
+		)
+	}
+	entries, err := List(repo)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("there is no operation to undo")
+	}
+	entry := entries[len(entries)-1]
+
+	refs, err := branchRefs(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
+	var modified []string
+	for _, rc := range entry.Refs {
+		if refs[rc.Branch] != rc.After {
+			modified = append(modified, rc.Branch)
+		}
+	}
+	if len(modified) > 0 && !opts.Force {
+		return nil, errors.Errorf(
+			"the following branches were modified after %q: %s\n"+
+				"use --force to restore them anyway",
+			entry.Command, strings.Join(modified, ", "),
+		)
+	}
+
+	status, err := repo.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	worktrees, err := repo.WorktreeList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	checkedOutElsewhere := map[string]string{}
+	for _, wt := range worktrees {
+		if wt.Branch != "" && wt.Branch != status.CurrentBranch {
+			checkedOutElsewhere[wt.Branch] = wt.Path
+		}
+	}
+	touchesCurrent := false
+	var updates []*git.UpdateRef
+	for _, rc := range entry.Refs {
+		if path, ok := checkedOutElsewhere[rc.Branch]; ok {
+			return nil, errors.Errorf(
+				"branch %q is checked out in another worktree (%s); please switch it to another branch first",
+				rc.Branch, path,
+			)
+		}
+		if rc.Branch == status.CurrentBranch {
+			touchesCurrent = true
+		}
+		u := &git.UpdateRef{Ref: "refs/heads/" + rc.Branch, New: rc.Before}
+		if !opts.Force {
+			u.Old = rc.After
+			if u.Old == "" {
+				u.Old = git.ZeroOID(rc.Before)
+			}
+		}
+		updates = append(updates, u)
+	}
+	if touchesCurrent && !status.IsCleanIgnoringUntracked() {
+		return nil, errors.Errorf(
+			"branch %q has uncommitted changes; please commit or stash them first",
+			status.CurrentBranch,
+		)
+	}
+
+	// Move away from the current branch while its ref is updated so that the
+	// working tree is checked out again afterwards.
+	if touchesCurrent {
+		if err := repo.Detach(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err := repo.UpdateRefs(ctx, updates); err != nil {
+		return nil, err
+	}
+
+	tx := db.WriteTx()
+	for _, mc := range entry.Metadata {
+		if mc.Before == nil {
+			tx.DeleteBranch(mc.Branch)
+		} else {
+			tx.SetBranch(*mc.Before)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if err := write(repo, entries[:len(entries)-1]); err != nil {
+		return nil, err
+	}
+
+	// Restore the branch that was checked out before the operation if it was
+	// deleted by the operation (e.g., a branch deleted by the prune step).
+	// Otherwise, stay on the current branch unless the undo deleted it.
+	after := maps.Clone(refs)
+	for _, rc := range entry.Refs {
+		if rc.Before == "" {
+			delete(after, rc.Branch)
+		} else {
+			after[rc.Branch] = rc.Before
+		}
+	}
+	checkout := status.CurrentBranch
+	if entry.Head != "" && refs[entry.Head] == "" && after[entry.Head] != "" {
+		checkout = entry.Head
+	} else if touchesCurrent && after[checkout] == "" {
+		checkout = entry.Head
+		if after[checkout] == "" {
+			checkout = repo.DefaultBranch()
+		}
+	}
+	if touchesCurrent || checkout != status.CurrentBranch {
+		if _, err := repo.CheckoutBranch(ctx, &git.CheckoutBranch{Name: checkout}); err != nil {
+			return nil, err
+		}
+	}
+	return &entry, nil
+}
+
+// isInterrupted reports whether an operation started in the worktree is stopped
+// by a conflict. The conflict can be in another worktree if the operation
+// restacked a branch in place there.
+func isInterrupted(ctx context.Context, repo *git.Repo) bool {
+	if repo.IsRebaseInProgress() || repo.IsCherryPickInProgress() || repo.IsMergeInProgress() {
+		return true
+	}
+	seq := pendingSequencer(repo)
+	return seq != nil && seq.InterruptedWorktree != "" && seq.IsInterrupted(ctx, repo)
+}
+
+// pendingSequencer returns the sequencer of the av restack or av sync that is
+// stopped in the worktree, or nil if there is none.
+func pendingSequencer(repo *git.Repo) *sequencer.Sequencer {
+	var restack sequencerui.RestackState
+	if err := repo.ReadStateFile(git.StateFileKindRestack, &restack); err == nil && restack.Seq != nil {
+		return restack.Seq
+	}
+	var sync struct{ RestackState *sequencerui.RestackState }
+	if err := repo.ReadStateFile(git.StateFileKindSyncV2, &sync); err == nil && sync.RestackState != nil {
+		return sync.RestackState.Seq
+	}
+	return nil
+}
+
+// homeWorktree returns the worktree where the operation that stopped with a
+// conflict in repo was started, or repo if there is no such worktree.
+func homeWorktree(ctx context.Context, repo *git.Repo) *git.Repo {
+	worktrees, err := repo.WorktreeList(ctx)
+	if err != nil {
+		logrus.WithError(err).Debug("cannot list the worktrees")
+		return repo
+	}
+	for _, wt := range worktrees {
+		if wt.Path == repo.Dir() {
+			continue
+		}
+		wtRepo, err := repo.OpenWorktree(ctx, wt.Path)
+		if err != nil {
+			// The worktree may have been removed without `git worktree remove`.
+			continue
+		}
+		if seq := pendingSequencer(wtRepo); seq != nil && seq.InterruptedWorktree == repo.Dir() {
+			return wtRepo
+		}
+	}
+	return repo
+}
+
+func branchRefs(ctx context.Context, repo *git.Repo) (map[string]string, error) {
+	refs, err := repo.ListRefs(ctx, &git.ListRefs{Patterns: []string{"refs/heads"}})
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]string, len(refs))
+	for _, ref := range refs {
+		ret[strings.TrimPrefix(ref.Name, "refs/heads/")] = ref.Oid
+	}
+	return ret, nil
+}
+
+func journalPath(repo *git.Repo) string {
+	return filepath.Join(repo.AvDir(), "journal.json")
+}
+
+// write writes the journal to a temporary file which is then renamed over the
+// journal, so the journal is never left partially written.
+func write(repo *git.Repo, entries []Entry) error {
+	bs, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(repo.AvDir(), 0o755); err != nil {
+		return err
+	}
+
+	fp := journalPath(repo)
+	f, err := os.CreateTemp(filepath.Dir(fp), filepath.Base(fp)+".tmp-*")
+	if err != nil {
+		return errors.WrapIff(err, "failed to write the operation journal %q", fp)
+	}
+	defer func() {
+		// No-op if the file was renamed.
+		_ = os.Remove(f.Name())
+	}()
+	if _, err := f.Write(bs); err != nil {
+		_ = f.Close()
+		return errors.WrapIff(err, "failed to write the operation journal %q", fp)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return errors.WrapIff(err, "failed to write the operation journal %q", fp)
+	}
+	if err := f.Close(); err != nil {
+		return errors.WrapIff(err, "failed to write the operation journal %q", fp)
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return errors.WrapIff(err, "failed to write the operation journal %q", fp)
+	}
+	if err := os.Rename(f.Name(), fp); err != nil {
+		return errors.WrapIff(err, "failed to write the operation journal %q", fp)
+	}
+	return nil
+}
+
+func sortedKeys[V any](a, b map[string]V) []string {
+	var ret []string
+	for k := range a {
+		ret = append(ret, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			ret = append(ret, k)
+		}
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+func equal(a, b meta.Branch) bool {
+	as, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bs, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(as) == string(bs)
+}
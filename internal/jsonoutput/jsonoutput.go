@@ -0,0 +1,360 @@
+// Package jsonoutput defines the machine-readable output of the commands that
+// support `--format json`.
+//
+// The output is a stable interface for scripts and tools. Every document has a
+// top-level "schemaVersion" field. Adding fields is a compatible change and
+// doesn't change the version; removing or changing the meaning of a field
+// requires bumping SchemaVersion. The schema is documented in av-json(7).
+package jsonoutput
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"time"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/sequencer"
+	"github.com/aviator-co/av/internal/utils/stackutils"
+)
+
+// SchemaVersion is the version of the JSON output schema.
+const SchemaVersion = 1
+
+const (
+	// FormatText is the default human-readable output.
+	FormatText = "text"
+	// FormatJSON is the machine-readable output defined by this package.
+	FormatJSON = "json"
+)
+
+// ValidateFormat returns an error if the format is not one of the given
+// formats.
+func ValidateFormat(format string, formats ...string) error {
+	for _, f := range formats {
+		if format == f {
+			return nil
+		}
+	}
+	return errors.Errorf("invalid --format %q; must be one of %v", format, formats)
+}
+
+// Tree is the output of `av tree --format json`.
+type Tree struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// CurrentBranch is the branch checked out in the current worktree. Empty
+	// if the HEAD is detached.
+	CurrentBranch string `json:"currentBranch"`
+	// Roots are the trunk branches with their stacks.
+	Roots []*Branch `json:"roots"`
+}
+
+// Branch is a node of the stack tree.
+type Branch struct {
+	Name string `json:"name"`
+	// Trunk is true if the branch is a trunk branch (e.g., main).
+	Trunk bool `json:"trunk"`
+	// Head is the commit hash of the branch. Empty if the branch doesn't
+	// exist in Git.
+	Head string `json:"head"`
+	// Parent is the parent branch. Nil for trunk branches.
+	Parent *Parent `json:"parent"`
+	// Current is true if the branch is checked out in the current worktree.
+	Current bool `json:"current"`
+	// Worktree is the path of the worktree where the branch is checked out, if
+	// any.
+	Worktree string `json:"worktree,omitempty"`
+	// NeedsRestack is true if the branch is not based on the latest commit
+	// of its (non-trunk) parent branch.
+	NeedsRestack bool `json:"needsRestack"`
+	// PullRequest is the pull request of the branch, if any.
+	PullRequest *PullRequest `json:"pullRequest"`
+	// MergeCommit is the commit that merged the branch into the trunk, if any.
+	MergeCommit string `json:"mergeCommit,omitempty"`
+	// Description is the description set by `av branch describe`.
+	Description string `json:"description,omitempty"`
+	// Labels are the labels set by `av branch label`.
+	Labels []string `json:"labels,omitempty"`
+	// ExcludedFromSyncAll is true if the branch is excluded from
+	// `av sync --all`.
+	ExcludedFromSyncAll bool `json:"excludedFromSyncAll,omitempty"`
+	// Children are the child branches.
+	Children []*Branch `json:"children"`
+}
+
+// Parent is the parent of a branch.
+type Parent struct {
+	Name  string `json:"name"`
+	Trunk bool   `json:"trunk"`
+	// BranchingPoint is the commit hash of the parent branch that the branch
+	// was last based on.
+	BranchingPoint string `json:"branchingPoint,omitempty"`
+}
+
+// PullRequest is a pull request.
+type PullRequest struct {
+	Number int64  `json:"number"`
+	ID     string `json:"id,omitempty"`
+	// State is OPEN, CLOSED, or MERGED.
+	State string `json:"state"`
+	URL   string `json:"url"`
+	// The fields below are set only by `av pr status`.
+	Title      string     `json:"title,omitempty"`
+	IsDraft    bool       `json:"isDraft,omitempty"`
+	Author     string     `json:"author,omitempty"`
+	CreatedAt  *time.Time `json:"createdAt,omitempty"`
+	BaseBranch string     `json:"baseBranch,omitempty"`
+	HeadBranch string     `json:"headBranch,omitempty"`
+}
+
+// PullRequestStatus is the output of `av pr status --format json`.
+type PullRequestStatus struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	Branch        string       `json:"branch"`
+	PullRequest   *PullRequest `json:"pullRequest"`
+	// Queue is the merge queue status. Set only if the Aviator API token is
+	// configured.
+	Queue *QueueStatus `json:"queue,omitempty"`
+}
+
+// QueueStatus is the Aviator merge queue status of a pull request.
+type QueueStatus struct {
+	Status         string          `json:"status"`
+	StatusReason   string          `json:"statusReason,omitempty"`
+	QueuedAt       *time.Time      `json:"queuedAt,omitempty"`
+	MergedAt       *time.Time      `json:"mergedAt,omitempty"`
+	RequiredChecks []RequiredCheck `json:"requiredChecks"`
+	// BotPullRequestNumber is the number of the pull request created by the
+	// merge queue to test the change, if any.
+	BotPullRequestNumber int64           `json:"botPullRequestNumber,omitempty"`
+	BotRequiredChecks    []RequiredCheck `json:"botRequiredChecks,omitempty"`
+}
+
+// RequiredCheck is the result of a required status check.
+type RequiredCheck struct {
+	Name string `json:"name"`
+	// Result is SUCCESS, FAILURE, or PENDING.
+	Result string `json:"result"`
+}
+
+// BranchList is the output of `av branch-meta list --format json`.
+type BranchList struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// Branches are the branches managed by av in alphabetical order. The
+	// children of the branches are not populated.
+	Branches []*Branch `json:"branches"`
+}
+
+// SyncPlan is the output of `av sync --dry-run --format json`.
+type SyncPlan struct {
+	SchemaVersion int `json:"schemaVersion"`
+	// Operations are the branches to be rebased in order.
+	Operations []*RestackOperation `json:"operations"`
+}
+
+// RestackOperation is a planned rebase of a branch.
+type RestackOperation struct {
+	Branch string `json:"branch"`
+	// NewParent is the branch that the branch will be rebased onto.
+	NewParent      string `json:"newParent"`
+	NewParentTrunk bool   `json:"newParentTrunk"`
+	// ParentChanged is true if the branch will be reparented (e.g., because
+	// its parent was merged).
+	ParentChanged bool `json:"parentChanged"`
+	// NeedsRestack is true if the branch is not based on the latest commit
+	// of its parent, so that the branch will be rewritten.
+	NeedsRestack bool `json:"needsRestack"`
+	// Prediction is the predicted result of the rebase: "clean", "conflict",
+	// or "unknown" (e.g., the branch has merge commits).
+	Prediction string `json:"prediction"`
+	// AfterConflict is true if a branch that this branch is rebased onto is
+	// predicted to conflict, so the prediction assumes those conflicts are
+	// resolved.
+	AfterConflict bool `json:"afterConflict,omitempty"`
+	// Conflicts are the commits that are predicted to conflict.
+	Conflicts []*RestackConflict `json:"conflicts,omitempty"`
+}
+
+// RestackConflict is a commit that is predicted to conflict.
+type RestackConflict struct {
+	Commit  string   `json:"commit"`
+	Subject string   `json:"subject"`
+	Files   []string `json:"files"`
+}
+
+const (
+	PredictionClean    = "clean"
+	PredictionConflict = "conflict"
+	PredictionUnknown  = "unknown"
+)
+
+// Write writes the document as indented JSON.
+func Write(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// BranchBuilder builds the Branch nodes from the av metadata and the Git
+// repository.
+type BranchBuilder struct {
+	repo          *git.Repo
+	tx            meta.ReadTx
+	currentBranch string
+	worktrees     map[string]string
+}
+
+// NewBranchBuilder creates a BranchBuilder.
+func NewBranchBuilder(
+	ctx context.Context,
+	repo *git.Repo,
+	tx meta.ReadTx,
+	currentBranch string,
+) *BranchBuilder {
+	worktrees := map[string]string{}
+	wts, _ := repo.WorktreeList(ctx)
+	for _, wt := range wts {
+		if wt.Branch != "" {
+			worktrees[wt.Branch] = wt.Path
+		}
+	}
+	return &BranchBuilder{
+		repo:          repo,
+		tx:            tx,
+		currentBranch: currentBranch,
+		worktrees:     worktrees,
+	}
+}
+
+// Tree builds the Tree from the stack tree nodes.
+func (b *BranchBuilder) Tree(ctx context.Context, nodes []*stackutils.StackTreeNode) *Tree {
+	t := &Tree{
+		SchemaVersion: SchemaVersion,
+		CurrentBranch: b.currentBranch,
+		Roots:         []*Branch{},
+	}
+	for _, node := range nodes {
+		t.Roots = append(t.Roots, b.node(ctx, node))
+	}
+	return t
+}
+
+func (b *BranchBuilder) node(ctx context.Context, node *stackutils.StackTreeNode) *Branch {
+	br := b.Branch(ctx, node.Branch.BranchName)
+	for _, child := range node.Children {
+		br.Children = append(br.Children, b.node(ctx, child))
+	}
+	return br
+}
+
+// Branch builds the Branch of the given name without its children.
+func (b *BranchBuilder) Branch(ctx context.Context, name string) *Branch {
+	ret := &Branch{
+		Name:     name,
+		Current:  name == b.currentBranch,
+		Worktree: b.worktrees[name],
+		Children: []*Branch{},
+	}
+	if head, err := b.repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + name}); err == nil {
+		ret.Head = head
+	}
+	avbr, ok := b.tx.Branch(name)
+	if !ok {
+		ret.Trunk = b.repo.IsTrunkBranch(name)
+		return ret
+	}
+	ret.Parent = &Parent{
+		Name:           avbr.Parent.Name,
+		Trunk:          avbr.Parent.Trunk,
+		BranchingPoint: avbr.Parent.BranchingPointCommitHash,
+	}
+	if avbr.PullRequest != nil {
+		ret.PullRequest = &PullRequest{
+			Number: avbr.PullRequest.Number,
+			ID:     avbr.PullRequest.ID,
+			State:  string(avbr.PullRequest.State),
+			URL:    avbr.PullRequest.Permalink,
+		}
+	}
+	ret.MergeCommit = avbr.MergeCommit
+	ret.Description = avbr.Description
+	ret.Labels = avbr.Labels
+	ret.ExcludedFromSyncAll = avbr.ExcludeFromSyncAll
+	if ret.Head != "" && !avbr.Parent.Trunk && avbr.MergeCommit == "" {
+		ret.NeedsRestack = NeedsRestack(ctx, b.repo, avbr.Parent.Name, ret.Head)
+	}
+	return ret
+}
+
+// NeedsRestack returns true if the commit is not based on the latest commit of
+// the parent branch.
+func NeedsRestack(ctx context.Context, repo *git.Repo, parent string, commit string) bool {
+	parentHead, err := repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + parent})
+	if err != nil {
+		// The parent branch doesn't exist. The branch needs to be restacked
+		// onto a new parent.
+		return true
+	}
+	ok, err := repo.IsAncestor(ctx, parentHead, commit)
+	return err != nil || !ok
+}
+
+// RestackOperations converts the planned restack operations and their
+// simulated results. For a trunk parent, the branch is compared against the
+// remote-tracking branch of the trunk since that's what the sequencer rebases
+// onto.
+func RestackOperations(
+	ctx context.Context,
+	repo *git.Repo,
+	tx meta.ReadTx,
+	ops []sequencer.RestackOp,
+	sims []*sequencer.SimulatedRestack,
+) []*RestackOperation {
+	ret := []*RestackOperation{}
+	for i, op := range ops {
+		name := op.Name.Short()
+		avbr, _ := tx.Branch(name)
+		newParent := op.NewParent.Short()
+		o := &RestackOperation{
+			Branch:         name,
+			NewParent:      newParent,
+			NewParentTrunk: op.NewParentIsTrunk,
+			ParentChanged:  avbr.Parent.Name != newParent,
+			NeedsRestack:   true,
+		}
+		parentRef := "refs/heads/" + newParent
+		if op.NewParentIsTrunk {
+			parentRef = "refs/remotes/" + repo.GetRemoteName() + "/" + newParent
+		}
+		parentHead, err := repo.RevParse(ctx, &git.RevParse{Rev: parentRef})
+		if err == nil {
+			if ok, err := repo.IsAncestor(ctx, parentHead, op.Name.String()); err == nil && ok {
+				o.NeedsRestack = o.ParentChanged
+			}
+		}
+		if i < len(sims) {
+			sim := sims[i]
+			o.NeedsRestack = o.NeedsRestack || sim.Rewritten
+			o.AfterConflict = sim.AfterConflict
+			switch {
+			case sim.Unknown:
+				o.Prediction = PredictionUnknown
+			case len(sim.Conflicts) > 0:
+				o.Prediction = PredictionConflict
+			default:
+				o.Prediction = PredictionClean
+			}
+			for _, c := range sim.Conflicts {
+				o.Conflicts = append(o.Conflicts, &RestackConflict{
+					Commit:  c.Commit,
+					Subject: c.Subject,
+					Files:   c.Files,
+				})
+			}
+		}
+		ret = append(ret, o)
+	}
+	return ret
+}
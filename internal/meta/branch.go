@@ -27,12 +27,25 @@ type Branch struct {
 
 	// Whether this branch should be excluded from "av sync --all" operations
 	ExcludeFromSyncAll bool `json:"excludeFromSyncAll,omitempty"`
+
+	// A free-form description of the branch (e.g., why the branch exists and
+	// TODO notes). This is used as the default pull request body.
+	Description string `json:"description,omitempty"`
+
+	// Free-form labels that group branches across stacks (e.g., "feature-x"
+	// or "wip"). Commands that take --label operate on the labeled branches.
+	Labels []string `json:"labels,omitempty"`
 }
 
 func (b *Branch) IsStackRoot() bool {
 	return b.Parent.Trunk
 }
 
+// HasLabel returns true if the branch has the given label.
+func (b *Branch) HasLabel(label string) bool {
+	return slices.Contains(b.Labels, label)
+}
+
 func (b *Branch) UnmarshalJSON(bytes []byte) error {
 	// We have to do a bit of backwards-compatible trickery here to support the
 	// fact that "parent" used to be a string field and now it's a struct
@@ -239,6 +252,30 @@ func StackBranches(tx ReadTx, name string) ([]string, error) {
 	return res, nil
 }
 
+// LabeledBranches returns the branches that have the given label in
+// "dependency order" (i.e., A comes before B if A is an ancestor of B). The
+// stacks are visited in the alphabetical order of their root branches.
+func LabeledBranches(tx ReadTx, label string) []string {
+	var roots []string
+	for name, br := range tx.AllBranches() {
+		if br.IsStackRoot() {
+			roots = append(roots, name)
+		}
+	}
+	slices.Sort(roots)
+
+	var res []string
+	for _, root := range roots {
+		for _, name := range append([]string{root}, SubsequentBranches(tx, root)...) {
+			br, _ := tx.Branch(name)
+			if br.HasLabel(label) {
+				res = append(res, name)
+			}
+		}
+	}
+	return res
+}
+
 // BranchesMap returns a map of branch names to their metadata.
 func BranchesMap(tx ReadTx, names []string) (map[string]Branch, error) {
 	branches := make(map[string]Branch, len(names))
@@ -82,3 +82,16 @@ func TestValidateNoCycle(t *testing.T) {
 		})
 	}
 }
+
+func TestLabeledBranches(t *testing.T) {
+	tx := testReadTx{branches: map[string]Branch{
+		"b1": {Name: "b1", Parent: BranchState{Name: "main", Trunk: true}},
+		"b2": {Name: "b2", Parent: BranchState{Name: "b1"}, Labels: []string{"x"}},
+		"b3": {Name: "b3", Parent: BranchState{Name: "b2"}, Labels: []string{"x", "y"}},
+		"a1": {Name: "a1", Parent: BranchState{Name: "main", Trunk: true}, Labels: []string{"x"}},
+		"c1": {Name: "c1", Parent: BranchState{Name: "main", Trunk: true}, Labels: []string{"y"}},
+	}}
+	assert.Equal(t, []string{"a1", "b2", "b3"}, LabeledBranches(tx, "x"))
+	assert.Equal(t, []string{"b3", "c1"}, LabeledBranches(tx, "y"))
+	assert.Empty(t, LabeledBranches(tx, "z"))
+}
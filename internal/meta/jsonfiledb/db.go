@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/aviator-co/av/internal/meta"
+	"github.com/sirupsen/logrus"
 )
 
 type DB struct {
@@ -13,17 +14,26 @@ type DB struct {
 
 	stateMu sync.Mutex
 	state   *state
+	// version is the version of the state file that state was read from (or
+	// written to). See readState.
+	version string
 }
 
 // OpenPath opens a JSON file database at the given path.
 // If the file does not exist, it is created (as well as all ancestor directories).
+//
+// The database can be used by multiple processes at the same time (e.g., av
+// running in multiple worktrees). Write transactions are committed while
+// holding a lock file, and the changes of a transaction are replayed on top of
+// the changes committed by other processes since the transaction started. If
+// both modified the same branch, the commit fails with ErrConflict.
 func OpenPath(fp string) (*DB, bool, error) {
 	_ = os.MkdirAll(filepath.Dir(fp), 0o755)
-	state, err := readState(fp)
+	state, version, err := readState(fp)
 	if err != nil {
 		return nil, false, err
 	}
-	db := &DB{filepath: fp, stateMu: sync.Mutex{}, state: state}
+	db := &DB{filepath: fp, stateMu: sync.Mutex{}, state: state, version: version}
 	return db, state.RepositoryState.ID != "", nil
 }
 
@@ -40,7 +50,25 @@ func (d *DB) WriteTx() meta.WriteTx {
 	// aborted/committed in order to prevent other transactions from modifying
 	// the state.
 	d.stateMu.Lock()
-	return &writeTx{d, readTx{d.state.copy()}}
+	d.refresh()
+	return &writeTx{db: d, readTx: readTx{d.state.copy()}, base: d.state.copy(), baseVersion: d.version}
+}
+
+// refresh re-reads the state file if it was modified by another process so
+// that a new write transaction starts from the latest state. This must be
+// called with stateMu held.
+func (d *DB) refresh() {
+	state, version, err := readState(d.filepath)
+	if err != nil {
+		// The commit will detect the change (or fail again).
+		logrus.WithError(err).Debug("failed to re-read av state file")
+		return
+	}
+	if version != d.version {
+		logrus.Debug("av state file was modified by another process, reloading")
+		d.state = state
+		d.version = version
+	}
 }
 
 var _ meta.DB = &DB{}
@@ -1,6 +1,8 @@
 package jsonfiledb_test
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/aviator-co/av/internal/meta"
@@ -50,3 +52,60 @@ func TestJSONFileDB(t *testing.T) {
 	require.True(t, ok, "branch should be found after re-open")
 	require.Equal(t, "foo", foo.Name, "branch name should match")
 }
+
+func TestJSONFileDB_ConcurrentWrites(t *testing.T) {
+	tempfile := t.TempDir() + "/db.json"
+
+	db1, _, err := jsonfiledb.OpenPath(tempfile)
+	require.NoError(t, err)
+	tx := db1.WriteTx()
+	tx.SetRepository(meta.Repository{ID: "foo"})
+	tx.SetBranch(meta.Branch{Name: "foo"})
+	require.NoError(t, tx.Commit())
+
+	// Simulate another process that opened the same database.
+	db2, _, err := jsonfiledb.OpenPath(tempfile)
+	require.NoError(t, err)
+
+	tx1 := db1.WriteTx()
+	tx1.SetBranch(meta.Branch{Name: "bar", Parent: meta.BranchState{Name: "foo"}})
+	tx2 := db2.WriteTx()
+	tx2.DeleteBranch("foo")
+	tx2.SetBranch(meta.Branch{Name: "baz"})
+	require.NoError(t, tx2.Commit())
+	require.NoError(t, tx1.Commit(), "non-overlapping changes should be merged")
+
+	db3, _, err := jsonfiledb.OpenPath(tempfile)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"bar", "baz"}, branchNames(db3))
+	assert.ElementsMatch(t, []string{"bar", "baz"}, branchNames(db1))
+
+	tx1 = db1.WriteTx()
+	tx1.SetBranch(meta.Branch{Name: "bar", Parent: meta.BranchState{Name: "main", Trunk: true}})
+	tx2 = db2.WriteTx()
+	tx2.DeleteBranch("bar")
+	require.NoError(t, tx2.Commit())
+	require.ErrorIs(t, tx1.Commit(), jsonfiledb.ErrConflict)
+
+	db3, _, err = jsonfiledb.OpenPath(tempfile)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"baz"}, branchNames(db3), "conflicting commit should not be written")
+
+	// Transactions started after the other process committed see its changes.
+	tx1 = db1.WriteTx()
+	_, ok := tx1.Branch("bar")
+	assert.False(t, ok)
+	tx1.Abort()
+
+	entries, err := os.ReadDir(filepath.Dir(tempfile))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "no lock or temporary files should be left behind")
+}
+
+func branchNames(db meta.DB) []string {
+	var ret []string
+	for name := range db.ReadTx().AllBranches() {
+		ret = append(ret, name)
+	}
+	return ret
+}
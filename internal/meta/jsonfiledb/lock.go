@@ -0,0 +1,54 @@
+package jsonfiledb
+
+import (
+	"os"
+	"time"
+
+	"emperror.dev/errors"
+)
+
+const (
+	// lockTimeout is how long we wait for another process to release the
+	// lock before giving up.
+	lockTimeout = 10 * time.Second
+	// lockRetryInterval is the interval between the attempts to acquire the
+	// lock.
+	lockRetryInterval = 20 * time.Millisecond
+)
+
+// fileLock is a cross-process lock for the database file.
+//
+// Similar to Git's lock files (e.g., index.lock), the lock is held by creating
+// "<file>.lock" exclusively and released by removing it. This works on every
+// platform and every filesystem that supports O_EXCL, which is all that Git
+// requires as well.
+type fileLock struct {
+	path string
+}
+
+func acquireLock(fp string) (*fileLock, error) {
+	path := fp + ".lock"
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			_ = f.Close()
+			return &fileLock{path: path}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, errors.WrapIff(err, "failed to lock av state file")
+		}
+		if time.Now().After(deadline) {
+			return nil, errors.Errorf(
+				"failed to lock av state file: %q exists\n"+
+					"another av process seems to be running; if not, remove the file and try again",
+				path,
+			)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+func (l *fileLock) release() {
+	_ = os.Remove(l.path)
+}
@@ -0,0 +1,201 @@
+package jsonfiledb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+
+	"emperror.dev/errors"
+)
+
+// migration upgrades the state file to a schema version.
+type migration struct {
+	// The schema version that this migration upgrades the file to. This must
+	// be the index of the migration in the migrations list plus one.
+	version int
+	// A short description of what this migration does.
+	description string
+	// migrate modifies the decoded state file in place and returns the
+	// human-readable list of the changes that were made.
+	migrate func(doc map[string]any) ([]string, error)
+}
+
+// migrations is the registry of the schema migrations, in the order of the
+// schema versions. Files written before the schema version was introduced are
+// version 0.
+//
+// To change the schema, append a migration here. The migration receives the
+// state file decoded as generic JSON values (numbers are json.Number) so that
+// it doesn't depend on the current Go types.
+var migrations = []migration{
+	{
+		version:     1,
+		description: "store the parent of every branch as an object",
+		migrate:     migrateParentObject,
+	},
+}
+
+// CurrentSchemaVersion is the schema version of the state files written by
+// this version of av.
+var CurrentSchemaVersion = migrations[len(migrations)-1].version
+
+// ErrNewerSchema is returned when writing to a state file that was written by
+// a newer version of av.
+var ErrNewerSchema = errors.Sentinel(
+	"av metadata was written by a newer version of av; please upgrade av",
+)
+
+// MigrationReport describes the migration of a state file.
+type MigrationReport struct {
+	// The schema version of the file before the migration.
+	FromVersion int
+	// The schema version of the file after the migration.
+	ToVersion int
+	// The migration steps that were applied.
+	Steps []MigrationStep
+}
+
+// MigrationStep describes a single migration step.
+type MigrationStep struct {
+	Version     int
+	Description string
+	// The human-readable list of the changes that were made in this step.
+	Changes []string
+}
+
+// Migrate upgrades the state file at the given path to the current schema
+// version and returns a report of what changed. If dryRun is true, the file is
+// not modified.
+//
+// Note that OpenPath migrates the file in memory as well, and the migrated
+// state is written on the next commit. This is useful to upgrade the file
+// explicitly or to see what would change.
+func Migrate(fp string, dryRun bool) (*MigrationReport, error) {
+	lock, err := acquireLock(fp)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.release()
+
+	data, err := os.ReadFile(fp)
+	if os.IsNotExist(err) {
+		return &MigrationReport{FromVersion: CurrentSchemaVersion, ToVersion: CurrentSchemaVersion}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	report, migrated, err := migrate(data)
+	if err != nil {
+		return nil, err
+	}
+	if report.FromVersion > CurrentSchemaVersion {
+		return nil, errors.WrapIff(
+			ErrNewerSchema,
+			"schema version %d is newer than the supported version %d",
+			report.FromVersion, CurrentSchemaVersion,
+		)
+	}
+	if dryRun || len(report.Steps) == 0 {
+		return report, nil
+	}
+	var st state
+	if err := json.Unmarshal(migrated, &st); err != nil {
+		return nil, errors.WrapIff(err, "failed to read av state file %q", fp)
+	}
+	if _, err := st.write(fp); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// migrate applies the migrations to the state file contents and returns the
+// migrated contents. If the file is newer than the current schema, the contents
+// are returned as-is.
+func migrate(data []byte) (*MigrationReport, []byte, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("{}")
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+	from, err := schemaVersion(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &MigrationReport{FromVersion: from, ToVersion: from}
+	if from >= CurrentSchemaVersion {
+		return report, data, nil
+	}
+	for _, m := range migrations[from:] {
+		changes, err := m.migrate(doc)
+		if err != nil {
+			return nil, nil, errors.WrapIff(err, "failed to migrate av metadata to schema version %d", m.version)
+		}
+		report.Steps = append(report.Steps, MigrationStep{
+			Version:     m.version,
+			Description: m.description,
+			Changes:     changes,
+		})
+		report.ToVersion = m.version
+	}
+	doc["schemaVersion"] = report.ToVersion
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return report, migrated, nil
+}
+
+func schemaVersion(doc map[string]any) (int, error) {
+	v, ok := doc["schemaVersion"]
+	if !ok {
+		return 0, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, errors.Errorf("invalid av metadata schema version %v", v)
+	}
+	i, err := n.Int64()
+	if err != nil {
+		return 0, errors.Errorf("invalid av metadata schema version %v", v)
+	}
+	return int(i), nil
+}
+
+// migrateParentObject converts the legacy string form of the parent branch
+// (`"parent": "foo"`) and the missing parent (which means the branch is a stack
+// root) to the object form (`"parent": {"name": "foo"}`).
+func migrateParentObject(doc map[string]any) ([]string, error) {
+	branches, _ := doc["branches"].(map[string]any)
+	var changes []string
+	for _, name := range slices.Sorted(maps.Keys(branches)) {
+		br, ok := branches[name].(map[string]any)
+		if !ok {
+			return nil, errors.Errorf("invalid metadata for branch %q", name)
+		}
+		switch parent := br["parent"].(type) {
+		case map[string]any:
+			continue
+		case nil:
+			br["parent"] = map[string]any{"name": "", "trunk": true}
+			changes = append(changes, fmt.Sprintf("%s: set the missing parent to trunk", name))
+		case string:
+			if parent == "" {
+				br["parent"] = map[string]any{"name": "", "trunk": true}
+				changes = append(changes, fmt.Sprintf("%s: set the empty parent to trunk", name))
+			} else {
+				br["parent"] = map[string]any{"name": parent}
+				changes = append(changes, fmt.Sprintf("%s: converted the parent %q to an object", name, parent))
+			}
+		default:
+			return nil, errors.Errorf("invalid parent for branch %q", name)
+		}
+	}
+	return changes, nil
+}
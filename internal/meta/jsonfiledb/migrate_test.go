@@ -0,0 +1,77 @@
+package jsonfiledb_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/meta/jsonfiledb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const legacyState = `{
+  "branches": {
+    "one": {"name": "one"},
+    "two": {"name": "two", "parent": "one"},
+    "three": {"name": "three", "parent": {"name": "two", "head": "c0ffee"}}
+  },
+  "repository": {"id": "R_1", "owner": "aviator-co", "name": "av"}
+}`
+
+func TestMigrate(t *testing.T) {
+	tempfile := t.TempDir() + "/db.json"
+	require.NoError(t, os.WriteFile(tempfile, []byte(legacyState), 0o644))
+
+	report, err := jsonfiledb.Migrate(tempfile, true)
+	require.NoError(t, err)
+	assert.Equal(t, 0, report.FromVersion)
+	assert.Equal(t, jsonfiledb.CurrentSchemaVersion, report.ToVersion)
+	require.Len(t, report.Steps, 1)
+	assert.Equal(t, []string{
+		"one: set the missing parent to trunk",
+		`two: converted the parent "one" to an object`,
+	}, report.Steps[0].Changes)
+
+	data, err := os.ReadFile(tempfile)
+	require.NoError(t, err)
+	assert.Equal(t, legacyState, string(data), "dry-run should not modify the file")
+
+	_, err = jsonfiledb.Migrate(tempfile, false)
+	require.NoError(t, err)
+	report, err = jsonfiledb.Migrate(tempfile, true)
+	require.NoError(t, err)
+	assert.Equal(t, jsonfiledb.CurrentSchemaVersion, report.FromVersion)
+	assert.Empty(t, report.Steps)
+
+	db, exists, err := jsonfiledb.OpenPath(tempfile)
+	require.NoError(t, err)
+	require.True(t, exists)
+	two, _ := db.ReadTx().Branch("two")
+	assert.Equal(t, meta.BranchState{Name: "one"}, two.Parent)
+	three, _ := db.ReadTx().Branch("three")
+	assert.Equal(t, meta.BranchState{Name: "two", BranchingPointCommitHash: "c0ffee"}, three.Parent)
+}
+
+func TestNewerSchema(t *testing.T) {
+	tempfile := t.TempDir() + "/db.json"
+	newer := `{"schemaVersion": 1000, "branches": {"one": {"name": "one", "parent": {"name": "main", "trunk": true}}}, "repository": {"id": "R_1"}}`
+	require.NoError(t, os.WriteFile(tempfile, []byte(newer), 0o644))
+
+	db, exists, err := jsonfiledb.OpenPath(tempfile)
+	require.NoError(t, err, "newer schema should still be readable")
+	require.True(t, exists)
+	_, ok := db.ReadTx().Branch("one")
+	require.True(t, ok)
+
+	tx := db.WriteTx()
+	tx.SetBranch(meta.Branch{Name: "two"})
+	require.ErrorIs(t, tx.Commit(), jsonfiledb.ErrNewerSchema)
+
+	_, err = jsonfiledb.Migrate(tempfile, false)
+	require.ErrorIs(t, err, jsonfiledb.ErrNewerSchema)
+
+	data, err := os.ReadFile(tempfile)
+	require.NoError(t, err)
+	assert.Equal(t, newer, string(data), "file with a newer schema should not be modified")
+}
@@ -1,51 +1,103 @@
 package jsonfiledb
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"os"
+	"path/filepath"
 
 	"emperror.dev/errors"
 	"github.com/aviator-co/av/internal/meta"
 	"github.com/aviator-co/av/internal/utils/maputils"
 )
 
-func readState(filepath string) (*state, error) {
+// readState reads the state file and returns the state and its version. The
+// version identifies the content of the file and is used to detect if the
+// file was modified by another process. It's empty if the file doesn't exist.
+func readState(filepath string) (*state, string, error) {
 	data, err := os.ReadFile(filepath)
 	if err != nil && !os.IsNotExist(err) {
-		return nil, err
+		return nil, "", err
 	}
-	if len(data) == 0 {
-		data = []byte("{}")
+	version := ""
+	if err == nil {
+		version = fileVersion(data)
+	}
+	_, data, err = migrate(data)
+	if err != nil {
+		return nil, "", errors.WrapIff(err, "failed to read av state file %q", filepath)
 	}
 	var state state
 	if err := json.Unmarshal(data, &state); err != nil {
-		return nil, errors.WrapIff(err, "failed to read av state file %q", filepath)
+		return nil, "", errors.WrapIff(err, "failed to read av state file %q", filepath)
 	}
-	return &state, nil
+	return &state, version, nil
 }
 
 type state struct {
+	// The schema version of the state. See migrations.
+	SchemaVersion   int                    `json:"schemaVersion"`
 	BranchState     map[string]meta.Branch `json:"branches"`
 	RepositoryState meta.Repository        `json:"repository"`
 }
 
 func (d *state) copy() state {
 	return state{
-		maputils.Copy(d.BranchState),
-		d.RepositoryState,
+		SchemaVersion:   d.SchemaVersion,
+		BranchState:     maputils.Copy(d.BranchState),
+		RepositoryState: d.RepositoryState,
 	}
 }
 
-func (d *state) write(filepath string) error {
-	f, err := os.OpenFile(filepath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
-	if err != nil {
-		return errors.WrapIff(err, "failed to write av state file")
+// write writes the state to the file and returns the new version of the
+// file. The state is written to a temporary file which is then renamed over
+// the state file, so the state file is never left partially written.
+func (d *state) write(fp string) (string, error) {
+	if d.SchemaVersion > CurrentSchemaVersion {
+		return "", errors.WrapIff(
+			ErrNewerSchema,
+			"refusing to write schema version %d (supported version is %d)",
+			d.SchemaVersion, CurrentSchemaVersion,
+		)
 	}
-	enc := json.NewEncoder(f)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
 	enc.SetIndent("", "  ")
 	if err := enc.Encode(d); err != nil {
+		return "", errors.WrapIff(err, "failed to write av state file")
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(fp), filepath.Base(fp)+".tmp-*")
+	if err != nil {
+		return "", errors.WrapIff(err, "failed to write av state file")
+	}
+	defer func() {
+		// No-op if the file was renamed.
+		_ = os.Remove(f.Name())
+	}()
+	if _, err := f.Write(buf.Bytes()); err != nil {
 		_ = f.Close()
-		return errors.WrapIff(err, "failed to write av state file")
+		return "", errors.WrapIff(err, "failed to write av state file")
 	}
-	return f.Close()
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return "", errors.WrapIff(err, "failed to write av state file")
+	}
+	if err := f.Close(); err != nil {
+		return "", errors.WrapIff(err, "failed to write av state file")
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return "", errors.WrapIff(err, "failed to write av state file")
+	}
+	if err := os.Rename(f.Name(), fp); err != nil {
+		return "", errors.WrapIff(err, "failed to write av state file")
+	}
+	return fileVersion(buf.Bytes()), nil
+}
+
+func fileVersion(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
@@ -1,10 +1,25 @@
 package jsonfiledb
 
-import "github.com/aviator-co/av/internal/meta"
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/meta"
+)
+
+// ErrConflict is returned by Commit if another process modified the same
+// metadata since the transaction started.
+var ErrConflict = errors.Sentinel("av metadata was modified by another av process; please try again")
 
 type writeTx struct {
 	db *DB
 	readTx
+
+	// The state and its version that this transaction started from.
+	base        state
+	baseVersion string
 }
 
 func (tx *writeTx) SetRepository(repository meta.Repository) {
@@ -35,15 +50,89 @@ func (tx *writeTx) Commit() error {
 	if tx.db == nil {
 		panic("cannot commit transaction: already finalized")
 	}
+	db := tx.db
 	// Always unlock the database even if there is an error.
-	defer tx.db.stateMu.Unlock()
-	err := tx.state.write(tx.db.filepath)
+	defer db.stateMu.Unlock()
+	tx.db = nil
+
+	lock, err := acquireLock(db.filepath)
 	if err != nil {
 		return err
 	}
-	*tx.db.state = tx.state
-	tx.db = nil
+	defer lock.release()
+
+	newState := tx.state
+	current, version, err := readState(db.filepath)
+	if err != nil {
+		return err
+	}
+	if current.SchemaVersion > CurrentSchemaVersion {
+		// Don't overwrite the file with a schema that we don't understand.
+		return errors.WrapIff(
+			ErrNewerSchema,
+			"schema version %d is newer than the supported version %d",
+			current.SchemaVersion, CurrentSchemaVersion,
+		)
+	}
+	if version != tx.baseVersion {
+		// Another process committed since this transaction started. Replay
+		// our changes on top of theirs.
+		newState, err = replay(&tx.base, &tx.state, current)
+		if err != nil {
+			return err
+		}
+	}
+	version, err = newState.write(db.filepath)
+	if err != nil {
+		return err
+	}
+	*db.state = newState
+	db.version = version
 	return nil
 }
 
+// replay applies the changes from base to modified on top of current. It
+// fails with ErrConflict if current has a different change to a branch (or
+// the repository) that is also changed from base to modified.
+func replay(base, modified, current *state) (state, error) {
+	ret := current.copy()
+	if ret.BranchState == nil {
+		ret.BranchState = map[string]meta.Branch{}
+	}
+	if !equal(base.RepositoryState, modified.RepositoryState) {
+		if !equal(base.RepositoryState, current.RepositoryState) &&
+			!equal(modified.RepositoryState, current.RepositoryState) {
+			return state{}, errors.WrapIf(ErrConflict, "conflicting change to the repository metadata")
+		}
+		ret.RepositoryState = modified.RepositoryState
+	}
+
+	names := maps.Clone(base.BranchState)
+	maps.Copy(names, modified.BranchState)
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		b, bok := base.BranchState[name]
+		m, mok := modified.BranchState[name]
+		if bok == mok && equal(b, m) {
+			// Not changed by this transaction.
+			continue
+		}
+		c, cok := current.BranchState[name]
+		if (cok != bok || !equal(c, b)) && (cok != mok || !equal(c, m)) {
+			return state{}, errors.WrapIff(ErrConflict, "conflicting change to branch %q", name)
+		}
+		if mok {
+			ret.BranchState[name] = m
+		} else {
+			delete(ret.BranchState, name)
+		}
+	}
+	return ret, nil
+}
+
+func equal(a, b any) bool {
+	as, aerr := json.Marshal(a)
+	bs, berr := json.Marshal(b)
+	return aerr == nil && berr == nil && string(as) == string(bs)
+}
+
 var _ meta.WriteTx = &writeTx{}
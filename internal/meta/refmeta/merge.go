@@ -0,0 +1,176 @@
+package refmeta
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"slices"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/meta"
+)
+
+// Conflict describes a metadata field that was modified differently on both
+// sides since the last synchronization. The local value is always kept for
+// conflicting fields.
+type Conflict struct {
+	// The branch name.
+	Branch string
+	// The JSON field name of the meta.Branch that conflicted (e.g., "parent").
+	Field string
+}
+
+// MergeResult is the result of merging local and remote branch metadata.
+type MergeResult struct {
+	Branches  map[string]meta.Branch
+	Conflicts []Conflict
+}
+
+// Merge does a three-way merge of the branch metadata.
+//
+// `base` is the metadata that was last synchronized with the remote, `local`
+// is the current content of the local database, and `remote` is the latest
+// metadata fetched from the remote. A branch that is missing from a map is
+// considered deleted on that side.
+//
+// The merge is done per top-level JSON field of meta.Branch: a field changed
+// only on one side takes that side's value, and a field changed on both
+// sides keeps the local value (and is reported as a conflict). A deletion
+// wins only if the other side didn't modify the branch since the last
+// synchronization.
+func Merge(local, base, remote map[string]meta.Branch) (*MergeResult, error) {
+	res := &MergeResult{Branches: map[string]meta.Branch{}}
+	names := map[string]bool{}
+	for _, m := range []map[string]meta.Branch{local, base, remote} {
+		for name := range m {
+			names[name] = true
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		l, lok := local[name]
+		b, bok := base[name]
+		r, rok := remote[name]
+		switch {
+		case lok && !rok:
+			if bok {
+				same, err := equal(l, b)
+				if err != nil {
+					return nil, err
+				}
+				if same {
+					// Deleted on the remote and not modified locally.
+					continue
+				}
+			}
+			res.Branches[name] = l
+		case !lok && rok:
+			if bok {
+				same, err := equal(r, b)
+				if err != nil {
+					return nil, err
+				}
+				if same {
+					// Deleted locally and not modified on the remote.
+					continue
+				}
+			}
+			res.Branches[name] = r
+		case lok && rok:
+			var basePtr *meta.Branch
+			if bok {
+				basePtr = &b
+			}
+			merged, conflicts, err := mergeBranch(name, l, basePtr, r)
+			if err != nil {
+				return nil, err
+			}
+			res.Branches[name] = merged
+			res.Conflicts = append(res.Conflicts, conflicts...)
+		}
+	}
+	return res, nil
+}
+
+func mergeBranch(
+	name string,
+	local meta.Branch,
+	base *meta.Branch,
+	remote meta.Branch,
+) (meta.Branch, []Conflict, error) {
+	lf, err := fields(&local)
+	if err != nil {
+		return meta.Branch{}, nil, err
+	}
+	rf, err := fields(&remote)
+	if err != nil {
+		return meta.Branch{}, nil, err
+	}
+	bf := map[string]json.RawMessage{}
+	if base != nil {
+		bf, err = fields(base)
+		if err != nil {
+			return meta.Branch{}, nil, err
+		}
+	}
+
+	keys := map[string]bool{}
+	for _, m := range []map[string]json.RawMessage{lf, bf, rf} {
+		for k := range m {
+			keys[k] = true
+		}
+	}
+	var conflicts []Conflict
+	merged := map[string]json.RawMessage{}
+	for _, k := range slices.Sorted(maps.Keys(keys)) {
+		lv, bv, rv := lf[k], bf[k], rf[k]
+		var v json.RawMessage
+		switch {
+		case bytes.Equal(lv, rv):
+			v = lv
+		case bytes.Equal(lv, bv):
+			v = rv
+		case bytes.Equal(rv, bv):
+			v = lv
+		default:
+			conflicts = append(conflicts, Conflict{Branch: name, Field: k})
+			v = lv
+		}
+		if v != nil {
+			merged[k] = v
+		}
+	}
+
+	bs, err := json.Marshal(merged)
+	if err != nil {
+		return meta.Branch{}, nil, err
+	}
+	ret := meta.Branch{Name: name}
+	if err := json.Unmarshal(bs, &ret); err != nil {
+		return meta.Branch{}, nil, errors.WrapIff(err, "failed to merge metadata of branch %q", name)
+	}
+	return ret, conflicts, nil
+}
+
+func fields(b *meta.Branch) (map[string]json.RawMessage, error) {
+	bs, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	var ret map[string]json.RawMessage
+	if err := json.Unmarshal(bs, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func equal(a, b meta.Branch) (bool, error) {
+	as, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bs, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(as, bs), nil
+}
@@ -0,0 +1,100 @@
+package refmeta_test
+
+import (
+	"testing"
+
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/meta/refmeta"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	branch := func(name, parent string, prNumber int64) meta.Branch {
+		br := meta.Branch{
+			Name:   name,
+			Parent: meta.BranchState{Name: parent, BranchingPointCommitHash: "c0ffee"},
+		}
+		if prNumber != 0 {
+			br.PullRequest = &meta.PullRequest{Number: prNumber}
+		}
+		return br
+	}
+
+	for _, tt := range []struct {
+		name          string
+		local         []meta.Branch
+		base          []meta.Branch
+		remote        []meta.Branch
+		want          []meta.Branch
+		wantConflicts []refmeta.Conflict
+	}{
+		{
+			name:   "new on the remote",
+			remote: []meta.Branch{branch("one", "main", 0)},
+			want:   []meta.Branch{branch("one", "main", 0)},
+		},
+		{
+			name:  "new locally",
+			local: []meta.Branch{branch("one", "main", 0)},
+			want:  []meta.Branch{branch("one", "main", 0)},
+		},
+		{
+			name:   "modified on the remote",
+			local:  []meta.Branch{branch("two", "main", 0)},
+			base:   []meta.Branch{branch("two", "main", 0)},
+			remote: []meta.Branch{branch("two", "one", 0)},
+			want:   []meta.Branch{branch("two", "one", 0)},
+		},
+		{
+			name:   "different fields modified on both sides",
+			local:  []meta.Branch{branch("two", "main", 12)},
+			base:   []meta.Branch{branch("two", "main", 0)},
+			remote: []meta.Branch{branch("two", "one", 0)},
+			want:   []meta.Branch{branch("two", "one", 12)},
+		},
+		{
+			name:          "same field modified on both sides",
+			local:         []meta.Branch{branch("two", "three", 0)},
+			base:          []meta.Branch{branch("two", "main", 0)},
+			remote:        []meta.Branch{branch("two", "one", 0)},
+			want:          []meta.Branch{branch("two", "three", 0)},
+			wantConflicts: []refmeta.Conflict{{Branch: "two", Field: "parent"}},
+		},
+		{
+			name:   "deleted on the remote",
+			local:  []meta.Branch{branch("one", "main", 0)},
+			base:   []meta.Branch{branch("one", "main", 0)},
+			remote: nil,
+			want:   nil,
+		},
+		{
+			name:   "deleted on the remote but modified locally",
+			local:  []meta.Branch{branch("one", "main", 3)},
+			base:   []meta.Branch{branch("one", "main", 0)},
+			remote: nil,
+			want:   []meta.Branch{branch("one", "main", 3)},
+		},
+		{
+			name:   "deleted locally",
+			base:   []meta.Branch{branch("one", "main", 0)},
+			remote: []meta.Branch{branch("one", "main", 0)},
+			want:   nil,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := refmeta.Merge(toMap(tt.local), toMap(tt.base), toMap(tt.remote))
+			require.NoError(t, err)
+			assert.Equal(t, toMap(tt.want), res.Branches)
+			assert.Equal(t, tt.wantConflicts, res.Conflicts)
+		})
+	}
+}
+
+func toMap(branches []meta.Branch) map[string]meta.Branch {
+	ret := map[string]meta.Branch{}
+	for _, br := range branches {
+		ret[br.Name] = br
+	}
+	return ret
+}
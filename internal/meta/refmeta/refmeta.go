@@ -0,0 +1,324 @@
+// Package refmeta shares the av branch metadata between clones of a repository.
+//
+// Each meta.Branch is serialized as a JSON blob and referenced by
+// refs/av/meta/<branch>. These refs are pushed to and fetched from the remote
+// like any other ref, so the stack structure travels with the branches. The
+// local refs/av/meta/* refs record the metadata that was last synchronized
+// with the remote, which is used as the merge base when both sides changed.
+package refmeta
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/sirupsen/logrus"
+)
+
+// LocalRefPrefix is the ref namespace where the synchronized metadata is stored.
+const LocalRefPrefix = "refs/av/meta/"
+
+// pushChunkSize caps how many ref updates are sent in a single `git push`
+// (GitHub rejects pushes with more than 20 ref updates).
+const pushChunkSize = 20
+
+// RemoteRefPrefix returns the ref namespace where the metadata fetched from
+// the given remote is stored.
+func RemoteRefPrefix(remote string) string {
+	return "refs/av/remotes/" + remote + "/meta/"
+}
+
+// Result summarizes a metadata synchronization.
+type Result struct {
+	// Branches whose local metadata was updated from the remote.
+	Updated []string
+	// Branches whose local metadata was deleted because they were deleted on
+	// the remote.
+	Deleted []string
+	// Branches whose metadata was pushed to (or deleted from) the remote.
+	Pushed []string
+	// Fields that were modified on both sides. The local values are kept.
+	Conflicts []Conflict
+}
+
+type refEntry struct {
+	oid    string
+	branch meta.Branch
+}
+
+// Pull fetches the branch metadata from the remote and merges it into the
+// local database.
+//
+// Metadata for branches that don't exist in the local database is only
+// imported if the branch exists locally. This prevents the branches of other
+// people who share the same remote from showing up in the local stacks.
+func Pull(ctx context.Context, repo *git.Repo, db meta.DB) (*Result, error) {
+	remote := repo.GetRemoteName()
+	if _, err := repo.Run(ctx, &git.RunOpts{
+		Args: []string{
+			"fetch", "--prune", remote,
+			fmt.Sprintf("+%s*:%s*", LocalRefPrefix, RemoteRefPrefix(remote)),
+		},
+		ExitError: true,
+	}); err != nil {
+		return nil, errors.WrapIff(err, "failed to fetch av metadata from %q", remote)
+	}
+
+	baseRefs, err := readRefs(ctx, repo, LocalRefPrefix)
+	if err != nil {
+		return nil, err
+	}
+	remoteRefs, err := readRefs(ctx, repo, RemoteRefPrefix(remote))
+	if err != nil {
+		return nil, err
+	}
+
+	tx := db.WriteTx()
+	defer tx.Abort()
+	local := tx.AllBranches()
+	merged, err := Merge(local, branches(baseRefs), branches(remoteRefs))
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{Conflicts: merged.Conflicts}
+	visible := map[string]bool{}
+	for name, br := range merged.Branches {
+		orig, existed := local[name]
+		if !existed {
+			exists, err := repo.DoesBranchExist(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				logrus.WithField("branch", name).
+					Debug("skipping av metadata for a branch that doesn't exist locally")
+				continue
+			}
+		}
+		visible[name] = true
+		if existed {
+			br = reconcileBranchingPoint(ctx, repo, orig, br)
+			if same, err := equal(orig, br); err != nil {
+				return nil, err
+			} else if same {
+				continue
+			}
+		}
+		tx.SetBranch(br)
+		res.Updated = append(res.Updated, name)
+	}
+	for name := range local {
+		if _, ok := merged.Branches[name]; !ok {
+			tx.DeleteBranch(name)
+			res.Deleted = append(res.Deleted, name)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// The merge base becomes the remote state that we've incorporated. It
+	// must not be the merged state: the local changes are not on the remote
+	// until they are pushed.
+	for name, e := range remoteRefs {
+		if !visible[name] {
+			if _, ok := baseRefs[name]; !ok {
+				continue
+			}
+		}
+		if err := repo.UpdateRef(ctx, &git.UpdateRef{Ref: LocalRefPrefix + name, New: e.oid}); err != nil {
+			return nil, err
+		}
+	}
+	for name := range baseRefs {
+		if _, ok := remoteRefs[name]; !ok {
+			if err := repo.DeleteRef(ctx, LocalRefPrefix+name); err != nil {
+				return nil, err
+			}
+		}
+	}
+	sortResult(res)
+	return res, nil
+}
+
+// Push pushes the local branch metadata to the remote.
+//
+// The push is a compare-and-swap against the metadata fetched by the last
+// Pull, so Pull should be called before Push. If somebody else pushed in the
+// meantime, the push fails and can be retried after another Pull.
+//
+// Only the metadata of the branches that are pushed to the remote (i.e., have a
+// remote-tracking branch) or have a pull request is pushed. The metadata of
+// local-only branches stays private.
+func Push(ctx context.Context, repo *git.Repo, db meta.DB) (*Result, error) {
+	remote := repo.GetRemoteName()
+	baseRefs, err := readRefs(ctx, repo, LocalRefPrefix)
+	if err != nil {
+		return nil, err
+	}
+	remoteRefs, err := readRefs(ctx, repo, RemoteRefPrefix(remote))
+	if err != nil {
+		return nil, err
+	}
+	local := db.ReadTx().AllBranches()
+	published, err := remoteBranches(ctx, repo, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	type update struct {
+		name   string
+		oldOID string
+		newOID string
+	}
+	var updates []update
+	for name, br := range local {
+		if !published[name] && br.PullRequest == nil {
+			continue
+		}
+		bs, err := json.Marshal(br)
+		if err != nil {
+			return nil, err
+		}
+		oid, err := repo.HashObject(ctx, bs)
+		if err != nil {
+			return nil, err
+		}
+		if remoteRefs[name].oid == oid {
+			continue
+		}
+		updates = append(updates, update{name: name, oldOID: remoteRefs[name].oid, newOID: oid})
+	}
+	for name, e := range baseRefs {
+		if _, ok := local[name]; ok {
+			continue
+		}
+		// Deleted locally. Only delete on the remote if nobody modified it
+		// since the last synchronization.
+		if r, ok := remoteRefs[name]; ok && r.oid == e.oid {
+			updates = append(updates, update{name: name, oldOID: r.oid})
+		}
+	}
+
+	res := &Result{}
+	for start := 0; start < len(updates); start += pushChunkSize {
+		chunk := updates[start:min(start+pushChunkSize, len(updates))]
+		args := []string{"push", remote, "--atomic"}
+		for _, u := range chunk {
+			args = append(args, fmt.Sprintf("--force-with-lease=%s%s:%s", LocalRefPrefix, u.name, u.oldOID))
+		}
+		for _, u := range chunk {
+			args = append(args, fmt.Sprintf("%s:%s%s", u.newOID, LocalRefPrefix, u.name))
+		}
+		if _, err := repo.Run(ctx, &git.RunOpts{Args: args, ExitError: true}); err != nil {
+			return nil, errors.WrapIff(err, "failed to push av metadata to %q", remote)
+		}
+		for _, u := range chunk {
+			for _, ref := range []string{LocalRefPrefix + u.name, RemoteRefPrefix(remote) + u.name} {
+				if u.newOID == "" {
+					err = repo.DeleteRef(ctx, ref)
+				} else {
+					err = repo.UpdateRef(ctx, &git.UpdateRef{Ref: ref, New: u.newOID})
+				}
+				if err != nil {
+					return nil, err
+				}
+			}
+			res.Pushed = append(res.Pushed, u.name)
+		}
+	}
+	sortResult(res)
+	return res, nil
+}
+
+// reconcileBranchingPoint makes sure that the branching point taken from the
+// remote metadata is usable locally. The remote side may have rebased the
+// branch and the local branch may not be updated yet; in that case the
+// remote branching point commit is not in the local branch history.
+func reconcileBranchingPoint(
+	ctx context.Context,
+	repo *git.Repo,
+	local, merged meta.Branch,
+) meta.Branch {
+	bp := merged.Parent.BranchingPointCommitHash
+	if bp == "" || bp == local.Parent.BranchingPointCommitHash {
+		return merged
+	}
+	if ok, err := repo.IsAncestor(ctx, bp, "refs/heads/"+merged.Name); err == nil && ok {
+		return merged
+	}
+	if merged.Parent.Name == local.Parent.Name {
+		merged.Parent.BranchingPointCommitHash = local.Parent.BranchingPointCommitHash
+	} else {
+		// Fall back to the merge-base with the parent when restacking.
+		merged.Parent.BranchingPointCommitHash = ""
+	}
+	return merged
+}
+
+// remoteBranches returns the set of the branches that have a remote-tracking
+// branch for the remote.
+func remoteBranches(ctx context.Context, repo *git.Repo, remote string) (map[string]bool, error) {
+	prefix := "refs/remotes/" + remote + "/"
+	refs, err := repo.ListRefs(ctx, &git.ListRefs{Patterns: []string{strings.TrimSuffix(prefix, "/")}})
+	if err != nil {
+		return nil, err
+	}
+	ret := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		ret[strings.TrimPrefix(ref.Name, prefix)] = true
+	}
+	return ret, nil
+}
+
+func readRefs(ctx context.Context, repo *git.Repo, prefix string) (map[string]refEntry, error) {
+	refs, err := repo.ListRefs(ctx, &git.ListRefs{Patterns: []string{strings.TrimSuffix(prefix, "/")}})
+	if err != nil {
+		return nil, err
+	}
+	ret := map[string]refEntry{}
+	if len(refs) == 0 {
+		return ret, nil
+	}
+	var oids []string
+	for _, ref := range refs {
+		oids = append(oids, ref.Oid)
+	}
+	items, err := repo.GetRefs(ctx, &git.GetRefs{Revisions: oids})
+	if err != nil {
+		return nil, err
+	}
+	for i, ref := range refs {
+		name := strings.TrimPrefix(ref.Name, prefix)
+		if items[i].Type != "blob" {
+			logrus.WithField("ref", ref.Name).Warn("ignoring av metadata ref that is not a blob")
+			continue
+		}
+		br := meta.Branch{Name: name}
+		if err := json.Unmarshal(items[i].Contents, &br); err != nil {
+			return nil, errors.WrapIff(err, "failed to read av metadata %q", ref.Name)
+		}
+		ret[name] = refEntry{oid: ref.Oid, branch: br}
+	}
+	return ret, nil
+}
+
+func branches(refs map[string]refEntry) map[string]meta.Branch {
+	ret := make(map[string]meta.Branch, len(refs))
+	for name, e := range refs {
+		ret[name] = e.branch
+	}
+	return ret
+}
+
+func sortResult(res *Result) {
+	for _, s := range [][]string{res.Updated, res.Deleted, res.Pushed} {
+		slices.Sort(s)
+	}
+}
@@ -0,0 +1,124 @@
+package refmeta_test
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/git/gittest"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/aviator-co/av/internal/meta/jsonfiledb"
+	"github.com/aviator-co/av/internal/meta/refmeta"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushAndPull(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	repo.Git(t, "checkout", "-b", "one")
+	repo.CommitFile(t, "one.txt", "one")
+	repo.Git(t, "checkout", "-b", "two")
+	repo.CommitFile(t, "two.txt", "two")
+	repo.Git(t, "push", "origin", "one", "two")
+
+	db := repo.OpenDB(t)
+	tx := db.WriteTx()
+	tx.SetBranch(meta.Branch{Name: "one", Parent: meta.BranchState{Name: "main", Trunk: true}})
+	tx.SetBranch(meta.Branch{Name: "two", Parent: meta.BranchState{Name: "one"}})
+	require.NoError(t, tx.Commit())
+
+	avRepo := repo.AsAvGitRepo()
+	_, err := refmeta.Pull(t.Context(), avRepo, db)
+	require.NoError(t, err)
+	res, err := refmeta.Push(t.Context(), avRepo, db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"one", "two"}, res.Pushed)
+
+	// Clone the repository and check out only one of the branches.
+	remoteDir := strings.TrimSpace(repo.Git(t, "remote", "get-url", "origin"))
+	cloneDir := filepath.Join(t.TempDir(), "clone")
+	gitCmd(t, "", "clone", remoteDir, cloneDir)
+	gitCmd(t, cloneDir, "remote", "set-head", "origin", "main")
+	gitCmd(t, cloneDir, "checkout", "two")
+	cloneRepo, err := git.OpenRepo(cloneDir, filepath.Join(cloneDir, ".git"), "")
+	require.NoError(t, err)
+	cloneDB, _, err := jsonfiledb.OpenPath(filepath.Join(cloneDir, ".git", "av", "av.db"))
+	require.NoError(t, err)
+
+	res, err = refmeta.Pull(t.Context(), cloneRepo, cloneDB)
+	require.NoError(t, err)
+	require.Equal(t, []string{"two"}, res.Updated)
+	two, ok := cloneDB.ReadTx().Branch("two")
+	require.True(t, ok)
+	require.Equal(t, "one", two.Parent.Name)
+	_, ok = cloneDB.ReadTx().Branch("one")
+	require.False(t, ok, "branches that don't exist locally should not be imported")
+
+	// Modify the metadata in the clone and push it back.
+	tx = cloneDB.WriteTx()
+	two.PullRequest = &meta.PullRequest{Number: 2}
+	tx.SetBranch(two)
+	require.NoError(t, tx.Commit())
+	res, err = refmeta.Push(t.Context(), cloneRepo, cloneDB)
+	require.NoError(t, err)
+	require.Equal(t, []string{"two"}, res.Pushed)
+
+	// The original clone receives the change while keeping its own changes.
+	tx = db.WriteTx()
+	one, _ := tx.Branch("one")
+	one.ExcludeFromSyncAll = true
+	tx.SetBranch(one)
+	require.NoError(t, tx.Commit())
+	res, err = refmeta.Pull(t.Context(), avRepo, db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"two"}, res.Updated)
+	require.Empty(t, res.Conflicts)
+	two, _ = db.ReadTx().Branch("two")
+	require.Equal(t, int64(2), two.PullRequest.GetNumber())
+	one, _ = db.ReadTx().Branch("one")
+	require.True(t, one.ExcludeFromSyncAll)
+}
+
+func TestPushSkipsLocalOnlyBranches(t *testing.T) {
+	repo := gittest.NewTempRepo(t)
+	repo.Git(t, "checkout", "-b", "pushed")
+	repo.CommitFile(t, "pushed.txt", "pushed")
+	repo.Git(t, "push", "origin", "pushed")
+	repo.Git(t, "checkout", "-b", "with-pr")
+	repo.CommitFile(t, "with-pr.txt", "with-pr")
+	repo.Git(t, "checkout", "-b", "local")
+	repo.CommitFile(t, "local.txt", "local")
+
+	db := repo.OpenDB(t)
+	tx := db.WriteTx()
+	tx.SetBranch(meta.Branch{Name: "pushed", Parent: meta.BranchState{Name: "main", Trunk: true}})
+	tx.SetBranch(meta.Branch{
+		Name:        "with-pr",
+		Parent:      meta.BranchState{Name: "pushed"},
+		PullRequest: &meta.PullRequest{Number: 2},
+	})
+	tx.SetBranch(meta.Branch{Name: "local", Parent: meta.BranchState{Name: "with-pr"}})
+	require.NoError(t, tx.Commit())
+
+	avRepo := repo.AsAvGitRepo()
+	_, err := refmeta.Pull(t.Context(), avRepo, db)
+	require.NoError(t, err)
+	res, err := refmeta.Push(t.Context(), avRepo, db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"pushed", "with-pr"}, res.Pushed)
+
+	// The branch is published once it's pushed.
+	repo.Git(t, "push", "origin", "local")
+	res, err = refmeta.Push(t.Context(), avRepo, db)
+	require.NoError(t, err)
+	require.Equal(t, []string{"local"}, res.Pushed)
+}
+
+func gitCmd(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.CommandContext(t.Context(), "git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, "git %v: %s", args, out)
+}
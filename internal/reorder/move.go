@@ -0,0 +1,73 @@
+package reorder
+
+import (
+	"context"
+	"slices"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+)
+
+// CreateMovePlan creates a reorder plan for the stack rooted at rootBranch
+// that moves the given commits to the tip of toBranch. Unlike CreatePlan, the
+// fixup!/squash! commits are kept where they are.
+func CreateMovePlan(
+	ctx context.Context,
+	repo *git.Repo,
+	tx meta.ReadTx,
+	rootBranch string,
+	commits []string,
+	toBranch string,
+) ([]Cmd, error) {
+	cmds, err := createPlan(ctx, repo, tx, rootBranch)
+	if err != nil {
+		return nil, err
+	}
+	return MoveCommits(cmds, commits, toBranch)
+}
+
+// MoveCommits returns the plan with the picks of the given commits moved to the
+// end of the section of toBranch. The moved commits keep their relative order
+// in the plan.
+func MoveCommits(cmds []Cmd, commits []string, toBranch string) ([]Cmd, error) {
+	var moved []Cmd
+	found := map[string]bool{}
+	var rest []Cmd
+	for _, cmd := range cmds {
+		if p, ok := cmd.(PickCmd); ok && slices.Contains(commits, p.Commit) {
+			moved = append(moved, p)
+			found[p.Commit] = true
+			continue
+		}
+		rest = append(rest, cmd)
+	}
+	for _, c := range commits {
+		if !found[c] {
+			return nil, errors.Errorf("commit %s is not in the stack", git.ShortSha(c))
+		}
+	}
+
+	// Find the end of the section of toBranch (i.e., the next stack-branch
+	// command or the end of the plan).
+	insertAt := -1
+	for i, cmd := range rest {
+		b, ok := cmd.(StackBranchCmd)
+		if !ok {
+			continue
+		}
+		if insertAt >= 0 {
+			insertAt = i
+			break
+		}
+		if b.Name == toBranch {
+			insertAt = len(rest)
+		}
+	}
+	if insertAt < 0 {
+		return nil, errors.Errorf("branch %q is not in the stack", toBranch)
+	}
+	ret := slices.Clone(rest[:insertAt])
+	ret = append(ret, moved...)
+	return append(ret, rest[insertAt:]...), nil
+}
@@ -0,0 +1,72 @@
+package reorder
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMoveCommits(t *testing.T) {
+	cmds := []Cmd{
+		StackBranchCmd{Name: "one", Trunk: "main"},
+		PickCmd{Commit: "a"},
+		PickCmd{Commit: "b"},
+		StackBranchCmd{Name: "two", Parent: "one"},
+		PickCmd{Commit: "c"},
+		StackBranchCmd{Name: "three", Parent: "two"},
+		PickCmd{Commit: "d"},
+	}
+
+	t.Run("move up", func(t *testing.T) {
+		got, err := MoveCommits(cmds, []string{"b", "a"}, "two")
+		require.NoError(t, err)
+		assert.Equal(t, []Cmd{
+			StackBranchCmd{Name: "one", Trunk: "main"},
+			StackBranchCmd{Name: "two", Parent: "one"},
+			PickCmd{Commit: "c"},
+			PickCmd{Commit: "a"},
+			PickCmd{Commit: "b"},
+			StackBranchCmd{Name: "three", Parent: "two"},
+			PickCmd{Commit: "d"},
+		}, got)
+	})
+
+	t.Run("move down to the last branch", func(t *testing.T) {
+		got, err := MoveCommits(cmds, []string{"a"}, "three")
+		require.NoError(t, err)
+		assert.Equal(t, []Cmd{
+			StackBranchCmd{Name: "one", Trunk: "main"},
+			PickCmd{Commit: "b"},
+			StackBranchCmd{Name: "two", Parent: "one"},
+			PickCmd{Commit: "c"},
+			StackBranchCmd{Name: "three", Parent: "two"},
+			PickCmd{Commit: "d"},
+			PickCmd{Commit: "a"},
+		}, got)
+	})
+
+	t.Run("move to an earlier branch", func(t *testing.T) {
+		got, err := MoveCommits(cmds, []string{"d"}, "one")
+		require.NoError(t, err)
+		assert.Equal(t, []Cmd{
+			StackBranchCmd{Name: "one", Trunk: "main"},
+			PickCmd{Commit: "a"},
+			PickCmd{Commit: "b"},
+			PickCmd{Commit: "d"},
+			StackBranchCmd{Name: "two", Parent: "one"},
+			PickCmd{Commit: "c"},
+			StackBranchCmd{Name: "three", Parent: "two"},
+		}, got)
+	})
+
+	t.Run("unknown commit", func(t *testing.T) {
+		_, err := MoveCommits(cmds, []string{"x"}, "one")
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown branch", func(t *testing.T) {
+		_, err := MoveCommits(cmds, []string{"a"}, "four")
+		assert.Error(t, err)
+	})
+}
@@ -17,6 +17,22 @@ func CreatePlan(
 	repo *git.Repo,
 	tx meta.ReadTx,
 	rootBranch string,
+) ([]Cmd, error) {
+	cmds, err := createPlan(ctx, repo, tx, rootBranch)
+	if err != nil {
+		return nil, err
+	}
+	// Reorder fixup!/squash! commits to sit immediately after their targets
+	// across the entire stack, matching git's --autosquash behavior.
+	return autosquashCmds(cmds), nil
+}
+
+// createPlan creates a reorder plan that keeps the stack as-is.
+func createPlan(
+	ctx context.Context,
+	repo *git.Repo,
+	tx meta.ReadTx,
+	rootBranch string,
 ) ([]Cmd, error) {
 	branchNames := []string{rootBranch}
 	branchNames = append(branchNames, meta.SubsequentBranches(tx, rootBranch)...)
@@ -83,9 +99,7 @@ func CreatePlan(
 		}
 	}
 
-	// Reorder fixup!/squash! commits to sit immediately after their targets
-	// across the entire stack, matching git's --autosquash behavior.
-	return autosquashCmds(cmds), nil
+	return cmds, nil
 }
 
 // autosquashCmds reorders fixup!/squash! picks so that each one is placed
@@ -45,4 +45,7 @@ type Continuation struct {
 	// squash/fixup command). In that case, --continue must call PerformSquash
 	// after resuming the cherry-pick to fold the commit into its predecessor.
 	SquashPending bool
+	// The stash of the local changes created by --autostash. It's restored
+	// when the reorder finishes or is aborted.
+	Stash string
 }
@@ -0,0 +1,186 @@
+// Package rerere records how conflicts were resolved and reapplies the
+// resolutions when the same conflicts happen again, similar to `git rerere`.
+//
+// A conflict is identified by the text of its two sides (regardless of their
+// order), so the same conflict is recognized when it happens in a descendant
+// branch or in a later restack. The resolutions are stored in
+// .git/av/rerere.json.
+package rerere
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	markerOurs   = "<<<<<<<"
+	markerBase   = "|||||||"
+	markerSep    = "======="
+	markerTheirs = ">>>>>>>"
+)
+
+// Conflict is a conflict hunk in a file with conflict markers.
+type Conflict struct {
+	Ours, Theirs string
+}
+
+// Key returns the key of the conflict. The key doesn't depend on the order of
+// the sides, since the order changes depending on whether the conflict
+// happens during a rebase or a merge.
+func (c Conflict) Key() string {
+	a, b := c.Ours, c.Theirs
+	if b < a {
+		a, b = b, a
+	}
+	h := sha256.Sum256([]byte(a + "\x00" + b))
+	return hex.EncodeToString(h[:])
+}
+
+// segment is either a text that is common to both sides or a conflict.
+type segment struct {
+	text     string
+	conflict *Conflict
+}
+
+// parse splits the content into segments. Returns false if the content has
+// no conflicts or the conflict markers are malformed.
+func parse(content string) ([]segment, bool) {
+	var segs []segment
+	var common, ours, theirs strings.Builder
+	// 0: common, 1: ours, 2: base (diff3), 3: theirs
+	state := 0
+	hasConflict := false
+	for _, line := range strings.SplitAfter(content, "\n") {
+		switch {
+		case isMarker(line, markerOurs):
+			if state != 0 {
+				return nil, false
+			}
+			segs = append(segs, segment{text: common.String()})
+			common.Reset()
+			state = 1
+		case isMarker(line, markerBase) && state == 1:
+			state = 2
+		case isMarker(line, markerSep) && (state == 1 || state == 2):
+			state = 3
+		case isMarker(line, markerTheirs):
+			if state != 3 {
+				return nil, false
+			}
+			segs = append(segs, segment{conflict: &Conflict{Ours: ours.String(), Theirs: theirs.String()}})
+			ours.Reset()
+			theirs.Reset()
+			state = 0
+			hasConflict = true
+		default:
+			switch state {
+			case 0:
+				common.WriteString(line)
+			case 1:
+				ours.WriteString(line)
+			case 3:
+				theirs.WriteString(line)
+			}
+		}
+	}
+	if state != 0 || !hasConflict {
+		return nil, false
+	}
+	segs = append(segs, segment{text: common.String()})
+	return segs, true
+}
+
+func isMarker(line, marker string) bool {
+	if !strings.HasPrefix(line, marker) {
+		return false
+	}
+	rest := line[len(marker):]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\n' || rest[0] == '\r'
+}
+
+// Conflicts returns the conflicts in the content with conflict markers.
+func Conflicts(content string) []Conflict {
+	segs, ok := parse(content)
+	if !ok {
+		return nil
+	}
+	var ret []Conflict
+	for _, s := range segs {
+		if s.conflict != nil {
+			ret = append(ret, *s.conflict)
+		}
+	}
+	return ret
+}
+
+// ExtractResolutions returns how each conflict in the preimage (the content
+// with conflict markers) was resolved in the resolved content, keyed by
+// Conflict.Key. The text outside the conflicts must not have been changed;
+// otherwise, the resolutions cannot be told apart and nil is returned.
+func ExtractResolutions(preimage, resolved string) map[string]string {
+	segs, ok := parse(preimage)
+	if !ok {
+		return nil
+	}
+	ret := map[string]string{}
+	pos := 0
+	for i, s := range segs {
+		if s.conflict == nil {
+			if !strings.HasPrefix(resolved[pos:], s.text) {
+				return nil
+			}
+			pos += len(s.text)
+			continue
+		}
+		// The resolution ends where the next common text starts. The next
+		// segment is always a common text (possibly empty).
+		next := segs[i+1].text
+		var end int
+		switch {
+		case i+1 == len(segs)-1:
+			// The last common text is at the end of the file.
+			if !strings.HasSuffix(resolved[pos:], next) {
+				return nil
+			}
+			end = len(resolved) - len(next)
+		case next == "":
+			// Two conflicts next to each other cannot be told apart.
+			return nil
+		default:
+			idx := strings.Index(resolved[pos:], next)
+			if idx < 0 {
+				return nil
+			}
+			end = pos + idx
+		}
+		ret[s.conflict.Key()] = resolved[pos:end]
+		pos = end
+	}
+	return ret
+}
+
+// Apply resolves the conflicts in the content with the resolutions returned by
+// lookup. Returns the resolved content and the number of the resolved
+// conflicts, or false if any of the conflicts doesn't have a resolution.
+func Apply(content string, lookup func(c Conflict) (string, bool)) (string, int, bool) {
+	segs, ok := parse(content)
+	if !ok {
+		return "", 0, false
+	}
+	var sb strings.Builder
+	n := 0
+	for _, s := range segs {
+		if s.conflict == nil {
+			sb.WriteString(s.text)
+			continue
+		}
+		resolution, ok := lookup(*s.conflict)
+		if !ok {
+			return "", 0, false
+		}
+		sb.WriteString(resolution)
+		n++
+	}
+	return sb.String(), n, true
+}
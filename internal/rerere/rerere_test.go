@@ -0,0 +1,88 @@
+package rerere_test
+
+import (
+	"testing"
+
+	"github.com/aviator-co/av/internal/rerere"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const preimage = `a
+<<<<<<< HEAD
+b1
+=======
+b2
+>>>>>>> 1234567 (change b)
+c
+<<<<<<< HEAD
+d1
+||||||| parent of 1234567 (change b)
+d
+=======
+d2
+>>>>>>> 1234567 (change b)
+e
+`
+
+func TestConflicts(t *testing.T) {
+	conflicts := rerere.Conflicts(preimage)
+	assert.Equal(t, []rerere.Conflict{
+		{Ours: "b1\n", Theirs: "b2\n"},
+		{Ours: "d1\n", Theirs: "d2\n"},
+	}, conflicts)
+	assert.Empty(t, rerere.Conflicts("a\nb\n"))
+	assert.Empty(t, rerere.Conflicts("a\n<<<<<<< HEAD\nb\n"))
+}
+
+func TestConflictKeyIgnoresOrder(t *testing.T) {
+	assert.Equal(
+		t,
+		rerere.Conflict{Ours: "x\n", Theirs: "y\n"}.Key(),
+		rerere.Conflict{Ours: "y\n", Theirs: "x\n"}.Key(),
+	)
+	assert.NotEqual(
+		t,
+		rerere.Conflict{Ours: "x\n", Theirs: "y\n"}.Key(),
+		rerere.Conflict{Ours: "x\n", Theirs: "z\n"}.Key(),
+	)
+}
+
+func TestExtractAndApply(t *testing.T) {
+	resolutions := rerere.ExtractResolutions(preimage, "a\nb1\nb2\nc\nd2\ne\n")
+	require.Len(t, resolutions, 2)
+	assert.Equal(t, "b1\nb2\n", resolutions[rerere.Conflict{Ours: "b1\n", Theirs: "b2\n"}.Key()])
+	assert.Equal(t, "d2\n", resolutions[rerere.Conflict{Ours: "d1\n", Theirs: "d2\n"}.Key()])
+
+	lookup := func(c rerere.Conflict) (string, bool) {
+		r, ok := resolutions[c.Key()]
+		return r, ok
+	}
+	// The same conflicts in a different place of a different file.
+	out, n, ok := rerere.Apply("x\n<<<<<<< HEAD\nd2\n=======\nd1\n>>>>>>> abc\ny\n", lookup)
+	require.True(t, ok)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, "x\nd2\ny\n", out)
+
+	// An unknown conflict is not resolved.
+	_, _, ok = rerere.Apply("<<<<<<< HEAD\nd1\n=======\nd3\n>>>>>>> abc\n", lookup)
+	assert.False(t, ok)
+}
+
+func TestExtractResolutionsWithChangedContext(t *testing.T) {
+	// The text outside the conflicts was changed, so the resolutions cannot be
+	// determined.
+	assert.Nil(t, rerere.ExtractResolutions(preimage, "a\nb1\nC\nd2\ne\n"))
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s := rerere.Open(dir)
+	assert.Equal(t, 2, s.Record("file", preimage, "a\nb2\nc\nd1\ne\n"))
+	require.NoError(t, s.Save())
+
+	s = rerere.Open(dir)
+	r, ok := s.Lookup(rerere.Conflict{Ours: "b2\n", Theirs: "b1\n"})
+	assert.True(t, ok)
+	assert.Equal(t, "b2\n", r)
+}
@@ -0,0 +1,77 @@
+package rerere
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Store is the set of the recorded resolutions.
+type Store struct {
+	path string
+	// The resolutions keyed by Conflict.Key.
+	Resolutions map[string]*Resolution `json:"resolutions"`
+}
+
+type Resolution struct {
+	// The text that replaces the conflict.
+	Text string `json:"text"`
+	// The file that the resolution was recorded for. This is informational
+	// only, since the same conflict can happen in any file.
+	File       string    `json:"file"`
+	RecordedAt time.Time `json:"recordedAt"`
+}
+
+// Open reads the resolutions stored in the av directory. A missing or broken
+// file is treated as empty.
+func Open(avDir string) *Store {
+	s := &Store{
+		path:        filepath.Join(avDir, "rerere.json"),
+		Resolutions: map[string]*Resolution{},
+	}
+	if bs, err := os.ReadFile(s.path); err == nil {
+		if err := json.Unmarshal(bs, s); err != nil || s.Resolutions == nil {
+			logrus.WithError(err).Debug("ignoring the invalid rerere file")
+			s.Resolutions = map[string]*Resolution{}
+		}
+	}
+	return s
+}
+
+// Lookup returns the recorded resolution of the conflict.
+func (s *Store) Lookup(c Conflict) (string, bool) {
+	r, ok := s.Resolutions[c.Key()]
+	if !ok {
+		return "", false
+	}
+	return r.Text, true
+}
+
+// Record records the resolutions of the conflicts in the preimage. Returns the
+// number of the recorded resolutions.
+func (s *Store) Record(file, preimage, resolved string) int {
+	resolutions := ExtractResolutions(preimage, resolved)
+	now := time.Now()
+	for key, text := range resolutions {
+		s.Resolutions[key] = &Resolution{Text: text, File: file, RecordedAt: now}
+	}
+	return len(resolutions)
+}
+
+// Save writes the resolutions to the av directory. The resolutions that were
+// recorded long ago are dropped to keep the file small.
+func (s *Store) Save() error {
+	for key, r := range s.Resolutions {
+		if time.Since(r.RecordedAt) > 90*24*time.Hour {
+			delete(s.Resolutions, key)
+		}
+	}
+	bs, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, bs, 0o644)
+}
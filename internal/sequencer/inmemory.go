@@ -0,0 +1,222 @@
+package sequencer
+
+import (
+	"context"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/sirupsen/logrus"
+)
+
+// rebaseInMemory replays the commits of the branch after branchingPoint onto
+// newParentHash with `git merge-tree` and `git commit-tree`, and updates the
+// branch ref directly. Unlike `git rebase`, this doesn't check out the branch,
+// so the working tree is not touched unless the branch is checked out in the
+// current worktree (in which case only the changed files are updated).
+//
+// Returns false without changing anything if the commits cannot be replayed
+// cleanly (e.g., a conflict that needs manual resolution, a merge commit, or a
+// git older than 2.38 without `git merge-tree --write-tree`). The caller
+// should fall back to `git rebase` in that case.
+func (seq *Sequencer) rebaseInMemory(
+	ctx context.Context,
+	repo *git.Repo,
+	branch plumbing.ReferenceName,
+	branchingPoint, newParentHash plumbing.Hash,
+) (bool, error) {
+	log := logrus.WithField("branch", branch.Short())
+	if !repo.SupportsMergeTreeWriteTree(ctx) {
+		log.Debug("cannot restack in memory: git merge-tree --write-tree is not supported")
+		return false, nil
+	}
+	head, err := seq.getBranchCommit(repo, branch)
+	if err != nil {
+		return false, err
+	}
+	res, err := replayCommits(ctx, repo, head, branchingPoint, newParentHash, false)
+	if err != nil {
+		// git rebase may still be able to handle it.
+		log.WithError(err).Debug("cannot restack in memory: failed to replay the commits")
+		return false, nil
+	}
+	if res.NonLinear {
+		log.Debug("cannot restack in memory: the history is not linear")
+		return false, nil
+	}
+	if len(res.Conflicts) > 0 {
+		log.WithField("commit", res.Conflicts[0].Commit).
+			WithField("files", res.Conflicts[0].Files).
+			Debug("cannot restack in memory: conflict")
+		return false, nil
+	}
+	if res.Head == head.String() {
+		return true, nil
+	}
+	return seq.updateRestackedBranch(ctx, repo, branch, head.String(), res.Head)
+}
+
+type replayResult struct {
+	// The new head commit. Empty if the replay stopped at a conflict.
+	Head string
+	// True if the commits cannot be replayed because the history is not
+	// linear.
+	NonLinear bool
+	// The commits that conflicted.
+	Conflicts []*CommitConflict
+}
+
+// CommitConflict is a commit that conflicts when it's replayed onto the new
+// parent.
+type CommitConflict struct {
+	Commit  string
+	Subject string
+	Files   []string
+}
+
+// replayCommits creates the commits of branchingPoint..head replayed onto
+// newParentHash. No refs are updated.
+//
+// If keepConflicts is false, this stops at the first conflict. Otherwise, the
+// conflicted files are committed with the conflict markers and the replay
+// continues, so that all the conflicting commits can be reported.
+func replayCommits(
+	ctx context.Context,
+	repo *git.Repo,
+	head, branchingPoint, newParentHash plumbing.Hash,
+	keepConflicts bool,
+) (*replayResult, error) {
+	hashes, err := repo.RevList(ctx, git.RevListOpts{
+		Specifiers: []string{head.String(), "^" + branchingPoint.String()},
+		Reverse:    true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var commits []*git.Commit
+	if len(hashes) > 0 {
+		objects, err := repo.GetRefs(ctx, &git.GetRefs{Revisions: hashes})
+		if err != nil {
+			return nil, err
+		}
+		prev := branchingPoint.String()
+		for _, obj := range objects {
+			commit, err := git.ParseCommitContents(obj.Contents)
+			if err != nil {
+				return nil, errors.WrapIff(err, "parsing commit %s", obj.OID)
+			}
+			if len(commit.Parents) != 1 || commit.Parents[0] != prev {
+				return &replayResult{NonLinear: true}, nil
+			}
+			commits = append(commits, &commit)
+			prev = obj.OID
+		}
+	}
+
+	baseTree, err := repo.RevParse(ctx, &git.RevParse{Rev: branchingPoint.String() + "^{tree}"})
+	if err != nil {
+		return nil, err
+	}
+	parent := newParentHash.String()
+	parentTree, err := repo.RevParse(ctx, &git.RevParse{Rev: parent + "^{tree}"})
+	if err != nil {
+		return nil, err
+	}
+	ret := &replayResult{}
+	for i, c := range commits {
+		hash := hashes[i]
+		var tree string
+		switch {
+		case c.Parents[0] == parent:
+			// The commit is already on top of the new parent.
+			parent, parentTree, baseTree = hash, c.Tree, c.Tree
+			continue
+		case baseTree == parentTree:
+			// The content is the same as the original parent, so the tree of
+			// the commit can be used as-is.
+			tree = c.Tree
+		default:
+			merged, err := repo.MergeTree(ctx, &git.MergeTree{
+				Branch1:   parent,
+				Branch2:   hash,
+				MergeBase: c.Parents[0],
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(merged.ConflictedFiles) > 0 {
+				subject, _, _ := strings.Cut(c.Message, "\n")
+				ret.Conflicts = append(ret.Conflicts, &CommitConflict{
+					Commit:  hash,
+					Subject: subject,
+					Files:   merged.ConflictedFiles,
+				})
+				if !keepConflicts {
+					return ret, nil
+				}
+			}
+			tree = merged.Tree
+		}
+		if tree == parentTree && c.Tree != baseTree {
+			// The changes of the commit are already in the new parent. Drop the
+			// commit as git rebase does.
+			baseTree = c.Tree
+			continue
+		}
+		newCommit, err := repo.CommitTree(ctx, &git.CommitTree{
+			Tree:    tree,
+			Parents: []string{parent},
+			Message: c.Message,
+			Author:  c.Author,
+		})
+		if err != nil {
+			return nil, err
+		}
+		parent, parentTree, baseTree = newCommit, tree, c.Tree
+	}
+	ret.Head = parent
+	return ret, nil
+}
+
+// updateRestackedBranch points the branch to the restacked commit. If the
+// branch is checked out in a worktree (the current one or another), that
+// worktree is updated with `git reset --keep`, which only touches the files that
+// changed and keeps the local changes. Returns false if the branch cannot be
+// updated in place.
+func (seq *Sequencer) updateRestackedBranch(
+	ctx context.Context,
+	repo *git.Repo,
+	branch plumbing.ReferenceName,
+	oldHead, newHead string,
+) (bool, error) {
+	worktrees, err := repo.WorktreeList(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, wt := range worktrees {
+		if wt.Branch != branch.Short() {
+			continue
+		}
+		wtRepo, err := repo.OpenWorktree(ctx, wt.Path)
+		if err != nil {
+			return false, err
+		}
+		if _, err := wtRepo.Run(ctx, &git.RunOpts{
+			Args:      []string{"reset", "--quiet", "--keep", newHead},
+			ExitError: true,
+		}); err != nil {
+			logrus.WithError(err).Debug("cannot restack in memory: failed to update the worktree")
+			return false, nil
+		}
+		return true, nil
+	}
+	if err := repo.UpdateRef(ctx, &git.UpdateRef{
+		Ref: branch.String(),
+		New: newHead,
+		Old: oldHead,
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
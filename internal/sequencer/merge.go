@@ -0,0 +1,162 @@
+package sequencer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/sirupsen/logrus"
+)
+
+// mergeBranch merges the new parent into the branch instead of rebasing it
+// (sync.strategy: merge), so that the branch is only fast-forwarded and never
+// rewritten.
+//
+// Like rebaseInMemory, the merge is done with `git merge-tree` without checking
+// out the branch if possible. If the merge conflicts, the branch is checked out
+// and merged with `git merge` in branchRepo so that the conflicts can be
+// resolved.
+func (seq *Sequencer) mergeBranch(
+	ctx context.Context,
+	repo *git.Repo,
+	branchRepo *git.Repo,
+	op RestackOp,
+	newParentHash plumbing.Hash,
+) (*git.RebaseResult, error) {
+	head, err := seq.getBranchCommit(repo, op.Name)
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := repo.IsAncestor(ctx, newParentHash.String(), head.String()); err != nil {
+		return nil, err
+	} else if ok {
+		return &git.RebaseResult{Status: git.RebaseAlreadyUpToDate}, nil
+	}
+	message := mergeMessage(op)
+
+	var newHead string
+	if ok, err := repo.IsAncestor(ctx, head.String(), newParentHash.String()); err != nil {
+		return nil, err
+	} else if ok {
+		// The branch has no commits of its own. Fast-forward.
+		newHead = newParentHash.String()
+	} else if !repo.SupportsMergeTreeWriteTree(ctx) {
+		logrus.WithField("branch", op.Name.Short()).
+			Debug("cannot merge in memory: git merge-tree --write-tree is not supported")
+	} else if merged, err := repo.MergeTree(ctx, &git.MergeTree{
+		Branch1: head.String(),
+		Branch2: newParentHash.String(),
+	}); err != nil {
+		// git merge may still be able to handle it.
+		logrus.WithField("branch", op.Name.Short()).WithError(err).
+			Debug("cannot merge in memory: git merge-tree failed")
+	} else {
+		if len(merged.ConflictedFiles) == 0 {
+			newHead, err = repo.CommitTree(ctx, &git.CommitTree{
+				Tree:    merged.Tree,
+				Parents: []string{head.String(), newParentHash.String()},
+				Message: message,
+			})
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			logrus.WithField("branch", op.Name.Short()).
+				WithField("files", merged.ConflictedFiles).
+				Debug("cannot merge in memory: conflict")
+		}
+	}
+	if newHead != "" {
+		ok, err := seq.updateRestackedBranch(ctx, repo, op.Name, head.String(), newHead)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &git.RebaseResult{Status: git.RebaseUpdated}, nil
+		}
+	}
+
+	if branchRepo != repo {
+		// The branch is restacked in place in its worktree where it's already
+		// checked out. Keep the local changes there.
+		return branchRepo.MergeParse(ctx, git.MergeOpts{
+			Commit:    newParentHash.String(),
+			Message:   message,
+			Autostash: true,
+		})
+	}
+	if err := seq.detachWorktreeOf(ctx, repo, op.Name); err != nil {
+		return nil, err
+	}
+	if _, err := repo.CheckoutBranch(ctx, &git.CheckoutBranch{Name: op.Name.Short()}); err != nil {
+		return nil, err
+	}
+	return repo.MergeParse(ctx, git.MergeOpts{Commit: newParentHash.String(), Message: message})
+}
+
+func mergeMessage(op RestackOp) string {
+	return fmt.Sprintf("Merge branch '%s' into %s", op.NewParent.Short(), op.Name.Short())
+}
+
+// simulateMerge is the counterpart of mergeBranch for Simulate. Returns the
+// merged commit (with the conflict markers if any) without updating the branch.
+func simulateMerge(
+	ctx context.Context,
+	repo *git.Repo,
+	op RestackOp,
+	head, newParentHash plumbing.Hash,
+) (string, []*CommitConflict, error) {
+	if ok, err := repo.IsAncestor(ctx, newParentHash.String(), head.String()); err != nil {
+		return "", nil, err
+	} else if ok {
+		return head.String(), nil, nil
+	}
+	if ok, err := repo.IsAncestor(ctx, head.String(), newParentHash.String()); err != nil {
+		return "", nil, err
+	} else if ok {
+		return newParentHash.String(), nil, nil
+	}
+	merged, err := repo.MergeTree(ctx, &git.MergeTree{
+		Branch1: head.String(),
+		Branch2: newParentHash.String(),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	var conflicts []*CommitConflict
+	if len(merged.ConflictedFiles) > 0 {
+		conflicts = append(conflicts, &CommitConflict{
+			Commit:  newParentHash.String(),
+			Subject: mergeMessage(op),
+			Files:   merged.ConflictedFiles,
+		})
+	}
+	newHead, err := repo.CommitTree(ctx, &git.CommitTree{
+		Tree:    merged.Tree,
+		Parents: []string{head.String(), newParentHash.String()},
+		Message: mergeMessage(op),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return newHead, conflicts, nil
+}
+
+// continueInterrupted concludes the rebase or merge step that stopped with
+// conflicts after the user resolved them.
+func (seq *Sequencer) continueInterrupted(ctx context.Context, repo *git.Repo) (*git.RebaseResult, error) {
+	if seq.mergesBranch(seq.getCurrentOp()) {
+		return repo.MergeParse(ctx, git.MergeOpts{Continue: true})
+	}
+	return repo.RebaseParse(ctx, git.RebaseOpts{Continue: true})
+}
+
+// interruptedCommitRef returns the ref of the commit that is being applied when
+// the sequencer is stopped with conflicts.
+func (seq *Sequencer) interruptedCommitRef() string {
+	if seq.mergesBranch(seq.getCurrentOp()) {
+		return "MERGE_HEAD"
+	}
+	return "REBASE_HEAD"
+}
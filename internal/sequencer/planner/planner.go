@@ -17,10 +17,13 @@ func PlanForRestack(
 	repo *git.Repo,
 	currentBranch plumbing.ReferenceName,
 	restackAll, restackCurrent bool,
+	label string,
 ) ([]sequencer.RestackOp, error) {
 	var targetBranches []plumbing.ReferenceName
 	var err error
-	if restackAll {
+	if label != "" {
+		targetBranches, err = GetLabeledTargetBranches(ctx, tx, repo, false, label)
+	} else if restackAll {
 		targetBranches, err = GetTargetBranches(ctx, tx, repo, false, AllBranches)
 	} else if restackCurrent {
 		targetBranches, err = GetTargetBranches(ctx, tx, repo, false, CurrentAndParents)
@@ -57,10 +60,13 @@ func PlanForSync(
 	repo *git.Repo,
 	currentBranch plumbing.ReferenceName,
 	restackAll, restackCurrent, restackStackRoots bool,
+	label string,
 ) ([]sequencer.RestackOp, error) {
 	var targetBranches []plumbing.ReferenceName
 	var err error
-	if restackAll {
+	if label != "" {
+		targetBranches, err = GetLabeledTargetBranches(ctx, tx, repo, true, label)
+	} else if restackAll {
 		targetBranches, err = GetTargetBranches(ctx, tx, repo, true, AllBranches)
 	} else if restackCurrent {
 		targetBranches, err = GetTargetBranches(ctx, tx, repo, true, CurrentAndParents)
@@ -94,6 +100,7 @@ func PlanForSync(
 					Name:             br,
 					NewParent:        plumbing.NewBranchReferenceName(trunk),
 					NewParentIsTrunk: true,
+					Rebase:           true,
 				})
 				continue
 			}
@@ -126,6 +133,7 @@ func PlanForReparent(
 		Name:             currentBranch,
 		NewParent:        newParentBranch,
 		NewParentIsTrunk: isParentTrunk,
+		Rebase:           true,
 	})
 	for _, child := range children {
 		avbr, _ := tx.Branch(child)
@@ -110,3 +110,29 @@ func GetTargetBranches(
 	}
 	return ret, nil
 }
+
+// GetLabeledTargetBranches returns the branches that have the given label, in
+// the order they should be restacked.
+//
+// If `includeStackRoots` is true, the labeled stack root branches are included
+// in the result.
+func GetLabeledTargetBranches(
+	ctx context.Context,
+	tx meta.ReadTx,
+	repo *git.Repo,
+	includeStackRoots bool,
+	label string,
+) ([]plumbing.ReferenceName, error) {
+	var ret []plumbing.ReferenceName
+	for _, n := range meta.LabeledBranches(tx, label) {
+		br, _ := tx.Branch(n)
+		if br.IsStackRoot() && !includeStackRoots {
+			continue
+		}
+		ref := plumbing.NewBranchReferenceName(n)
+		if exists, _ := repo.DoesRefExist(ctx, ref.String()); exists {
+			ret = append(ret, ref)
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,121 @@
+package sequencer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/rerere"
+	"github.com/sirupsen/logrus"
+)
+
+// resolveWithRecordedResolutions resolves the conflicts of the in-progress
+// rebase (or merge) with the resolutions recorded in the previous restacks, and
+// continues it. This is repeated as long as every conflict has a recorded
+// resolution. Returns the result of the last rebase step.
+//
+// If some of the conflicts cannot be resolved, the conflicted files are saved
+// in ConflictPreimages so that the resolutions made by the user can be recorded
+// on --continue.
+func (seq *Sequencer) resolveWithRecordedResolutions(
+	ctx context.Context,
+	repo *git.Repo,
+	result *git.RebaseResult,
+) (*git.RebaseResult, error) {
+	store := rerere.Open(repo.AvDir())
+	for result.Status == git.RebaseConflict {
+		files, err := unmergedFiles(ctx, repo)
+		if err != nil {
+			return nil, err
+		}
+		preimages := map[string]string{}
+		resolved := map[string]string{}
+		counts := map[string]int{}
+		for _, file := range files {
+			bs, err := os.ReadFile(filepath.Join(repo.Dir(), file))
+			if err != nil {
+				// Deleted or otherwise not a regular file. This needs a manual
+				// resolution.
+				continue
+			}
+			content := string(bs)
+			if len(rerere.Conflicts(content)) == 0 {
+				continue
+			}
+			preimages[file] = content
+			if out, n, ok := rerere.Apply(content, store.Lookup); ok {
+				resolved[file] = out
+				counts[file] = n
+			}
+		}
+		if len(files) == 0 || len(resolved) != len(files) {
+			seq.ConflictPreimages = preimages
+			return result, nil
+		}
+
+		commit, _ := repo.Git(ctx, "rev-parse", "--short", seq.interruptedCommitRef())
+		for _, file := range files {
+			if err := os.WriteFile(filepath.Join(repo.Dir(), file), []byte(resolved[file]), 0o644); err != nil {
+				return nil, err
+			}
+			seq.AutoResolved = append(seq.AutoResolved, fmt.Sprintf(
+				"Reused the recorded resolution of %d conflict(s) in %s (%s, commit %s)",
+				counts[file], file, seq.CurrentSyncRef.Short(), commit,
+			))
+		}
+		if _, err := repo.Run(ctx, &git.RunOpts{
+			Args:      append([]string{"add", "--"}, files...),
+			ExitError: true,
+		}); err != nil {
+			return nil, err
+		}
+		result, err = seq.continueInterrupted(ctx, repo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	seq.ConflictPreimages = nil
+	return result, nil
+}
+
+// recordResolutions records how the user resolved the conflicts saved in
+// ConflictPreimages. The resolutions are read from the index, so this must be
+// called after the user staged the resolved files.
+func (seq *Sequencer) recordResolutions(ctx context.Context, repo *git.Repo) {
+	if len(seq.ConflictPreimages) == 0 {
+		return
+	}
+	store := rerere.Open(repo.AvDir())
+	recorded := 0
+	for file, preimage := range seq.ConflictPreimages {
+		out, err := repo.Run(ctx, &git.RunOpts{
+			Args:      []string{"show", ":" + file},
+			ExitError: true,
+		})
+		if err != nil {
+			// The file is deleted or still unmerged.
+			continue
+		}
+		recorded += store.Record(file, preimage, string(out.Stdout))
+	}
+	seq.ConflictPreimages = nil
+	if recorded == 0 {
+		return
+	}
+	if err := store.Save(); err != nil {
+		logrus.WithError(err).Warn("failed to save the recorded conflict resolutions")
+	}
+}
+
+func unmergedFiles(ctx context.Context, repo *git.Repo) ([]string, error) {
+	out, err := repo.Run(ctx, &git.RunOpts{
+		Args:      []string{"diff", "--name-only", "--diff-filter=U"},
+		ExitError: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Lines(), nil
+}
@@ -7,9 +7,10 @@ import (
 	"path/filepath"
 
 	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/config"
 	"github.com/aviator-co/av/internal/git"
 	"github.com/aviator-co/av/internal/meta"
-	"github.com/go-git/go-git/v5/config"
+	gitconfig "github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/sirupsen/logrus"
 )
@@ -27,6 +28,12 @@ type RestackOp struct {
 	// branch hash if the new parent is not trunk. Or if the new parent is trunk, the sequencer
 	// will use the remote tracking branch's hash.
 	NewParentHash plumbing.Hash
+
+	// If true, the branch is rebased even with sync.strategy: merge. Set by the
+	// callers that move the branch onto another parent and drop the commits of
+	// the old parent, since a merge cannot drop them. NewSequencer sets it for
+	// the descendants of such a branch as well.
+	Rebase bool
 }
 
 type branchSnapshot struct {
@@ -59,10 +66,43 @@ type Sequencer struct {
 
 	Operations []RestackOp
 
-	// Worktrees that were detached before rebasing. Maps branch name (short) to worktree path.
+	// Worktrees that were detached to run git rebase (or git merge) on their branches. Maps
+	// branch name (short) to worktree path.
 	DetachedWorktrees map[string]string
 	// Branches skipped due to dirty worktrees. Maps branch name (short) to reason.
 	SkippedBranches map[string]string
+
+	// The contents of the conflicted files (with conflict markers) when the rebase is
+	// stopped. Used to record the resolutions on --continue. Maps file path to content.
+	ConflictPreimages map[string]string
+	// The conflicts that were resolved automatically with the recorded resolutions.
+	AutoResolved []string
+
+	// If true, the new parent is merged into the branches instead of rebasing them
+	// (sync.strategy: merge). The branches that are moved onto another parent are
+	// still rebased (see mergesBranch).
+	Merge bool
+	// The warnings to show to the user after the sequence (e.g., a branch that is
+	// rebased even though Merge is set).
+	Warnings []string
+
+	// If true, the local changes in the current worktree are stashed before restacking
+	// instead of skipping its branch, and restored when the sequence finishes or is
+	// aborted (--autostash).
+	Autostash bool
+	// If true, the local changes in the other worktrees whose branches are restacked are
+	// stashed as well instead of skipping the branches (sync.autostashWorktrees).
+	AutostashWorktrees bool
+	// The stashes created by Autostash. Maps worktree path to stash commit.
+	Stashes map[string]string
+
+	// If true, the branches checked out in the other worktrees are restacked in those
+	// worktrees instead of detaching the worktrees (sync.restackInWorktrees).
+	RestackInWorktrees bool
+	// Branches restacked in their worktrees. Maps branch name (short) to worktree path.
+	InPlaceWorktrees map[string]string
+	// If the rebase is stopped in one of InPlaceWorktrees, the path of the worktree.
+	InterruptedWorktree string
 }
 
 func NewSequencer(remoteName string, db meta.DB, ops []RestackOp) *Sequencer {
@@ -70,11 +110,24 @@ func NewSequencer(remoteName string, db meta.DB, ops []RestackOp) *Sequencer {
 	if len(ops) > 0 {
 		currentSyncRef = ops[0].Name
 	}
+	// The branches based on a rebased branch are rebased as well. Merging would
+	// keep the commits of the branch from before the rebase.
+	rebased := map[plumbing.ReferenceName]bool{}
+	for i := range ops {
+		if rebased[ops[i].NewParent] {
+			ops[i].Rebase = true
+		}
+		if ops[i].Rebase {
+			rebased[ops[i].Name] = true
+		}
+	}
 	return &Sequencer{
 		RemoteName:              remoteName,
 		OriginalBranchSnapshots: getBranchSnapshots(db),
 		Operations:              ops,
 		CurrentSyncRef:          currentSyncRef,
+		Merge:                   config.Av.Sync.UseMerge(),
+		RestackInWorktrees:      config.Av.Sync.RestackInWorktrees,
 	}
 }
 
@@ -109,7 +162,7 @@ func (seq *Sequencer) Run(
 	}
 
 	if seq.DetachedWorktrees == nil {
-		if _, err := seq.PrepareWorktrees(ctx, repo); err != nil {
+		if err := seq.PrepareWorktrees(ctx, repo); err != nil {
 			return nil, err
 		}
 		if seq.CurrentSyncRef == "" {
@@ -132,44 +185,72 @@ func (seq *Sequencer) runFromInterruptedState(
 	if seq.SequenceInterruptedNewParentHash.IsZero() {
 		panic("broken interruption state: no new parent hash")
 	}
+	// The rebase may be stopped in the worktree of a branch that is restacked in
+	// place. Resume it there.
+	interruptedRepo, err := seq.interruptedRepo(ctx, repo)
+	if err != nil {
+		return nil, err
+	}
 	if seqAbort {
 		// Abort the rebase if we need to
-		if stat, _ := os.Stat(filepath.Join(repo.WorktreeGitDir(), "REBASE_HEAD")); stat != nil {
-			if _, err := repo.Rebase(ctx, git.RebaseOpts{Abort: true}); err != nil {
+		if stat, _ := os.Stat(filepath.Join(interruptedRepo.WorktreeGitDir(), "REBASE_HEAD")); stat != nil {
+			if _, err := interruptedRepo.Rebase(ctx, git.RebaseOpts{Abort: true}); err != nil {
 				return nil, errors.Errorf("failed to abort in-progress rebase: %v", err)
 			}
 		}
+		if interruptedRepo.IsMergeInProgress() {
+			if _, err := interruptedRepo.MergeParse(ctx, git.MergeOpts{Abort: true}); err != nil {
+				return nil, errors.Errorf("failed to abort in-progress merge: %v", err)
+			}
+		}
 		seq.CurrentSyncRef = ""
 		seq.SequenceInterruptedNewParentHash = plumbing.ZeroHash
+		seq.ConflictPreimages = nil
+		seq.InterruptedWorktree = ""
 		return nil, nil
 	}
 	if seqContinue {
-		if err := seq.checkNoUnstagedChanges(ctx, repo); err != nil {
+		if err := seq.checkNoUnstagedChanges(ctx, interruptedRepo); err != nil {
 			return nil, errors.Errorf(
 				"refusing to sync: there are unstaged changes in the working tree at %s (use `git add` to stage changes)",
-				repo.Dir(),
+				interruptedRepo.Dir(),
 			)
 		}
-		result, err := repo.RebaseParse(ctx, git.RebaseOpts{Continue: true})
+		seq.recordResolutions(ctx, interruptedRepo)
+		result, err := seq.continueInterrupted(ctx, interruptedRepo)
 		if err != nil {
 			return nil, errors.Errorf("failed to continue in-progress rebase: %v", err)
 		}
+		result, err = seq.resolveWithRecordedResolutions(ctx, interruptedRepo, result)
+		if err != nil {
+			return nil, err
+		}
 		if result.Status == git.RebaseConflict {
 			return result, nil
 		}
+		seq.InterruptedWorktree = ""
 		if err := seq.postRebaseBranchUpdate(db, seq.SequenceInterruptedNewParentHash); err != nil {
 			return nil, err
 		}
 		return result, nil
 	}
 	if seqSkip {
-		result, err := repo.RebaseParse(ctx, git.RebaseOpts{Skip: true})
+		if seq.mergesBranch(seq.getCurrentOp()) {
+			return nil, errors.New("cannot skip a merge (sync.strategy is merge); resolve the conflicts or abort")
+		}
+		seq.ConflictPreimages = nil
+		result, err := interruptedRepo.RebaseParse(ctx, git.RebaseOpts{Skip: true})
 		if err != nil {
 			return nil, errors.Errorf("failed to skip in-progress rebase: %v", err)
 		}
+		result, err = seq.resolveWithRecordedResolutions(ctx, interruptedRepo, result)
+		if err != nil {
+			return nil, err
+		}
 		if result.Status == git.RebaseConflict {
 			return result, nil
 		}
+		seq.InterruptedWorktree = ""
 		if err := seq.postRebaseBranchUpdate(db, seq.SequenceInterruptedNewParentHash); err != nil {
 			return nil, err
 		}
@@ -184,44 +265,49 @@ func (seq *Sequencer) rebaseBranch(
 	db meta.DB,
 ) (*git.RebaseResult, error) {
 	op := seq.getCurrentOp()
-	snapshot, ok := seq.OriginalBranchSnapshots[op.Name]
-	if !ok {
-		panic(fmt.Sprintf("branch %q not found in original branch infos", op.Name))
+	branchingPoint, newParentHash, err := seq.rebaseTarget(ctx, repo, op)
+	if err != nil {
+		return nil, err
+	}
+	// The repo to run git rebase (or git merge) in. This is the worktree of the branch
+	// if it's restacked in place.
+	branchRepo, err := seq.branchRepo(ctx, repo, op.Name)
+	if err != nil {
+		return nil, err
 	}
 
-	var branchingPoint plumbing.Hash
-	if snapshot.BranchingPointCommitHash.IsZero() {
-		// If the branching point is not specified, find the merge-base with the parent's remote-tracking branch.
-		rtb, err := seq.getRemoteTrackingBranch(repo, snapshot.ParentBranch)
-		if err != nil {
-			return nil, err
-		}
-		mb, err := repo.MergeBase(ctx, rtb.String(), op.Name.String())
+	if seq.mergesBranch(op) {
+		result, err := seq.mergeBranch(ctx, repo, branchRepo, op, newParentHash)
 		if err != nil {
 			return nil, err
 		}
-		branchingPoint = plumbing.NewHash(mb)
-	} else {
-		branchingPoint = snapshot.BranchingPointCommitHash
-	}
-
-	var newParentHash plumbing.Hash
-	if op.NewParentHash.IsZero() {
-		if op.NewParentIsTrunk {
-			var err error
-			newParentHash, err = seq.getRemoteTrackingBranchCommit(repo, op.NewParent)
-			if err != nil {
-				return nil, err
-			}
-		} else {
-			var err error
-			newParentHash, err = seq.getBranchCommit(repo, op.NewParent)
+		if result.Status == git.RebaseConflict {
+			// Reapply the resolutions recorded in the previous restacks, if any.
+			result, err = seq.resolveWithRecordedResolutions(ctx, branchRepo, result)
 			if err != nil {
 				return nil, err
 			}
 		}
-	} else {
-		newParentHash = op.NewParentHash
+		if result.Status == git.RebaseConflict {
+			result.ErrorHeadline = fmt.Sprintf(
+				"Failed to merge %q into %q\n",
+				op.NewParent,
+				op.Name,
+			) + result.ErrorHeadline
+			seq.setInterrupted(repo, branchRepo, newParentHash)
+			return result, nil
+		}
+		if err := seq.postRebaseBranchUpdate(db, newParentHash); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	if seq.Merge {
+		seq.Warnings = append(seq.Warnings, fmt.Sprintf(
+			"%s was rebased instead of merged since it's moved onto %s",
+			op.Name.Short(), op.NewParent.Short(),
+		))
 	}
 
 	// Handle a special case: If the current branch is already based on the new parent, and if
@@ -244,17 +330,42 @@ func (seq *Sequencer) rebaseBranch(
 
 	var result *git.RebaseResult
 	if !skipGitRebase {
+		// Try to replay the commits without checking out the branch first. If it cannot be
+		// done cleanly, fall back to git rebase so that the user can resolve the conflicts.
+		ok, err := seq.rebaseInMemory(ctx, repo, op.Name, branchingPoint, newParentHash)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = &git.RebaseResult{Status: git.RebaseUpdated}
+		}
+	}
+	if !skipGitRebase && result == nil {
+		if branchRepo == repo {
+			if err := seq.detachWorktreeOf(ctx, repo, op.Name); err != nil {
+				return nil, err
+			}
+		}
 		// The commits from `rebaseFrom` to `snapshot.Name` should be rebased onto `rebaseOnto`.
 		opts := git.RebaseOpts{
 			Branch:   op.Name.Short(),
 			Upstream: branchingPoint.String(),
 			Onto:     newParentHash.String(),
+			// Keep the local changes in the worktree of the branch. They're
+			// restored when the rebase finishes or is aborted.
+			Autostash: branchRepo != repo,
 		}
-		var err error
-		result, err = repo.RebaseParse(ctx, opts)
+		result, err = branchRepo.RebaseParse(ctx, opts)
 		if err != nil {
 			return nil, err
 		}
+		if result.Status == git.RebaseConflict {
+			// Reapply the resolutions recorded in the previous restacks, if any.
+			result, err = seq.resolveWithRecordedResolutions(ctx, branchRepo, result)
+			if err != nil {
+				return nil, err
+			}
+		}
 		if result.Status == git.RebaseConflict {
 			result.ErrorHeadline = fmt.Sprintf(
 				"Failed to rebase %q onto %q (merge base is %q)\n",
@@ -262,10 +373,10 @@ func (seq *Sequencer) rebaseBranch(
 				op.NewParent,
 				branchingPoint.String()[:7],
 			) + result.ErrorHeadline
-			seq.SequenceInterruptedNewParentHash = newParentHash
+			seq.setInterrupted(repo, branchRepo, newParentHash)
 			return result, nil
 		}
-	} else {
+	} else if skipGitRebase {
 		result = &git.RebaseResult{
 			Status: git.RebaseAlreadyUpToDate,
 		}
@@ -276,6 +387,101 @@ func (seq *Sequencer) rebaseBranch(
 	return result, nil
 }
 
+// mergesBranch reports whether the new parent is merged into the branch instead of
+// rebasing it. See RestackOp.Rebase.
+func (seq *Sequencer) mergesBranch(op RestackOp) bool {
+	return seq.Merge && !op.Rebase
+}
+
+func (seq *Sequencer) setInterrupted(repo, branchRepo *git.Repo, newParentHash plumbing.Hash) {
+	seq.SequenceInterruptedNewParentHash = newParentHash
+	if branchRepo != repo {
+		seq.InterruptedWorktree = branchRepo.Dir()
+	}
+}
+
+// branchRepo returns the repo to restack the branch in: the worktree that has the
+// branch checked out if the branch is restacked in place, or repo otherwise.
+func (seq *Sequencer) branchRepo(
+	ctx context.Context,
+	repo *git.Repo,
+	branch plumbing.ReferenceName,
+) (*git.Repo, error) {
+	if wtPath, ok := seq.InPlaceWorktrees[branch.Short()]; ok {
+		return repo.OpenWorktree(ctx, wtPath)
+	}
+	return repo, nil
+}
+
+// interruptedRepo returns the repo of the worktree where the rebase is stopped.
+func (seq *Sequencer) interruptedRepo(ctx context.Context, repo *git.Repo) (*git.Repo, error) {
+	if seq.InterruptedWorktree == "" {
+		return repo, nil
+	}
+	return repo.OpenWorktree(ctx, seq.InterruptedWorktree)
+}
+
+// IsInterrupted reports whether the rebase (or merge) that stopped the sequencer is
+// still in progress. It can be in another worktree if the branch is restacked in
+// place. If it's not, the rebase was concluded outside of av.
+func (seq *Sequencer) IsInterrupted(ctx context.Context, repo *git.Repo) bool {
+	interruptedRepo, err := seq.interruptedRepo(ctx, repo)
+	if err != nil {
+		logrus.WithError(err).Debug("cannot open the worktree of the interrupted rebase")
+		return false
+	}
+	return interruptedRepo.IsRebaseInProgress() || interruptedRepo.IsMergeInProgress()
+}
+
+// rebaseTarget returns the commit that the branch was originally based on and the commit that
+// the branch should be rebased onto.
+func (seq *Sequencer) rebaseTarget(
+	ctx context.Context,
+	repo *git.Repo,
+	op RestackOp,
+) (plumbing.Hash, plumbing.Hash, error) {
+	snapshot, ok := seq.OriginalBranchSnapshots[op.Name]
+	if !ok {
+		panic(fmt.Sprintf("branch %q not found in original branch infos", op.Name))
+	}
+
+	var branchingPoint plumbing.Hash
+	if snapshot.BranchingPointCommitHash.IsZero() {
+		// If the branching point is not specified, find the merge-base with the parent's remote-tracking branch.
+		rtb, err := seq.getRemoteTrackingBranch(repo, snapshot.ParentBranch)
+		if err != nil {
+			return plumbing.ZeroHash, plumbing.ZeroHash, err
+		}
+		mb, err := repo.MergeBase(ctx, rtb.String(), op.Name.String())
+		if err != nil {
+			return plumbing.ZeroHash, plumbing.ZeroHash, err
+		}
+		branchingPoint = plumbing.NewHash(mb)
+	} else {
+		branchingPoint = snapshot.BranchingPointCommitHash
+	}
+
+	var newParentHash plumbing.Hash
+	if op.NewParentHash.IsZero() {
+		if op.NewParentIsTrunk {
+			var err error
+			newParentHash, err = seq.getRemoteTrackingBranchCommit(repo, op.NewParent)
+			if err != nil {
+				return plumbing.ZeroHash, plumbing.ZeroHash, err
+			}
+		} else {
+			var err error
+			newParentHash, err = seq.getBranchCommit(repo, op.NewParent)
+			if err != nil {
+				return plumbing.ZeroHash, plumbing.ZeroHash, err
+			}
+		}
+	} else {
+		newParentHash = op.NewParentHash
+	}
+	return branchingPoint, newParentHash, nil
+}
+
 func (seq *Sequencer) checkNoUnstagedChanges(ctx context.Context, repo *git.Repo) error {
 	diff, err := repo.Diff(ctx, &git.DiffOpts{Quiet: true})
 	if err != nil {
@@ -289,13 +495,14 @@ func (seq *Sequencer) checkNoUnstagedChanges(ctx context.Context, repo *git.Repo
 	return nil
 }
 
-func (seq *Sequencer) PrepareWorktrees(ctx context.Context, repo *git.Repo) ([]string, error) {
+func (seq *Sequencer) PrepareWorktrees(ctx context.Context, repo *git.Repo) error {
 	seq.DetachedWorktrees = map[string]string{}
 	seq.SkippedBranches = map[string]string{}
+	seq.InPlaceWorktrees = map[string]string{}
 
 	worktrees, err := repo.WorktreeList(ctx)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	opBranches := map[string]bool{}
@@ -305,11 +512,17 @@ func (seq *Sequencer) PrepareWorktrees(ctx context.Context, repo *git.Repo) ([]s
 
 	skippedSet := map[string]bool{}
 
+	if seq.Autostash {
+		if err := seq.stash(ctx, repo.Dir(), false); err != nil {
+			return err
+		}
+	}
+
 	// Check if the main worktree is dirty. If so, skip its checked-out branch
 	// (and descendants) instead of hard-failing.
 	diff, err := repo.Diff(ctx, &git.DiffOpts{Quiet: true})
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if !diff.Empty {
 		mainBranch, err := repo.CurrentBranchName()
@@ -327,9 +540,23 @@ func (seq *Sequencer) PrepareWorktrees(ctx context.Context, repo *git.Repo) ([]s
 		if !opBranches[wt.Branch] {
 			continue
 		}
+		if seq.RestackInWorktrees {
+			// The branch is restacked in its worktree. The local changes are
+			// kept with --autostash of git rebase.
+			seq.InPlaceWorktrees[wt.Branch] = wt.Path
+			continue
+		}
 		clean, err := git.IsWorktreeClean(ctx, wt.Path)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if !clean && seq.AutostashWorktrees {
+			// Untracked files are included as IsWorktreeClean considers them as
+			// well.
+			if err := seq.stash(ctx, wt.Path, true); err != nil {
+				return err
+			}
+			clean = true
 		}
 		if !clean {
 			reason := fmt.Sprintf("dirty worktree at %s", wt.Path)
@@ -343,26 +570,39 @@ func (seq *Sequencer) PrepareWorktrees(ctx context.Context, repo *git.Repo) ([]s
 		seq.removeSkippedOps()
 	}
 
-	var messages []string
+	// The other worktrees are not detached here. The branches checked out there are
+	// updated in place with `git reset --keep` (see updateRestackedBranch), and a
+	// worktree is detached only if git rebase has to run on its branch (see
+	// detachWorktreeOf).
+	if seq.CurrentSyncRef != "" && seq.SkippedBranches[seq.CurrentSyncRef.Short()] != "" {
+		seq.advancePastSkipped()
+	}
+
+	return nil
+}
+
+// detachWorktreeOf detaches the HEAD of the other worktree that has the branch
+// checked out, if any, so that git rebase (or git merge) can check out the branch
+// in the current worktree. The worktree is switched back to the branch by
+// RestoreWorktrees.
+func (seq *Sequencer) detachWorktreeOf(ctx context.Context, repo *git.Repo, branch plumbing.ReferenceName) error {
+	worktrees, err := repo.WorktreeList(ctx)
+	if err != nil {
+		return err
+	}
 	for _, wt := range worktrees {
-		if wt.Path == repo.Dir() || wt.Branch == "" {
-			continue
-		}
-		if !opBranches[wt.Branch] || skippedSet[wt.Branch] {
+		if wt.Path == repo.Dir() || wt.Branch != branch.Short() {
 			continue
 		}
 		if err := git.DetachWorktreeHEAD(ctx, wt.Path); err != nil {
-			return nil, err
+			return err
+		}
+		if seq.DetachedWorktrees == nil {
+			seq.DetachedWorktrees = map[string]string{}
 		}
 		seq.DetachedWorktrees[wt.Branch] = wt.Path
-		messages = append(messages, fmt.Sprintf("Detached %s in %s", wt.Branch, wt.Path))
-	}
-
-	if seq.CurrentSyncRef != "" && seq.SkippedBranches[seq.CurrentSyncRef.Short()] != "" {
-		seq.advancePastSkipped()
 	}
-
-	return messages, nil
+	return nil
 }
 
 func (seq *Sequencer) skipDescendants(skippedSet map[string]bool) {
@@ -424,6 +664,43 @@ func (seq *Sequencer) RestoreWorktrees(ctx context.Context) []string {
 	return messages
 }
 
+func (seq *Sequencer) stash(ctx context.Context, worktreePath string, includeUntracked bool) error {
+	stash, err := git.StashPush(ctx, worktreePath, "av autostash", includeUntracked)
+	if err != nil {
+		return err
+	}
+	if stash == "" {
+		return nil
+	}
+	if seq.Stashes == nil {
+		seq.Stashes = map[string]string{}
+	}
+	seq.Stashes[worktreePath] = stash
+	return nil
+}
+
+// RestoreStashes restores the local changes stashed by Autostash. This must be
+// called after the worktrees are back on their branches (see RestoreWorktrees).
+// A stash that cannot be restored is kept in `git stash list`.
+func (seq *Sequencer) RestoreStashes(ctx context.Context) []string {
+	if len(seq.Stashes) == 0 {
+		return nil
+	}
+	var messages []string
+	for wtPath, stash := range seq.Stashes {
+		if err := git.StashRestore(ctx, wtPath, stash); err != nil {
+			messages = append(messages, fmt.Sprintf(
+				"Failed to restore the stashed changes in %s (run 'git -C %s stash apply %s' manually)",
+				wtPath, wtPath, git.ShortSha(stash),
+			))
+			continue
+		}
+		messages = append(messages, fmt.Sprintf("Restored the stashed changes in %s", wtPath))
+	}
+	seq.Stashes = map[string]string{}
+	return messages
+}
+
 func (seq *Sequencer) postRebaseBranchUpdate(db meta.DB, newParentHash plumbing.Hash) error {
 	op := seq.getCurrentOp()
 	newParentBranchState := meta.BranchState{
@@ -510,7 +787,7 @@ func (seq *Sequencer) getBranchCommit(
 }
 
 func mapToRemoteTrackingBranch(
-	remoteConfig *config.RemoteConfig,
+	remoteConfig *gitconfig.RemoteConfig,
 	refName plumbing.ReferenceName,
 ) *plumbing.ReferenceName {
 	for _, fetch := range remoteConfig.Fetch {
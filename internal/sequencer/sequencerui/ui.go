@@ -103,8 +103,12 @@ func (vm *RestackModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			restoreMessages := vm.state.Seq.RestoreWorktrees(ctx)
 			vm.worktreeMessages = append(vm.worktreeMessages, restoreMessages...)
 			if cleanupErr != nil {
+				// Do not apply the stashes on top of an unexpected branch. They are
+				// kept in `git stash list`.
 				return vm, uiutils.ErrCmd(cleanupErr)
 			}
+			stashMessages := vm.state.Seq.RestoreStashes(ctx)
+			vm.worktreeMessages = append(vm.worktreeMessages, stashMessages...)
 			if vm.abortedBranch != "" {
 				return vm, vm.options.OnAbort()
 			}
@@ -116,6 +120,19 @@ func (vm *RestackModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return vm, vm.options.OnConflict()
 		}
 		if msg.err != nil {
+			if len(vm.state.Seq.Stashes) > 0 {
+				if vm.options.Skip || vm.options.Continue || vm.options.Abort {
+					// The state file of the stopped sequence is kept, and the stashes
+					// are restored when it finishes or is aborted.
+					vm.worktreeMessages = append(vm.worktreeMessages,
+						"Your local changes are still stashed and will be restored when the restack finishes or is aborted.")
+				} else {
+					// Nothing else restores the stashes of a sequence that failed
+					// before it's stopped.
+					stashMessages := vm.state.Seq.RestoreStashes(context.Background())
+					vm.worktreeMessages = append(vm.worktreeMessages, stashMessages...)
+				}
+			}
 			return vm, uiutils.ErrCmd(msg.err)
 		}
 		return vm, vm.runSeq
@@ -214,6 +231,21 @@ func (vm *RestackModel) View() tea.View {
 			sb.WriteString(colors.Faint(msg) + "\n")
 		}
 	}
+	if vm.state != nil && vm.state.Seq != nil && len(vm.state.Seq.AutoResolved) > 0 {
+		sb.WriteString("\n")
+		sb.WriteString(
+			colors.Warning("Resolved conflicts with the recorded resolutions (please review them):") + "\n",
+		)
+		for _, msg := range vm.state.Seq.AutoResolved {
+			sb.WriteString("  - " + msg + "\n")
+		}
+	}
+	if vm.state != nil && vm.state.Seq != nil && len(vm.state.Seq.Warnings) > 0 {
+		sb.WriteString("\n")
+		for _, msg := range vm.state.Seq.Warnings {
+			sb.WriteString(colors.Warning("⚠ "+msg) + "\n")
+		}
+	}
 	if vm.rebaseConflictErrorHeadline != "" {
 		sb.WriteString("\n")
 		sb.WriteString(
@@ -225,8 +257,17 @@ func (vm *RestackModel) View() tea.View {
 		sb.WriteString(vm.rebaseConflictErrorHeadline + "\n")
 		sb.WriteString(vm.rebaseConflictHint + "\n")
 		sb.WriteString("\n")
+		if len(vm.state.Seq.Stashes) > 0 {
+			sb.WriteString(
+				"Your local changes are stashed and will be restored when the restack finishes or is aborted.\n",
+			)
+		}
+		resolveIn := ""
+		if vm.state.Seq.InterruptedWorktree != "" {
+			resolveIn = " in the worktree at " + colors.UserInput(vm.state.Seq.InterruptedWorktree)
+		}
 		sb.WriteString(
-			"Resolve the conflicts and continue the restack with " + colors.CliCmd(
+			"Resolve the conflicts" + resolveIn + " and continue the restack with " + colors.CliCmd(
 				vm.options.Command+" --continue",
 			),
 		)
@@ -0,0 +1,106 @@
+package sequencer
+
+import (
+	"context"
+
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// SimulatedRestack is the predicted result of a RestackOp.
+type SimulatedRestack struct {
+	Name plumbing.ReferenceName
+	// True if the branch would be rewritten (e.g., the branch is already based
+	// on the new parent, but the new parent is rewritten).
+	Rewritten bool
+	// The commits that are predicted to conflict. Empty if the branch applies
+	// cleanly.
+	Conflicts []*CommitConflict
+	// True if the conflicts cannot be predicted (e.g., the branch has merge
+	// commits).
+	Unknown bool
+	// True if a branch that this branch is rebased onto is predicted to
+	// conflict (or cannot be predicted). The prediction assumes that the
+	// conflicts are resolved by keeping the conflict markers, so it can differ
+	// from the actual result.
+	AfterConflict bool
+}
+
+// Simulate predicts whether the restack operations conflict by replaying the
+// commits (or merging the new parent with sync.strategy: merge) with
+// `git merge-tree`, without changing any refs or the working tree.
+// The branches are replayed in order, so that a branch is simulated against the
+// simulated result of its new parent.
+func Simulate(
+	ctx context.Context,
+	repo *git.Repo,
+	db meta.DB,
+	ops []RestackOp,
+) ([]*SimulatedRestack, error) {
+	if !repo.SupportsMergeTreeWriteTree(ctx) {
+		// Nothing can be predicted without `git merge-tree --write-tree`.
+		var ret []*SimulatedRestack
+		for _, op := range ops {
+			ret = append(ret, &SimulatedRestack{Name: op.Name, Unknown: true})
+		}
+		return ret, nil
+	}
+	seq := NewSequencer(repo.GetRemoteName(), db, ops)
+	// The simulated heads of the branches that were replayed.
+	heads := map[plumbing.ReferenceName]plumbing.Hash{}
+	conflicted := map[plumbing.ReferenceName]bool{}
+	var ret []*SimulatedRestack
+	for _, op := range ops {
+		sim := &SimulatedRestack{Name: op.Name}
+		ret = append(ret, sim)
+		branchingPoint, newParentHash, err := seq.rebaseTarget(ctx, repo, op)
+		if err != nil {
+			return nil, err
+		}
+		if h, ok := heads[op.NewParent]; ok && op.NewParentHash.IsZero() {
+			newParentHash = h
+			sim.AfterConflict = conflicted[op.NewParent]
+		}
+		head, err := seq.getBranchCommit(repo, op.Name)
+		if err != nil {
+			return nil, err
+		}
+		if seq.mergesBranch(op) {
+			newHead, conflicts, err := simulateMerge(ctx, repo, op, head, newParentHash)
+			if err != nil {
+				return nil, err
+			}
+			sim.Conflicts = conflicts
+			sim.Rewritten = newHead != head.String()
+			heads[op.Name] = plumbing.NewHash(newHead)
+			conflicted[op.Name] = sim.AfterConflict || len(conflicts) > 0
+			continue
+		}
+		// Same as the special case in rebaseBranch.
+		if b1, err := repo.IsAncestor(ctx, newParentHash.String(), head.String()); err == nil && b1 {
+			if b2, err := repo.IsAncestor(ctx, branchingPoint.String(), newParentHash.String()); err == nil &&
+				b2 {
+				heads[op.Name] = head
+				conflicted[op.Name] = sim.AfterConflict
+				continue
+			}
+		}
+		res, err := replayCommits(ctx, repo, head, branchingPoint, newParentHash, true)
+		if err != nil {
+			return nil, err
+		}
+		if res.NonLinear {
+			// The descendants are simulated against the current head.
+			sim.Unknown = true
+			heads[op.Name] = head
+			conflicted[op.Name] = true
+			continue
+		}
+		sim.Conflicts = res.Conflicts
+		sim.Rewritten = res.Head != head.String()
+		heads[op.Name] = plumbing.NewHash(res.Head)
+		conflicted[op.Name] = sim.AfterConflict || len(res.Conflicts) > 0
+	}
+	return ret, nil
+}
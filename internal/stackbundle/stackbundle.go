@@ -0,0 +1,316 @@
+// Package stackbundle exports a stack to a self-contained file and imports it
+// into another clone of the repository.
+//
+// A bundle contains the av metadata of every branch in the stack (including
+// the branching points and the pull request links) and the commit that each
+// branch points to. Optionally, it embeds a Git bundle with the commits of the
+// branches so that the stack can be imported without fetching the branches
+// from the remote.
+package stackbundle
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"emperror.dev/errors"
+	"github.com/aviator-co/av/internal/git"
+	"github.com/aviator-co/av/internal/meta"
+	"github.com/sirupsen/logrus"
+)
+
+// FormatVersion is the version of the bundle format written by Export.
+const FormatVersion = 1
+
+// Bundle is a portable representation of a stack.
+type Bundle struct {
+	// Version is the version of the bundle format.
+	Version int `json:"version"`
+	// Branches is the list of the branches in the stack in "dependency
+	// order" (i.e., a parent comes before its children).
+	Branches []Branch `json:"branches"`
+	// GitBundle is the contents of a Git bundle (see git-bundle(1)) with the
+	// commits of the branches, if embedded.
+	GitBundle []byte `json:"gitBundle,omitempty"`
+}
+
+// Branch is a branch in a bundle.
+type Branch struct {
+	// Meta is the av metadata of the branch.
+	Meta meta.Branch `json:"meta"`
+	// Head is the commit hash that the branch points to.
+	Head string `json:"head"`
+}
+
+// ExportOpts are the options for Export.
+type ExportOpts struct {
+	// If true, embed a Git bundle with the commits of the branches.
+	GitBundle bool
+}
+
+// Export creates a bundle of the given branches. The branches must be in
+// "dependency order".
+func Export(
+	ctx context.Context,
+	repo *git.Repo,
+	tx meta.ReadTx,
+	branchNames []string,
+	opts ExportOpts,
+) (*Bundle, error) {
+	b := &Bundle{Version: FormatVersion}
+	trunks := map[string]bool{}
+	for _, name := range branchNames {
+		br, ok := tx.Branch(name)
+		if !ok {
+			return nil, errors.Errorf("branch %q is not managed by av", name)
+		}
+		head, err := repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + name})
+		if err != nil {
+			return nil, errors.WrapIff(err, "failed to determine the head commit of %q", name)
+		}
+		if br.Parent.Trunk {
+			trunks[br.Parent.Name] = true
+		}
+		b.Branches = append(b.Branches, Branch{Meta: br, Head: head})
+	}
+	if opts.GitBundle {
+		bs, err := createGitBundle(ctx, repo, branchNames, trunks)
+		if err != nil {
+			return nil, err
+		}
+		b.GitBundle = bs
+	}
+	return b, nil
+}
+
+// Read reads a bundle written by Write.
+func Read(r io.Reader) (*Bundle, error) {
+	var b Bundle
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return nil, errors.WrapIf(err, "failed to read the stack bundle")
+	}
+	if b.Version > FormatVersion {
+		return nil, errors.Errorf(
+			"the stack bundle version %d is newer than the supported version %d; please upgrade av",
+			b.Version, FormatVersion,
+		)
+	}
+	if len(b.Branches) == 0 {
+		return nil, errors.New("the stack bundle has no branches")
+	}
+	return &b, nil
+}
+
+// Write writes the bundle as JSON.
+func (b *Bundle) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// ImportOpts are the options for Import.
+type ImportOpts struct {
+	// If true, reset the branches that already exist at a different commit.
+	Force bool
+}
+
+// ImportResult describes the changes made by Import.
+type ImportResult struct {
+	// Branches that were created.
+	Created []string
+	// Branches that already existed and were reset to the commit in the
+	// bundle.
+	Reset []string
+	// Branches that already existed at the commit in the bundle.
+	Unchanged []string
+
+	undo []*git.UpdateRef
+}
+
+// Import creates the branches in the bundle and writes their metadata to the
+// transaction. The transaction is not committed so that the caller can validate
+// the metadata first and call Rollback to revert the branches on failure.
+//
+// The commits of the branches are taken from the embedded Git bundle if any.
+// Otherwise, they must exist locally or on the remote.
+func Import(
+	ctx context.Context,
+	repo *git.Repo,
+	tx meta.WriteTx,
+	b *Bundle,
+	opts ImportOpts,
+) (*ImportResult, error) {
+	status, err := repo.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := fetchCommits(ctx, repo, b); err != nil {
+		return nil, err
+	}
+
+	res := &ImportResult{}
+	var updates []*git.UpdateRef
+	for _, br := range b.Branches {
+		name := br.Meta.Name
+		if repo.IsTrunkBranch(name) {
+			return nil, errors.Errorf("cannot import the trunk branch %q", name)
+		}
+		current, err := repo.RevParse(ctx, &git.RevParse{Rev: "refs/heads/" + name})
+		exists := err == nil
+		switch {
+		case !exists:
+			res.Created = append(res.Created, name)
+			updates = append(updates, &git.UpdateRef{Ref: "refs/heads/" + name, New: br.Head, Old: git.ZeroOID(br.Head)})
+			res.undo = append(res.undo, &git.UpdateRef{Ref: "refs/heads/" + name, Old: br.Head})
+		case current == br.Head:
+			res.Unchanged = append(res.Unchanged, name)
+		case !opts.Force:
+			return nil, errors.Errorf(
+				"branch %q already exists at a different commit (%s); use --force to reset it to %s",
+				name, git.ShortSha(current), git.ShortSha(br.Head),
+			)
+		case name == status.CurrentBranch:
+			return nil, errors.Errorf("cannot reset the current branch %q; please switch to another branch first", name)
+		default:
+			res.Reset = append(res.Reset, name)
+			updates = append(updates, &git.UpdateRef{Ref: "refs/heads/" + name, New: br.Head, Old: current})
+			res.undo = append(res.undo, &git.UpdateRef{Ref: "refs/heads/" + name, New: current, Old: br.Head})
+		}
+	}
+	if err := repo.UpdateRefs(ctx, updates); err != nil {
+		return nil, err
+	}
+
+	for _, br := range b.Branches {
+		m := br.Meta
+		if m.Parent.Trunk && !repo.IsTrunkBranch(m.Parent.Name) {
+			// The trunk of the exporting clone may have a different name
+			// (e.g., "master" vs "main").
+			logrus.WithFields(logrus.Fields{
+				"branch": m.Name,
+				"trunk":  m.Parent.Name,
+			}).Debug("trunk branch does not exist locally; using the default branch")
+			m.Parent.Name = repo.DefaultBranch()
+		}
+		tx.SetBranch(m)
+	}
+	return res, nil
+}
+
+// Branches returns the names of the imported branches.
+func (r *ImportResult) Branches() []string {
+	var ret []string
+	ret = append(ret, r.Created...)
+	ret = append(ret, r.Reset...)
+	ret = append(ret, r.Unchanged...)
+	return ret
+}
+
+// Rollback reverts the branches created or reset by Import.
+func (r *ImportResult) Rollback(ctx context.Context, repo *git.Repo) error {
+	return repo.UpdateRefs(ctx, r.undo)
+}
+
+func createGitBundle(
+	ctx context.Context,
+	repo *git.Repo,
+	branchNames []string,
+	trunks map[string]bool,
+) ([]byte, error) {
+	f, err := os.CreateTemp(repo.AvTmpDir(), "stack-*.bundle")
+	if err != nil {
+		return nil, err
+	}
+	fp := f.Name()
+	_ = f.Close()
+	// git bundle create refuses to overwrite an existing file.
+	_ = os.Remove(fp)
+	defer os.Remove(fp)
+
+	args := []string{"bundle", "create", "--quiet", fp}
+	for _, name := range branchNames {
+		args = append(args, "refs/heads/"+name)
+	}
+	// Assume that the importer has the trunk, so that the bundle contains
+	// only the commits of the stack.
+	args = append(args, "--not")
+	remote := repo.GetRemoteName()
+	for trunk := range trunks {
+		ref := "refs/remotes/" + remote + "/" + trunk
+		if exists, _ := repo.DoesRefExist(ctx, ref); exists {
+			args = append(args, ref)
+		}
+	}
+	if _, err := repo.Run(ctx, &git.RunOpts{Args: args, ExitError: true}); err != nil {
+		return nil, errors.WrapIf(err, "failed to create a Git bundle")
+	}
+	return os.ReadFile(fp)
+}
+
+// fetchCommits makes sure that the commits of the branches exist locally.
+func fetchCommits(ctx context.Context, repo *git.Repo, b *Bundle) error {
+	if len(b.GitBundle) > 0 {
+		fp := filepath.Join(repo.AvTmpDir(), "import.bundle")
+		if err := os.WriteFile(fp, b.GitBundle, 0o644); err != nil {
+			return err
+		}
+		defer os.Remove(fp)
+		if _, err := repo.Run(ctx, &git.RunOpts{
+			Args:      []string{"bundle", "verify", "--quiet", fp},
+			ExitError: true,
+		}); err != nil {
+			return errors.WrapIf(
+				err,
+				"the Git bundle cannot be applied to this repository (is the trunk up to date?)",
+			)
+		}
+		// Fetch the commits without creating any refs. The branches are
+		// created by Import.
+		args := []string{"fetch", "--quiet", "--no-write-fetch-head", fp}
+		for _, br := range b.Branches {
+			args = append(args, "refs/heads/"+br.Meta.Name)
+		}
+		if _, err := repo.Run(ctx, &git.RunOpts{Args: args, ExitError: true}); err != nil {
+			return errors.WrapIf(err, "failed to fetch the commits from the Git bundle")
+		}
+	}
+
+	var missing []string
+	for _, br := range b.Branches {
+		if !hasCommit(ctx, repo, br.Head) {
+			missing = append(missing, br.Meta.Name)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	remote := repo.GetRemoteName()
+	args := []string{"fetch", "--quiet", remote}
+	for _, name := range missing {
+		args = append(args, "refs/heads/"+name+":refs/remotes/"+remote+"/"+name)
+	}
+	if _, err := repo.Run(ctx, &git.RunOpts{Args: args, ExitError: true}); err != nil {
+		return errors.WrapIff(
+			err,
+			"failed to fetch the branches %s from %q; export the stack with --git-bundle to include the commits",
+			strings.Join(missing, ", "), remote,
+		)
+	}
+	for _, br := range b.Branches {
+		if !hasCommit(ctx, repo, br.Head) {
+			return errors.Errorf(
+				"commit %s of branch %q does not exist on %q; export the stack with --git-bundle to include the commits",
+				git.ShortSha(br.Head), br.Meta.Name, remote,
+			)
+		}
+	}
+	return nil
+}
+
+func hasCommit(ctx context.Context, repo *git.Repo, oid string) bool {
+	out, err := repo.Run(ctx, &git.RunOpts{Args: []string{"cat-file", "-e", oid + "^{commit}"}})
+	return err == nil && out.ExitCode == 0
+}
@@ -0,0 +1,136 @@
+package stackutils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aviator-co/av/internal/meta"
+)
+
+// RenderMermaid renders the stack trees as a Mermaid flowchart. The label of
+// each node is the lines returned by labelFn. The node of highlightBranch (if
+// any) is highlighted.
+func RenderMermaid(
+	nodes []*StackTreeNode,
+	highlightBranch string,
+	labelFn func(branchName string, isTrunk bool) []string,
+) string {
+	sb := strings.Builder{}
+	sb.WriteString("flowchart TD\n")
+	var highlighted string
+	visitGraph(nodes, func(id string, node *StackTreeNode, isTrunk bool) {
+		label := labelFn(node.Branch.BranchName, isTrunk)
+		for i, line := range label {
+			label[i] = escapeMermaid(line)
+		}
+		fmt.Fprintf(&sb, "    %s[\"%s\"]\n", id, strings.Join(label, "<br/>"))
+		if node.Branch.BranchName == highlightBranch {
+			highlighted = id
+		}
+	}, func(parentID, childID string) {
+		fmt.Fprintf(&sb, "    %s --> %s\n", parentID, childID)
+	})
+	if highlighted != "" {
+		sb.WriteString("    classDef current stroke-width:3px\n")
+		fmt.Fprintf(&sb, "    class %s current\n", highlighted)
+	}
+	return sb.String()
+}
+
+// RenderDOT renders the stack trees as a Graphviz DOT graph. The label of each
+// node is the lines returned by labelFn. The node of highlightBranch (if any)
+// is highlighted.
+func RenderDOT(
+	nodes []*StackTreeNode,
+	highlightBranch string,
+	labelFn func(branchName string, isTrunk bool) []string,
+) string {
+	sb := strings.Builder{}
+	sb.WriteString("digraph stacks {\n")
+	sb.WriteString("    node [shape=box];\n")
+	visitGraph(nodes, func(id string, node *StackTreeNode, isTrunk bool) {
+		label := labelFn(node.Branch.BranchName, isTrunk)
+		for i, line := range label {
+			label[i] = escapeDOT(line)
+		}
+		attrs := fmt.Sprintf("label=\"%s\"", strings.Join(label, "\\n"))
+		if isTrunk {
+			attrs += ", style=rounded"
+		}
+		if node.Branch.BranchName == highlightBranch {
+			attrs += ", penwidth=3"
+		}
+		fmt.Fprintf(&sb, "    %s [%s];\n", id, attrs)
+	}, func(parentID, childID string) {
+		fmt.Fprintf(&sb, "    %s -> %s;\n", parentID, childID)
+	})
+	sb.WriteString("}\n")
+	return sb.String()
+}
+
+// visitGraph visits the nodes and then the edges in depth-first order. The
+// nodes are given IDs that are safe to use in the graph languages (branch names
+// can contain characters such as "/" and "-").
+func visitGraph(
+	nodes []*StackTreeNode,
+	nodeFn func(id string, node *StackTreeNode, isTrunk bool),
+	edgeFn func(parentID, childID string),
+) {
+	type edge struct{ parent, child string }
+	var edges []edge
+	var n int
+	var visit func(node *StackTreeNode, isTrunk bool) string
+	visit = func(node *StackTreeNode, isTrunk bool) string {
+		id := fmt.Sprintf("n%d", n)
+		n++
+		nodeFn(id, node, isTrunk)
+		for _, child := range node.Children {
+			// Reserve the slot so that the edges are in the same order as
+			// the nodes.
+			edges = append(edges, edge{parent: id})
+			i := len(edges) - 1
+			edges[i].child = visit(child, false)
+		}
+		return id
+	}
+	for _, node := range nodes {
+		visit(node, true)
+	}
+	for _, e := range edges {
+		edgeFn(e.parent, e.child)
+	}
+}
+
+func escapeMermaid(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(s)
+}
+
+func escapeDOT(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// GraphNodeLabel returns the label of a branch node for RenderMermaid and
+// RenderDOT: the branch name, the pull request, and the number of commits on the
+// branch. Pass a negative commit count if it's unknown.
+func GraphNodeLabel(tx meta.ReadTx, branchName string, isTrunk bool, commits int) []string {
+	label := []string{branchName}
+	if isTrunk {
+		return label
+	}
+	bi, _ := tx.Branch(branchName)
+	if bi.PullRequest != nil && bi.PullRequest.Number != 0 {
+		pr := fmt.Sprintf("#%d", bi.PullRequest.Number)
+		if bi.PullRequest.State != "" {
+			pr += " " + strings.ToLower(string(bi.PullRequest.State))
+		}
+		label = append(label, pr)
+	} else {
+		label = append(label, "no pull request")
+	}
+	if commits == 1 {
+		label = append(label, "1 commit")
+	} else if commits >= 0 {
+		label = append(label, fmt.Sprintf("%d commits", commits))
+	}
+	return label
+}
@@ -0,0 +1,50 @@
+package stackutils_test
+
+import (
+	"testing"
+
+	"github.com/aviator-co/av/internal/utils/stackutils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderGraph(t *testing.T) {
+	nodes := []*stackutils.StackTreeNode{
+		{
+			Branch: &stackutils.StackTreeBranchInfo{BranchName: "main"},
+			Children: []*stackutils.StackTreeNode{
+				{
+					Branch: &stackutils.StackTreeBranchInfo{BranchName: "feature/one", ParentBranchName: "main"},
+					Children: []*stackutils.StackTreeNode{
+						{Branch: &stackutils.StackTreeBranchInfo{BranchName: `"two"`, ParentBranchName: "feature/one"}},
+					},
+				},
+			},
+		},
+	}
+	labelFn := func(branchName string, isTrunk bool) []string {
+		if isTrunk {
+			return []string{branchName}
+		}
+		return []string{branchName, "1 commit"}
+	}
+
+	assert.Equal(t, `flowchart TD
+    n0["main"]
+    n1["feature/one<br/>1 commit"]
+    n2["#quot;two#quot;<br/>1 commit"]
+    n0 --> n1
+    n1 --> n2
+    classDef current stroke-width:3px
+    class n1 current
+`, stackutils.RenderMermaid(nodes, "feature/one", labelFn))
+
+	assert.Equal(t, `digraph stacks {
+    node [shape=box];
+    n0 [label="main", style=rounded];
+    n1 [label="feature/one\n1 commit"];
+    n2 [label="\"two\"\n1 commit", penwidth=3];
+    n0 -> n1;
+    n1 -> n2;
+}
+`, stackutils.RenderDOT(nodes, `"two"`, labelFn))
+}
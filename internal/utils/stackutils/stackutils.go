@@ -147,6 +147,38 @@ func BuildStackTreeRelatedBranchStacks(
 	return buildStackTree(currentBranch, branchesToInclude, sortCurrent), nil
 }
 
+// BuildStackTreeLabeledBranches builds the stack trees of the branches that
+// have the given label. The ancestors of the labeled branches are included so
+// that the trees are connected to the trunk.
+func BuildStackTreeLabeledBranches(
+	tx meta.ReadTx,
+	currentBranch string,
+	sortCurrent bool,
+	label string,
+) ([]*StackTreeNode, error) {
+	branches := map[string]bool{}
+	for _, branch := range meta.LabeledBranches(tx, label) {
+		branches[branch] = true
+		prevs, err := meta.PreviousBranches(tx, branch)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range prevs {
+			branches[name] = true
+		}
+	}
+	var names []string
+	for name := range branches {
+		names = append(names, name)
+	}
+
+	branchesToInclude, err := meta.BranchesMap(tx, names)
+	if err != nil {
+		return nil, err
+	}
+	return buildStackTree(currentBranch, branchesToInclude, sortCurrent), nil
+}
+
 // GetParentBranchNames returns the parent branch names of the given branch.
 // The returned slice is ordered from immediate parent to the root.
 func GetParentBranchNames(rootNode *StackTreeNode, branchName string) []string {